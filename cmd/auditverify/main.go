@@ -0,0 +1,50 @@
+// Command auditverify verifies the hash chain of the audit log stored in the
+// postgres database of PG_DSN. It exits with 1 when the chain is broken and
+// with 2 when it cannot be verified.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/pkg/envutil"
+	"github.com/lrweck/clean-api/pkg/postgres"
+)
+
+func main() {
+
+	timeout := flag.Duration("timeout", 10*time.Minute, "how long the verification may take")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	db, err := postgres.NewDB(ctx, envutil.PostgresDSN())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	log := audit.NewService(postgres.NewAuditStorage(db))
+
+	v, err := log.Verify(ctx)
+
+	if broken := new(audit.ErrBrokenChain); errors.As(err, &broken) {
+		fmt.Printf("audit log is broken at entry %d: %s\n", broken.Seq, broken.Reason)
+		fmt.Printf("%d entries verified before it\n", v.Entries)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to verify audit log: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("audit log is intact: %d entries, head %s\n", v.Entries, v.Head)
+}
@@ -6,24 +6,46 @@ import (
 	"time"
 
 	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/event"
 	"github.com/lrweck/clean-api/pkg/errwrap"
+	"github.com/lrweck/clean-api/pkg/telemetry"
 )
 
-func NewService(s Storage, id IDGen, clock Clock) *Service {
+var tracer = otel.Tracer("github.com/lrweck/clean-api/internal/account")
 
-	if id == nil {
-		id = ulid.Make
+func NewService(s Storage, opts Options) *Service {
+
+	if opts.IDGen == nil {
+		opts.IDGen = ulid.Make
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	if opts.Meter == nil {
+		opts.Meter = otel.Meter("github.com/lrweck/clean-api/internal/account")
 	}
 
-	if clock == nil {
-		clock = time.Now
+	created, err := opts.Meter.Int64Counter("accounts.created",
+		metric.WithUnit("1"),
+		metric.WithDescription("accounts opened"))
+	if err != nil {
+		panic(err)
 	}
 
-	return &Service{s, id, clock}
+	return &Service{s, opts.IDGen, opts.Clock, created}
 }
 
-func (s *Service) New(ctx context.Context, a NewAccount) (ulid.ULID, error) {
+func (s *Service) New(ctx context.Context, a NewAccount) (_ ulid.ULID, err error) {
+	ctx, span := tracer.Start(ctx, "account.New")
+	defer func() { telemetry.End(span, err) }()
 
 	if err := a.validate(); err != nil {
 		return ulid.ULID{}, fmt.Errorf("invalid account: %w", err)
@@ -35,17 +57,43 @@ func (s *Service) New(ctx context.Context, a NewAccount) (ulid.ULID, error) {
 		Name:      a.Name,
 		Document:  a.Document,
 		Balance:   a.StartingBalance,
+		Owner:     a.Owner,
 		CreatedAt: s.now(),
 	}
 
-	if err := s.repo.CreateAccount(ctx, acc); err != nil {
+	ev, err := event.New(s.idGen(), event.AccountCreated, id, acc.CreatedAt, event.AccountCreatedPayload{
+		ID:        id.String(),
+		Name:      acc.Name,
+		Document:  acc.Document,
+		Balance:   acc.Balance,
+		CreatedAt: acc.CreatedAt,
+	})
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	auditEv, err := audit.NewEvent(s.idGen(), acc.CreatedAt, audit.OriginOf(ctx), audit.Change{
+		Action:  audit.AccountCreated,
+		Targets: []ulid.ULID{id},
+		After:   acc,
+	})
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	if err := s.repo.CreateAccount(ctx, acc, ev, auditEv); err != nil {
 		return ulid.ULID{}, fmt.Errorf("failed to create new account: %w", err)
 	}
 
+	s.created.Add(ctx, 1)
+
 	return id, nil
 }
 
-func (s *Service) Retrieve(ctx context.Context, id string) (*Account, error) {
+func (s *Service) Retrieve(ctx context.Context, id string) (_ *Account, err error) {
+	ctx, span := tracer.Start(ctx, "account.Retrieve",
+		trace.WithAttributes(attribute.String("account.id", id)))
+	defer func() { telemetry.End(span, err) }()
 
 	acc, err := s.repo.GetAccount(ctx, id)
 
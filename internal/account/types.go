@@ -7,12 +7,18 @@ import (
 
 	"github.com/oklog/ulid/v2"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/lrweck/clean-api/internal/event"
 )
 
 type NewAccount struct {
 	Name            string
 	Document        string
 	StartingBalance decimal.Decimal
+	// Owner is the end user the account belongs to, empty for accounts
+	// opened by services.
+	Owner string
 }
 
 func (a NewAccount) validate() error {
@@ -36,22 +42,34 @@ type Account struct {
 	Name      string
 	Document  string
 	Balance   decimal.Decimal
+	Owner     string
 	CreatedAt time.Time
 	UpdateAt  time.Time
 }
 
 type Storage interface {
 	GetAccount(ctx context.Context, id string) (*Account, error)
-	CreateAccount(ctx context.Context, acc Account) error
+	// CreateAccount stores the account and records evs in the outbox
+	// atomically.
+	CreateAccount(ctx context.Context, acc Account, evs ...event.Event) error
 }
 
 type Service struct {
-	repo  Storage
-	idGen IDGen
-	now   Clock
+	repo    Storage
+	idGen   IDGen
+	now     Clock
+	created metric.Int64Counter
 }
 
 type (
 	IDGen func() ulid.ULID
 	Clock func() time.Time
 )
+
+// Options customizes a Service. Zero fields fall back to ulid.Make,
+// time.Now and the global meter provider.
+type Options struct {
+	IDGen IDGen
+	Clock Clock
+	Meter metric.Meter
+}
@@ -0,0 +1,242 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+func NewFeed(b Balances, cfg Config) *Feed {
+
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = DefaultConfig.HistorySize
+	}
+
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultConfig.BufferSize
+	}
+
+	return &Feed{
+		balances: b,
+		cfg:      cfg,
+		history:  map[ulid.ULID][]Activity{},
+		watchers: map[ulid.ULID]map[*Watcher]struct{}{},
+	}
+}
+
+// Publish implements event.Publisher by turning transfer events into the
+// activity of every account involved. Completed transfers also announce
+// the balance changes, with the balances read at publish time. Events seen
+// before are ignored, as the relay delivers at least once.
+func (f *Feed) Publish(ctx context.Context, e event.Event) error {
+
+	kind := TransferCompleted
+	switch e.Type {
+	case event.TransferCompleted:
+	case event.TransferFailed:
+		kind = TransferFailed
+	default:
+		return nil
+	}
+
+	var p event.TransferPayload
+	if err := goccy.Unmarshal(e.Payload, &p); err != nil {
+		return fmt.Errorf("failed to decode payload of event %s: %w", e.ID, err)
+	}
+
+	deltas, err := transferDeltas(p)
+	if err != nil {
+		return fmt.Errorf("invalid payload of event %s: %w", e.ID, err)
+	}
+
+	var acts []Activity
+	for _, d := range deltas {
+		acts = append(acts, Activity{
+			Account:    d.account,
+			Kind:       kind,
+			EventID:    e.ID,
+			Data:       e.Payload,
+			OccurredAt: e.OccurredAt,
+		})
+	}
+
+	if kind == TransferCompleted {
+		for _, d := range deltas {
+			act, err := f.balanceChanged(ctx, e, p.ID, d)
+			if err != nil {
+				return err
+			}
+			acts = append(acts, act)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, act := range acts {
+		if f.seen(act) {
+			continue
+		}
+
+		f.seq++
+		act.ID = f.seq
+		f.record(act)
+		f.notify(act)
+	}
+
+	return nil
+}
+
+// Watch starts watching the activity of an account. When after is not
+// nil, the retained activities following it are returned to be sent before
+// the ones received from the watcher.
+func (f *Feed) Watch(account ulid.ULID, after *uint64) (*Watcher, []Activity) {
+
+	c := make(chan Activity, f.cfg.BufferSize)
+	w := &Watcher{C: c, c: c, account: account, feed: f}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ws, ok := f.watchers[account]
+	if !ok {
+		ws = map[*Watcher]struct{}{}
+		f.watchers[account] = ws
+	}
+	ws[w] = struct{}{}
+
+	if after == nil {
+		return w, nil
+	}
+
+	var backlog []Activity
+	for _, act := range f.history[account] {
+		if act.ID > *after {
+			backlog = append(backlog, act)
+		}
+	}
+
+	return w, backlog
+}
+
+// Close stops the watcher and closes its channel. It is safe to call more
+// than once.
+func (w *Watcher) Close() {
+	w.feed.mu.Lock()
+	defer w.feed.mu.Unlock()
+
+	w.feed.remove(w)
+}
+
+func (f *Feed) remove(w *Watcher) {
+	ws := f.watchers[w.account]
+	if _, ok := ws[w]; !ok {
+		return
+	}
+
+	delete(ws, w)
+	if len(ws) == 0 {
+		delete(f.watchers, w.account)
+	}
+	close(w.c)
+}
+
+// notify sends act to the watchers of its account. Watchers too far behind
+// are dropped rather than blocking the feed; they resume from the history
+// when they reconnect.
+func (f *Feed) notify(act Activity) {
+	for w := range f.watchers[act.Account] {
+		select {
+		case w.c <- act:
+		default:
+			f.remove(w)
+		}
+	}
+}
+
+func (f *Feed) record(act Activity) {
+	h := append(f.history[act.Account], act)
+	if len(h) > f.cfg.HistorySize {
+		h = append(h[:0:0], h[len(h)-f.cfg.HistorySize:]...)
+	}
+	f.history[act.Account] = h
+}
+
+func (f *Feed) seen(act Activity) bool {
+	for _, h := range f.history[act.Account] {
+		if h.EventID == act.EventID && h.Kind == act.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Feed) balanceChanged(ctx context.Context, e event.Event, transfer string, d delta) (Activity, error) {
+
+	acc, err := f.balances.Retrieve(ctx, d.account.String())
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to retrieve balance of account %s: %w", d.account, err)
+	}
+
+	data, err := goccy.Marshal(BalanceChangedPayload{
+		Account:  d.account.String(),
+		Transfer: transfer,
+		Delta:    d.amount,
+		Balance:  acc.Balance,
+	})
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to encode balance change: %w", err)
+	}
+
+	return Activity{
+		Account:    d.account,
+		Kind:       BalanceChanged,
+		EventID:    e.ID,
+		Data:       data,
+		OccurredAt: e.OccurredAt,
+	}, nil
+}
+
+type delta struct {
+	account ulid.ULID
+	amount  decimal.Decimal
+}
+
+// transferDeltas nets the balance change of every account involved in a
+// transfer, in the order they appear in it.
+func transferDeltas(p event.TransferPayload) ([]delta, error) {
+
+	type credit struct {
+		to     string
+		amount decimal.Decimal
+	}
+
+	credits := []credit{{p.To, p.Amount}}
+	if len(p.Legs) > 0 {
+		credits = credits[:0]
+		for _, l := range p.Legs {
+			credits = append(credits, credit{l.To, l.Amount})
+		}
+	}
+
+	from, err := ulid.Parse(p.From)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := []delta{{from, p.Amount.Neg()}}
+	for _, c := range credits {
+		to, err := ulid.Parse(c.to)
+		if err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, delta{to, c.amount})
+	}
+
+	return deltas, nil
+}
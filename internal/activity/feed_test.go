@@ -0,0 +1,75 @@
+package activity_test
+
+import (
+	"context"
+	"testing"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/activity"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+func TestFeedStreamsAndResumesAccountActivity(t *testing.T) {
+	ctx := context.Background()
+
+	accounts := memorydb.NewAccountStorage()
+	outbox := memorydb.NewOutboxStorage(accounts)
+	accService := account.NewService(accounts, account.Options{})
+	txService := transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "from", Document: "1", StartingBalance: decimal.NewFromInt(10)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "to", Document: "2"})
+
+	feed := activity.NewFeed(accService, activity.Config{})
+	w, backlog := feed.Watch(to, nil)
+	defer w.Close()
+
+	if len(backlog) != 0 {
+		t.Fatalf("expected no backlog without a last event id, got %d", len(backlog))
+	}
+
+	relay := func() {
+		evs, _ := outbox.GetUnpublished(ctx, 0)
+		for _, e := range evs {
+			if err := feed.Publish(ctx, e); err != nil {
+				t.Fatalf("failed to publish event: %v", err)
+			}
+		}
+	}
+
+	if _, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(4)}); err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+
+	// the outbox still holds the event, so it is published twice
+	relay()
+	relay()
+
+	first, second := <-w.C, <-w.C
+	if first.Kind != activity.TransferCompleted || second.Kind != activity.BalanceChanged {
+		t.Fatalf("unexpected activities %s and %s", first.Kind, second.Kind)
+	}
+
+	var change activity.BalanceChangedPayload
+	goccy.Unmarshal(second.Data, &change)
+	if !change.Delta.Equal(decimal.NewFromInt(4)) || !change.Balance.Equal(decimal.NewFromInt(4)) {
+		t.Fatalf("unexpected balance change %+v", change)
+	}
+
+	select {
+	case act := <-w.C:
+		t.Fatalf("republished event streamed again as %+v", act)
+	default:
+	}
+
+	resumed, backlog := feed.Watch(to, &first.ID)
+	defer resumed.Close()
+
+	if len(backlog) != 1 || backlog[0].ID != second.ID {
+		t.Fatalf("expected to resume after activity %d, got %+v", first.ID, backlog)
+	}
+}
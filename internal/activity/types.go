@@ -0,0 +1,80 @@
+package activity
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+)
+
+type Kind string
+
+const (
+	BalanceChanged    Kind = "balance.changed"
+	TransferCompleted Kind = "transfer.completed"
+	TransferFailed    Kind = "transfer.failed"
+)
+
+// Activity is something that happened to an account, as streamed to its
+// watchers. IDs increase monotonically across the feed, so watchers resume
+// by asking for the activities after the last ID they saw. They start over
+// with every feed, and so every process.
+type Activity struct {
+	ID         uint64
+	Account    ulid.ULID
+	Kind       Kind
+	EventID    ulid.ULID
+	Data       []byte
+	OccurredAt time.Time
+}
+
+type BalanceChangedPayload struct {
+	Account  string          `json:"account"`
+	Transfer string          `json:"transfer"`
+	Delta    decimal.Decimal `json:"delta"`
+	Balance  decimal.Decimal `json:"balance"`
+}
+
+// Balances looks up the balance announced by balance changes.
+type Balances interface {
+	Retrieve(ctx context.Context, id string) (*account.Account, error)
+}
+
+type Config struct {
+	// HistorySize is the number of recent activities kept per account for
+	// resuming streams.
+	HistorySize int
+	// BufferSize is the number of activities a watcher may fall behind
+	// before it is dropped.
+	BufferSize int
+}
+
+var DefaultConfig = Config{
+	HistorySize: 100,
+	BufferSize:  64,
+}
+
+// Feed is an in-process bus of account activity fed by domain events. It is
+// best-effort: it only sees the events relayed by its own process, which
+// with several instances are a share of them.
+type Feed struct {
+	balances Balances
+	cfg      Config
+
+	mu       sync.Mutex
+	seq      uint64
+	history  map[ulid.ULID][]Activity
+	watchers map[ulid.ULID]map[*Watcher]struct{}
+}
+
+type Watcher struct {
+	C <-chan Activity
+
+	c       chan Activity
+	account ulid.ULID
+	feed    *Feed
+}
@@ -0,0 +1,164 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+// tokenPrefix marks the secrets issued by the API, so they are easy to spot
+// in leaked logs or repositories.
+const tokenPrefix = "cak_"
+
+// prefixLen is how much of a secret is kept in clear to tell keys apart.
+const prefixLen = len(tokenPrefix) + 8
+
+func NewService(s Storage, id IDGen, clock Clock) *Service {
+
+	if id == nil {
+		id = ulid.Make
+	}
+
+	if clock == nil {
+		clock = time.Now
+	}
+
+	return &Service{s, id, clock}
+}
+
+// New issues a key. The returned secret is not stored and cannot be
+// retrieved again.
+func (s *Service) New(ctx context.Context, n NewKey) (*Key, string, error) {
+
+	if err := n.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid api key: %w", err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	k, err := s.create(ctx, n, secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return k, secret, nil
+}
+
+// Bootstrap makes sure a key with the given secret exists, so that an
+// administrator can be configured before any key is issued through the API.
+func (s *Service) Bootstrap(ctx context.Context, n NewKey, secret string) error {
+
+	if err := n.validate(); err != nil {
+		return fmt.Errorf("invalid api key: %w", err)
+	}
+
+	_, err := s.repo.GetKeyByHash(ctx, hash(secret))
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to look up bootstrap api key: %w", err)
+	}
+
+	_, err = s.create(ctx, n, secret)
+	return err
+}
+
+func (s *Service) create(ctx context.Context, n NewKey, secret string) (*Key, error) {
+
+	// configured secrets may be short; only issued ones reveal a prefix
+	var prefix string
+	if strings.HasPrefix(secret, tokenPrefix) && len(secret) > 2*prefixLen {
+		prefix = secret[:prefixLen]
+	}
+
+	k := Key{
+		ID:        s.idGen(),
+		Name:      n.Name,
+		Prefix:    prefix,
+		Hash:      hash(secret),
+		Scopes:    n.Scopes,
+		CreatedAt: s.clock(),
+	}
+
+	if err := s.repo.CreateKey(ctx, k); err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return &k, nil
+}
+
+func (s *Service) Retrieve(ctx context.Context, id ulid.ULID) (*Key, error) {
+
+	k, err := s.repo.GetKey(ctx, id)
+
+	return k, errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to retrieve api key %s", id))
+}
+
+func (s *Service) List(ctx context.Context) ([]Key, error) {
+
+	ks, err := s.repo.ListKeys(ctx)
+
+	return ks, errwrap.WrapIfNotNil(err, "failed to list api keys")
+}
+
+// Revoke disables a key for good. Revoking a revoked key is a no-op.
+func (s *Service) Revoke(ctx context.Context, id ulid.ULID) error {
+
+	err := s.repo.RevokeKey(ctx, id, s.clock())
+
+	return errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to revoke api key %s", id))
+}
+
+// Authenticate returns the principal of a secret. Unknown and revoked keys
+// are reported alike, as ErrInvalidKey.
+func (s *Service) Authenticate(ctx context.Context, secret string) (*auth.Principal, error) {
+
+	if secret == "" {
+		return nil, ErrMissingKey
+	}
+
+	k, err := s.repo.GetKeyByHash(ctx, hash(secret))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate api key: %w", err)
+	}
+
+	if k.Revoked() {
+		return nil, ErrInvalidKey
+	}
+
+	return &auth.Principal{KeyID: k.ID, Name: k.Name, Scopes: k.Scopes}, nil
+}
+
+// hash digests a secret for storage and lookup. Secrets are 256 bit random
+// values, so a fast hash is enough: there is nothing to brute force.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+func TestAuthenticateAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	storage := memorydb.NewAPIKeyStorage()
+	svc := apikey.NewService(storage, nil, nil)
+
+	k, secret, err := svc.New(ctx, apikey.NewKey{Name: "reader", Scopes: []auth.Scope{auth.ScopeAccountsRead}})
+	if err != nil {
+		t.Fatalf("failed to issue key: %v", err)
+	}
+
+	if !strings.HasPrefix(secret, k.Prefix) || k.Hash == "" || strings.Contains(k.Hash, secret) {
+		t.Fatalf("expected only a hash and a prefix of the secret to be kept, got %+v", k)
+	}
+
+	p, err := svc.Authenticate(ctx, secret)
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+
+	if p.KeyID != k.ID || !p.Has(auth.ScopeAccountsRead) || p.Has(auth.ScopeAccountsWrite) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+
+	if _, err := svc.Authenticate(ctx, secret+"x"); !errors.Is(err, apikey.ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey for an unknown key, got %v", err)
+	}
+
+	if _, err := svc.Authenticate(ctx, ""); !errors.Is(err, apikey.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey, got %v", err)
+	}
+
+	if err := svc.Revoke(ctx, k.ID); err != nil {
+		t.Fatalf("failed to revoke: %v", err)
+	}
+
+	if _, err := svc.Authenticate(ctx, secret); !errors.Is(err, apikey.ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey for a revoked key, got %v", err)
+	}
+}
+
+func TestBootstrapIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	svc := apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil)
+
+	admin := apikey.NewKey{Name: "admin", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	for i := 0; i < 2; i++ {
+		if err := svc.Bootstrap(ctx, admin, "configured-secret"); err != nil {
+			t.Fatalf("failed to bootstrap: %v", err)
+		}
+	}
+
+	ks, _ := svc.List(ctx)
+	if len(ks) != 1 {
+		t.Fatalf("expected a single bootstrapped key, got %d", len(ks))
+	}
+
+	p, err := svc.Authenticate(ctx, "configured-secret")
+	if err != nil || !p.Has(auth.ScopeTransfersWrite) {
+		t.Fatalf("expected the admin to be granted every scope, got %+v, %v", p, err)
+	}
+}
+
+func TestNewKeyValidation(t *testing.T) {
+	svc := apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil)
+
+	_, _, err := svc.New(context.Background(), apikey.NewKey{Scopes: []auth.Scope{"accounts:delete"}})
+
+	errval := new(apikey.ErrValidation)
+	if !errors.As(err, &errval) || len(errval.Errors()) != 2 {
+		t.Fatalf("expected a missing name and an unknown scope, got %v", err)
+	}
+}
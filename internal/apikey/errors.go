@@ -0,0 +1,37 @@
+package apikey
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("api key not found")
+	ErrMissingKey = errors.New("api key is required")
+	ErrInvalidKey = errors.New("invalid or revoked api key")
+
+	ErrNoName       = errors.New("api key name is required")
+	ErrNoScopes     = errors.New("at least one scope is required")
+	ErrInvalidScope = errors.New("unknown scope")
+)
+
+type ErrValidation struct {
+	errs []error
+}
+
+func (e *ErrValidation) Error() string {
+	return "validation error"
+}
+
+func (e *ErrValidation) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ErrValidation) Errors() []string {
+	if e == nil {
+		return nil
+	}
+
+	errs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err.Error()
+	}
+	return errs
+}
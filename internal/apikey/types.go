@@ -0,0 +1,78 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/auth"
+)
+
+type Storage interface {
+	CreateKey(ctx context.Context, k Key) error
+	GetKey(ctx context.Context, id ulid.ULID) (*Key, error)
+	// GetKeyByHash returns the key whose secret hashes to hash.
+	GetKeyByHash(ctx context.Context, hash string) (*Key, error)
+	ListKeys(ctx context.Context) ([]Key, error)
+	RevokeKey(ctx context.Context, id ulid.ULID, at time.Time) error
+}
+
+type NewKey struct {
+	Name   string
+	Scopes []auth.Scope
+}
+
+func (n NewKey) validate() error {
+	var errs []error
+
+	if strings.TrimSpace(n.Name) == "" {
+		errs = append(errs, ErrNoName)
+	}
+
+	if len(n.Scopes) == 0 {
+		errs = append(errs, ErrNoScopes)
+	}
+
+	for _, s := range n.Scopes {
+		if !auth.Known(s) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidScope, s))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ErrValidation{errs}
+	}
+
+	return nil
+}
+
+// Key is a stored API key. The secret itself is never stored, only its
+// hash.
+type Key struct {
+	ID   ulid.ULID
+	Name string
+	// Prefix is the start of the secret, to tell keys apart.
+	Prefix    string
+	Hash      string
+	Scopes    []auth.Scope
+	CreatedAt time.Time
+	RevokedAt time.Time
+}
+
+func (k *Key) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+type Service struct {
+	repo  Storage
+	idGen IDGen
+	clock Clock
+}
+
+type (
+	IDGen func() ulid.ULID
+	Clock func() time.Time
+)
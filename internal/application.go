@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,52 +15,130 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
 
 	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/activity"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/standingorder"
 	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/internal/webhook"
 	"github.com/lrweck/clean-api/pkg/envutil"
+	"github.com/lrweck/clean-api/pkg/health"
+	"github.com/lrweck/clean-api/pkg/jwks"
 	"github.com/lrweck/clean-api/pkg/memorydb"
 	"github.com/lrweck/clean-api/pkg/postgres"
+	"github.com/lrweck/clean-api/pkg/publisher"
 	"github.com/lrweck/clean-api/pkg/rest"
 	app_middleware "github.com/lrweck/clean-api/pkg/rest/middleware"
+	"github.com/lrweck/clean-api/pkg/rpc"
 	"github.com/lrweck/clean-api/pkg/slogger"
 	"github.com/lrweck/clean-api/pkg/telemetry"
+	"github.com/lrweck/clean-api/pkg/worker"
 )
 
 type Application struct {
-	WebServer *echo.Echo
-	Services  *Services
-	Storages  *Storages
-	Common    *Common
-	StartTime time.Time
-	EndTime   time.Time
+	WebServer  *echo.Echo
+	GRPCServer *grpc.Server
+	Services   *Services
+	Storages   *Storages
+	Workers    *Workers
+	Common     *Common
+	StartTime  time.Time
+	EndTime    time.Time
 }
 
 func NewApplication() *Application {
-	// ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	// defer cancel()
-
-	// writeDB, err := postgres.NewDB(ctx, os.Getenv("PG_DSN"))
-	// if err != nil {
-	// 	panic(fmt.Errorf("failed to connect to write database: %w", err))
-	// }
-
 	decimal.MarshalJSONWithoutQuotes = true
 
 	common := getCommons()
-	telemetry.InitOTEL(context.Background(), common.OtelURL)
+	providers, err := telemetry.InitOTEL(context.Background(), telemetry.Config{
+		ServiceName:     envutil.AppName(),
+		ServiceVersion:  envutil.AppVersion(),
+		Environment:     envutil.CurrentEnv(),
+		Exporter:        envutil.TelemetryExporter(),
+		MetricsExporter: envutil.MetricsExporter(),
+		MetricsInterval: envutil.MetricsInterval(),
+		Endpoint:        common.OtelURL,
+		Insecure:        envutil.OTELExporterInsecure(),
+		CACertFile:      envutil.OTELExporterCertificate(),
+		Headers:         envutil.OTELExporterHeaders(),
+		File:            envutil.TelemetryFile(),
+		Sampler:         envutil.OTELTracesSampler(),
+		SamplerArg:      envutil.OTELTracesSamplerArg(),
+		ErrorLogger:     slogger.Named(common.Logger, "telemetry"),
+	})
+	if err != nil {
+		common.Logger.Error("telemetry is partially disabled", slog.String("error", err.Error()))
+	}
+	common.Metrics = providers.MetricsHandler
+	common.shutdownTelemetry = providers.Shutdown
+
+	var db *pgxpool.Pool
+	switch s := envutil.Storage(); s {
+	case "memory":
+	case "postgres":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		db, err = postgres.NewDB(ctx, envutil.PostgresDSN())
+		if err == nil {
+			err = postgres.Migrate(ctx, db)
+		}
+		cancel()
+		if err != nil {
+			panic(fmt.Errorf("failed to connect to write database: %w", err))
+		}
+	default:
+		panic(fmt.Errorf("unknown storage %q, expected memory or postgres", s))
+	}
 
-	storages := getStorages(nil)
-	services := getServices(storages)
+	storages := getStorages(db)
+	services := getServices(storages, common)
+
+	if key := envutil.AdminAPIKey(); key != "" {
+		err := services.keyService.Bootstrap(context.Background(), apikey.NewKey{
+			Name:   "bootstrap admin",
+			Scopes: []auth.Scope{auth.ScopeAdmin},
+		}, key)
+		if err != nil {
+			panic(fmt.Errorf("failed to bootstrap admin api key: %w", err))
+		}
+	} else {
+		common.Logger.Warn("ADMIN_API_KEY is not set, no api key can be issued until one is stored")
+	}
+	workers := getWorkers(services, common)
 	webServer := getWebServer(services, common)
 
 	return &Application{
-		WebServer: webServer,
-		Services:  services,
-		Storages:  storages,
-		Common:    common,
+		WebServer:  webServer,
+		GRPCServer: getGRPCServer(services, common),
+		Services:   services,
+		Storages:   storages,
+		Workers:    workers,
+		Common:     common,
+	}
+}
+
+func getGRPCServer(svcs *Services, cm *Common) *grpc.Server {
+
+	var tokens rpc.Authenticator
+	if svcs.tokens != nil {
+		tokens = svcs.tokens
 	}
+
+	return rpc.NewServer(svcs.accService, svcs.txService, rpc.ServerConfig{
+		Keys:               svcs.keyService,
+		Tokens:             tokens,
+		RateLimitPerPeer:   envutil.RateLimitPerIP(),
+		RateLimitPerClient: envutil.RateLimitPerClient(),
+		RatePeriod:         envutil.RateLimitPeriod(),
+		Logger:             slogger.Named(cm.Logger, "grpc"),
+	})
 }
 
 func (a *Application) Start(port int) error {
@@ -67,7 +146,20 @@ func (a *Application) Start(port int) error {
 	a.StartTime = time.Now()
 	a.Common.Logger.Info("starting application", slog.Int("port", port))
 
-	err := a.WebServer.Start(strPort)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", a.Common.GRPCPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+
+	go func() {
+		if err := a.GRPCServer.Serve(lis); err != nil {
+			a.Common.Logger.Error("gRPC server closed", slog.String("error", err.Error()))
+		}
+	}()
+
+	a.Workers.start(context.Background())
+
+	err = a.WebServer.Start(strPort)
 
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
@@ -76,12 +168,34 @@ func (a *Application) Start(port int) error {
 	return err
 }
 
-func (a *Application) Stop(ctx context.Context, waitCh <-chan os.Signal) error {
+// Stop waits for a signal, then reports the application not ready for
+// drainDelay, so that load balancers notice before the servers stop
+// accepting requests, and gives it up to timeout to shut down gracefully.
+func (a *Application) Stop(ctx context.Context, waitCh <-chan os.Signal, drainDelay, timeout time.Duration) error {
 	signal := <-waitCh
 	a.EndTime = time.Now()
 
+	a.Services.health.Drain()
+
+	select {
+	case <-time.After(drainDelay):
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	start := a.EndTime
-	err := a.WebServer.Shutdown(ctx)
+	err := errors.Join(
+		a.WebServer.Shutdown(ctx),
+		a.stopGRPC(ctx),
+		a.Workers.stop(ctx),
+		a.Services.stop(ctx),
+	)
+	a.Storages.close()
+
+	// flushed last, to export the spans of the shutdown too
+	err = errors.Join(err, a.Common.shutdownTelemetry(ctx))
 	took := time.Since(start)
 
 	a.Common.Logger.Info("signal received, stopping application",
@@ -96,76 +210,392 @@ func (a *Application) Stop(ctx context.Context, waitCh <-chan os.Signal) error {
 	return err
 }
 
+// stopGRPC stops the gRPC server gracefully, closing the remaining
+// connections once ctx is done.
+func (a *Application) stopGRPC(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.GRPCServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		a.GRPCServer.Stop()
+		return fmt.Errorf("failed to stop gRPC server gracefully: %w", ctx.Err())
+	}
+}
+
 func (a *Application) WaitSignal() error {
 	waitCh := make(chan os.Signal, 1)
 
 	signal.Notify(waitCh, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	go a.toggleDebug(hupCh)
+
+	return a.Stop(context.Background(), waitCh, envutil.ShutdownDrainDelay(), envutil.ShutdownTimeout())
+}
 
-	return a.Stop(ctx, waitCh)
+// toggleDebug switches the default log level to debug for a while on every
+// signal, or back when it already is, to debug incidents in production.
+func (a *Application) toggleDebug(hupCh <-chan os.Signal) {
+	levels := a.Common.Levels
+
+	for range hupCh {
+		if levels.Temporary("") {
+			levels.Reset("")
+			a.Common.Logger.Warn("debug logging disabled", slog.String("level", levels.Level("").String()))
+			continue
+		}
+
+		d := envutil.LogDebugDuration()
+		levels.Set("", slog.LevelDebug, d)
+		a.Common.Logger.Warn("debug logging enabled", slog.Duration("revert_after", d))
+	}
 }
 
 type Common struct {
-	Logger  *slog.Logger
-	OtelURL string
+	Logger   *slog.Logger
+	Levels   *slogger.Levels
+	OtelURL  string
+	GRPCPort int
+
+	// Metrics serves the metrics to Prometheus, nil when they are pushed
+	Metrics http.Handler
+
+	shutdownTelemetry func(ctx context.Context) error
 }
 
 func getCommons() *Common {
 
 	env := envutil.CurrentEnv()
-	var logger *slog.Logger
+	levels, errs := getLevels(env)
+
+	// levels filter the records, so the handlers let every level through
+	opts := &slog.HandlerOptions{AddSource: true, Level: slogger.AllLevels}
 
+	var handler slog.Handler
 	switch env {
 	case "devel":
-		logger = slogger.NewTextWithOptions(os.Stdout, &slog.HandlerOptions{
-			AddSource: true,
-			Level:     slog.LevelDebug,
-		})
-	case "production":
-		logger = slogger.NewJSON()
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	var spanEvents slog.Leveler
+	if envutil.LogSpanEvents() {
+		spanEvents = slog.LevelError
+	}
+
+	logger := slog.New(levels.Handler(slogger.NewContextHandler(handler, spanEvents)))
+	slog.SetDefault(logger)
+
+	for _, err := range errs {
+		logger.Warn("ignoring invalid log level", slog.String("error", err.Error()))
 	}
 
 	return &Common{
-		Logger:  logger,
-		OtelURL: envutil.OTELExporterEndpointGo(),
+		Logger:   logger,
+		Levels:   levels,
+		OtelURL:  envutil.OTELExporterEndpointGo(),
+		GRPCPort: envutil.GRPCPort(),
 	}
 }
 
+// getLevels reads the log levels configured, skipping the invalid ones.
+func getLevels(env string) (*slogger.Levels, []error) {
+	var errs []error
+
+	def := slog.LevelInfo
+	if env == "devel" {
+		def = slog.LevelDebug
+	}
+
+	if s := envutil.LogLevel(); s != "" {
+		level, err := slogger.ParseLevel(s)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			def = level
+		}
+	}
+
+	named := make(map[string]slog.Level)
+	for name, s := range envutil.LogLevels() {
+		level, err := slogger.ParseLevel(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("logger %s: %w", name, err))
+			continue
+		}
+		named[name] = level
+	}
+
+	return slogger.NewLevels(def, named), errs
+}
+
 type Storages struct {
 	accStorage account.Storage
 	txStorage  transfer.Storage
+	soStorage  standingorder.Storage
+	evStorage  event.Storage
+	whStorage  webhook.Storage
+	keyStorage apikey.Storage
+	logStorage audit.Storage
+
+	// db is nil when running on memorydb
+	db *pgxpool.Pool
 }
 
 type Services struct {
 	accService *account.Service
 	txService  *transfer.Service
+	soService  *standingorder.Service
+	evRelay    *event.Relay
+	whService  *webhook.Service
+	keyService *apikey.Service
+	feed       *activity.Feed
+	auditLog   *audit.Service
+
+	// tokens verifies end user JWTs, nil when no JWKS is configured
+	tokens *auth.TokenVerifier
+
+	health *health.Checker
+
+	// txBulk coalesces transfer creation, nil when disabled
+	txBulk *rest.BulkProcessor
 }
 
-func getServices(storages *Storages) *Services {
-	return &Services{
-		accService: account.NewService(storages.accStorage, nil, time.Now),
-		txService:  transfer.NewService(storages.txStorage, nil, time.Now),
+func getServices(storages *Storages, cm *Common) *Services {
+	whService := webhook.NewService(storages.whStorage, webhook.Options{
+		Client: webhook.NewClient(envutil.WebhookTimeout()),
+		Policy: webhook.RetryPolicy{
+			MaxAttempts: envutil.WebhookMaxAttempts(),
+			BaseDelay:   envutil.WebhookRetryBaseDelay(),
+			MaxDelay:    envutil.WebhookRetryMaxDelay(),
+		},
+		Concurrency: envutil.WebhookConcurrency(),
+	})
+
+	auditLog := audit.NewService(storages.logStorage)
+
+	accService := account.NewService(storages.accStorage, account.Options{})
+	feed := activity.NewFeed(accService, activity.Config{
+		HistorySize: envutil.AccountEventsHistorySize(),
+	})
+
+	svcs := &Services{
+		accService: accService,
+		txService:  transfer.NewService(storages.txStorage, transfer.Options{Currency: envutil.Currency()}),
+		soService:  standingorder.NewService(storages.soStorage, standingorder.Options{}),
+		evRelay: event.NewRelay(storages.evStorage,
+			publisher.NewMulti(publisher.NewLogger(slogger.Named(cm.Logger, "events")), whService, feed, auditLog), time.Now),
+		whService:  whService,
+		keyService: apikey.NewService(storages.keyStorage, nil, time.Now),
+		feed:       feed,
+		auditLog:   auditLog,
+	}
+
+	var keys jwks.Source
+	switch {
+	case envutil.JWKSFile() != "":
+		keys = jwks.File(envutil.JWKSFile())
+	case envutil.JWKSURL() != "":
+		keys = jwks.URL(envutil.JWKSURL())
 	}
+
+	if keys != nil {
+		svcs.tokens = auth.NewTokenVerifier(
+			jwks.New(keys, envutil.JWKSRefreshInterval(), envutil.JWKSMinRefreshInterval()),
+			envutil.JWTIssuer(), envutil.JWTAudience(), time.Now)
+	}
+
+	observeOutboxLag(svcs.evRelay)
+
+	// a relay falling behind delays events but not requests, so it does not
+	// take the instance out of rotation
+	svcs.health = health.NewChecker(envutil.HealthCheckTimeout(),
+		health.Check{Name: "outbox", Func: outboxLag(svcs.evRelay, envutil.OutboxMaxLag()), Optional: true},
+	)
+
+	// only the otlp exporters send telemetry to a collector at OtelURL
+	switch envutil.TelemetryExporter() {
+	case telemetry.ExporterOTLPGRPC, telemetry.ExporterOTLPHTTP:
+		svcs.health.Add(health.Check{Name: "otel-exporter", Func: telemetry.ExporterReachable(cm.OtelURL), Optional: true})
+	}
+
+	if storages.db != nil {
+		svcs.health.Add(health.Check{Name: "postgres", Func: storages.db.Ping})
+	}
+
+	if envutil.BulkTransfersEnabled() {
+		svcs.txBulk = rest.NewBulkProcessor(svcs.txService, rest.BulkConfig{
+			Shards:       envutil.BulkTransferShards(),
+			MaxBatchSize: envutil.BulkTransferMaxBatchSize(),
+			MaxWait:      envutil.BulkTransferMaxWait(),
+			QueueSize:    envutil.BulkTransferQueueSize(),
+		})
+	}
+
+	return svcs
 }
 
+// outboxLag fails when events wait longer than max to be published, which
+// means the relay is stuck or falling behind.
+func outboxLag(relay *event.Relay, max time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		lag, err := relay.Lag(ctx)
+		if err != nil {
+			return err
+		}
+
+		if lag > max {
+			return fmt.Errorf("oldest unpublished event is %s old", lag.Round(time.Millisecond))
+		}
+
+		return nil
+	}
+}
+
+// observeOutboxLag reports how long the oldest unpublished event has been
+// waiting as the outbox.lag gauge, so that alerts need not poll readiness.
+func observeOutboxLag(relay *event.Relay) {
+	_, err := otel.Meter("outbox").
+		Float64ObservableGauge("outbox.lag",
+			metric.WithUnit("s"),
+			metric.WithDescription("age of the oldest unpublished event"),
+			metric.WithFloat64Callback(func(ctx context.Context, o metric.Float64Observer) error {
+				lag, err := relay.Lag(ctx)
+				if err != nil {
+					return err
+				}
+				o.Observe(lag.Seconds())
+				return nil
+			}))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s *Services) stop(ctx context.Context) error {
+	if s.txBulk == nil {
+		return nil
+	}
+	return s.txBulk.Close(ctx)
+}
+
+// getStorages stores state in db, or in memory when db is nil.
 func getStorages(db *pgxpool.Pool) *Storages {
+	if db != nil {
+		return &Storages{
+			accStorage: postgres.NewAccountStorage(db),
+			txStorage:  postgres.NewTxStorage(db),
+			soStorage:  postgres.NewStandingOrderStorage(db),
+			evStorage:  postgres.NewOutboxStorage(db),
+			whStorage:  postgres.NewWebhookStorage(db),
+			keyStorage: postgres.NewAPIKeyStorage(db),
+			logStorage: postgres.NewAuditStorage(db),
+			db:         db,
+		}
+	}
+
+	accStorage := memorydb.NewAccountStorage()
+	txStorage := memorydb.NewTxStorage(accStorage)
+
 	return &Storages{
-		accStorage: memorydb.NewAccountStorage(), // postgres.NewAccountStorage(db)
-		txStorage:  postgres.NewTxStorage(db),
+		accStorage: accStorage,
+		txStorage:  txStorage,
+		soStorage:  memorydb.NewStandingOrderStorage(txStorage),
+		evStorage:  memorydb.NewOutboxStorage(accStorage),
+		whStorage:  memorydb.NewWebhookStorage(),
+		keyStorage: memorydb.NewAPIKeyStorage(),
+		logStorage: memorydb.NewAuditStorage(),
 	}
 }
 
+func (s *Storages) close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+type Workers struct {
+	txScheduler   *worker.Periodic
+	standingOrder *worker.Periodic
+	outboxRelay   *worker.Periodic
+	webhooks      *worker.Periodic
+}
+
+func getWorkers(svc *Services, cm *Common) *Workers {
+	txBatchSize := envutil.TransferSchedulerBatchSize()
+	soBatchSize := envutil.StandingOrderBatchSize()
+	evBatchSize := envutil.OutboxRelayBatchSize()
+	whBatchSize := envutil.WebhookDeliveryBatchSize()
+
+	logger := slogger.Named(cm.Logger, "workers")
+
+	return &Workers{
+		txScheduler: worker.NewPeriodic("transfer-scheduler", envutil.TransferSchedulerInterval(), logger,
+			func(ctx context.Context) error {
+				_, err := svc.txService.ExecuteDue(audit.ContextWithActor(ctx, "system:transfer-scheduler"), txBatchSize)
+				return err
+			}),
+		standingOrder: worker.NewPeriodic("standing-order", envutil.StandingOrderInterval(), logger,
+			func(ctx context.Context) error {
+				_, err := svc.soService.ExecuteDue(audit.ContextWithActor(ctx, "system:standing-order"), soBatchSize)
+				return err
+			}),
+		outboxRelay: worker.NewPeriodic("outbox-relay", envutil.OutboxRelayInterval(), logger,
+			func(ctx context.Context) error {
+				_, err := svc.evRelay.Relay(ctx, evBatchSize)
+				return err
+			}),
+		webhooks: worker.NewPeriodic("webhook-delivery", envutil.WebhookDeliveryInterval(), logger,
+			func(ctx context.Context) error {
+				_, err := svc.whService.DeliverDue(ctx, whBatchSize)
+				return err
+			}),
+	}
+}
+
+func (w *Workers) start(ctx context.Context) {
+	w.txScheduler.Start(ctx)
+	w.standingOrder.Start(ctx)
+	w.outboxRelay.Start(ctx)
+	w.webhooks.Start(ctx)
+}
+
+func (w *Workers) stop(ctx context.Context) error {
+	return errors.Join(
+		w.txScheduler.Stop(ctx),
+		w.standingOrder.Stop(ctx),
+		w.outboxRelay.Stop(ctx),
+		w.webhooks.Stop(ctx),
+	)
+}
+
 func getWebServer(svc *Services, cm *Common) *echo.Echo {
 	app := echo.New()
 
 	app.JSONSerializer = rest.NewGoccyEchoSerializer()
+	app.Binder = rest.NewBinder()
+	app.HTTPErrorHandler = rest.HTTPErrorHandler
 	app.HideBanner = true
 	app.HidePort = true
 
+	ipExtractor, err := app_middleware.IPExtractor(envutil.TrustedProxies())
+	if err != nil {
+		panic(err)
+	}
+	app.IPExtractor = ipExtractor
+
 	configureMiddlewares(app, cm)
-	configureRoutes(app, svc)
+	configureRoutes(app, svc, cm)
 
 	return app
 }
@@ -175,18 +605,117 @@ func configureMiddlewares(e *echo.Echo, cm *Common) {
 	e.Use(middleware.RequestIDWithConfig(app_middleware.RequestIDConfig()))
 	e.Use(app_middleware.OpenTelemetry())
 	e.Use(app_middleware.RequestMetrics())
-	e.Use(app_middleware.NewLogger(cm.Logger))
+	e.Use(app_middleware.NewLoggerWithConfig(slogger.Named(cm.Logger, "http"), app_middleware.Config{
+		DefaultLevel:     slog.LevelInfo,
+		ClientErrorLevel: slog.LevelWarn,
+		ServerErrorLevel: slog.LevelError,
+
+		WithRequestID: true,
+		WithHeaders:   envutil.LogHeaders(),
+		MaxBodySize:   envutil.LogMaxBodySize(),
+		Redactor:      getRedactor(cm),
+	}))
 	e.Use(middleware.Recover())
 }
-func configureRoutes(e *echo.Echo, svcs *Services) {
-	V1 := e.Group("/v1")
+
+// getRedactor extends the default redaction of the request logger with the
+// configured one. An invalid configuration is reported and the defaults are
+// used instead, so that sensitive data is never logged.
+func getRedactor(cm *Common) *app_middleware.Redactor {
+	cfg := app_middleware.DefaultRedactConfig.Merge(app_middleware.RedactConfig{
+		Fields:   envutil.LogRedactFields(),
+		Paths:    envutil.LogRedactPaths(),
+		Patterns: envutil.LogRedactPatterns(),
+		Headers:  envutil.LogRedactHeaders(),
+		Mode:     app_middleware.RedactMode(envutil.LogRedactMode()),
+		HashKey:  []byte(envutil.LogRedactHashKey()),
+	})
+
+	r, err := app_middleware.NewRedactor(cfg)
+	if err != nil {
+		cm.Logger.Error("invalid log redaction config, using the defaults", slog.String("error", err.Error()))
+		r, _ = app_middleware.NewRedactor(app_middleware.DefaultRedactConfig)
+	}
+
+	return r
+}
+
+func configureRoutes(e *echo.Echo, svcs *Services, cm *Common) {
+	e.GET("/health/live", rest.GET_HealthLive(svcs.health))
+	e.GET("/health/ready", rest.GET_HealthReady(svcs.health))
+	if cm.Metrics != nil {
+		e.GET("/metrics", echo.WrapHandler(cm.Metrics))
+	}
+	e.GET("/openapi.json", rest.GET_OpenAPI(rest.OpenAPI()))
+	e.GET("/docs", rest.GET_Docs())
+
+	var tokens rest.Authenticator
+	if svcs.tokens != nil {
+		tokens = svcs.tokens
+	}
+
+	authenticate := rest.Authenticate(svcs.keyService, tokens)
+	scope := rest.RequireScope
+
+	// addresses are limited before authentication, to slow down key guessing
+	perIP := app_middleware.RateLimit(app_middleware.RateLimitConfig{
+		Name: "ip", Limit: envutil.RateLimitPerIP(), Period: envutil.RateLimitPeriod(), Key: app_middleware.KeyByIP,
+	})
+	perClient := app_middleware.RateLimit(app_middleware.RateLimitConfig{
+		Name: "client", Limit: envutil.RateLimitPerClient(), Period: envutil.RateLimitPeriod(), Key: app_middleware.KeyByPrincipal,
+	})
+	perAccount := app_middleware.RateLimit(app_middleware.RateLimitConfig{
+		Name: "account", Limit: envutil.RateLimitPerAccount(), Period: envutil.RateLimitPeriod(), Key: app_middleware.KeyByAccount("id"),
+	})
+
+	// the event stream is text/event-stream, outside of content negotiation
+	// streams never end on their own, so they are closed on shutdown rather
+	// than waited for
+	streams, closeStreams := context.WithCancel(context.Background())
+	e.Server.RegisterOnShutdown(closeStreams)
+
+	e.GET("/v1/accounts/:id/events", rest.V1_GET_AccountEvents(svcs.accService, svcs.feed, envutil.AccountEventsHeartbeat(), streams.Done()),
+		perIP, authenticate, perClient, scope(auth.ScopeAccountsRead), perAccount)
+
+	V1 := e.Group("/v1", rest.Negotiate(), perIP, authenticate, perClient)
 
 	accounts := V1.Group("/accounts")
-	accounts.POST("", rest.V1_POST_Account(svcs.accService))
-	accounts.GET("/:id", rest.V1_GET_Account(svcs.accService))
+	accounts.POST("", rest.V1_POST_Account(svcs.accService), scope(auth.ScopeAccountsWrite))
+	accounts.GET("/:id", rest.V1_GET_Account(svcs.accService), scope(auth.ScopeAccountsRead), perAccount)
 
-	// transfers := V1.Group("/transfers")
-	// transfers.POST("/", rest.V1POSTTransfer(svcs.txService))
-	// transfers.GET("/:id", rest.V1GETTransfer(svcs.txService))
+	var txService rest.TransferService = svcs.txService
+	if svcs.txBulk != nil {
+		txService = rest.NewCoalescingTransferService(svcs.txService, svcs.txBulk)
+	}
 
+	transfers := V1.Group("/transfers")
+	transfers.POST("", rest.V1_POST_Transfer(txService, svcs.accService), scope(auth.ScopeTransfersWrite))
+	transfers.POST("/batch", rest.V1_POST_TransferBatch(svcs.txService, svcs.accService), scope(auth.ScopeTransfersWrite))
+	transfers.GET("/:id", rest.V1_GET_Transfer(svcs.txService, svcs.accService), scope(auth.ScopeTransfersRead))
+	transfers.POST("/:id/cancel", rest.V1_POST_CancelTransfer(svcs.txService, svcs.accService), scope(auth.ScopeTransfersWrite))
+
+	standingOrders := V1.Group("/standing-orders")
+	standingOrders.POST("", rest.V1_POST_StandingOrder(svcs.soService, svcs.accService), scope(auth.ScopeStandingOrdersWrite))
+	standingOrders.GET("/:id", rest.V1_GET_StandingOrder(svcs.soService, svcs.accService), scope(auth.ScopeStandingOrdersRead))
+	standingOrders.POST("/:id/cancel", rest.V1_POST_CancelStandingOrder(svcs.soService, svcs.accService), scope(auth.ScopeStandingOrdersWrite))
+
+	webhooks := V1.Group("/webhooks")
+	webhooks.POST("", rest.V1_POST_Webhook(svcs.whService, svcs.accService), scope(auth.ScopeWebhooksWrite))
+	webhooks.GET("/:id", rest.V1_GET_Webhook(svcs.whService, svcs.accService), scope(auth.ScopeWebhooksRead))
+	webhooks.DELETE("/:id", rest.V1_DELETE_Webhook(svcs.whService, svcs.accService), scope(auth.ScopeWebhooksWrite))
+	webhooks.GET("/:id/deliveries", rest.V1_GET_WebhookDeliveries(svcs.whService, svcs.accService), scope(auth.ScopeWebhooksRead))
+	webhooks.POST("/:id/deliveries/:delivery_id/redeliver", rest.V1_POST_RedeliverWebhook(svcs.whService, svcs.accService), scope(auth.ScopeWebhooksWrite))
+
+	admin := V1.Group("/admin", scope(auth.ScopeAdmin))
+	admin.GET("/log-levels", rest.V1_GET_LogLevels(cm.Levels))
+	admin.PUT("/log-levels", rest.V1_PUT_LogLevel(cm.Levels))
+	admin.GET("/audit", rest.V1_GET_AuditEntries(svcs.auditLog))
+	admin.GET("/audit/verification", rest.V1_GET_AuditVerification(svcs.auditLog))
+
+	// issued secrets are never logged, redacted or not
+	keys := V1.Group("/api-keys", scope(auth.ScopeAdmin), app_middleware.SkipBodyLog())
+	keys.POST("", rest.V1_POST_APIKey(svcs.keyService))
+	keys.GET("", rest.V1_GET_APIKeys(svcs.keyService))
+	keys.GET("/:id", rest.V1_GET_APIKey(svcs.keyService))
+	keys.DELETE("/:id", rest.V1_DELETE_APIKey(svcs.keyService))
 }
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/slog"
+
+	"github.com/lrweck/clean-api/pkg/rest"
+)
+
+// TestOpenAPICoversRoutes fails when a route is registered without being
+// documented in the OpenAPI document, or documented without a route.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	cm := &Common{Logger: slog.Default()}
+	e := getWebServer(getServices(getStorages(nil), cm), cm)
+
+	doc := rest.OpenAPI()
+	undocumented := map[string]bool{
+		"GET /health/live":  true,
+		"GET /health/ready": true,
+		"GET /metrics":      true,
+		"GET /openapi.json": true,
+		"GET /docs":         true,
+	}
+
+	routes := map[string]bool{}
+	for _, r := range e.Routes() {
+		// groups with middlewares register catch-all not found routes
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+
+		key := r.Method + " " + r.Path
+		routes[key] = true
+
+		if !undocumented[key] && !doc.Has(r.Method, r.Path) {
+			t.Errorf("route %s is missing from the OpenAPI document", key)
+		}
+	}
+
+	doc.Operations(func(method, path string) {
+		if !routes[method+" "+path] {
+			t.Errorf("documented operation %s %s has no route", method, path)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// MaxListLimit caps how many entries List returns at once.
+const MaxListLimit = 500
+
+func NewService(s Storage) *Service {
+	return &Service{s}
+}
+
+// NewEvent creates the event recording c, made by origin at, for services
+// to store in the outbox together with the change. The change is thus
+// never committed without its record, which the relay appends to the log.
+func NewEvent(id ulid.ULID, at time.Time, origin Origin, c Change) (event.Event, error) {
+
+	if len(c.Targets) == 0 {
+		return event.Event{}, fmt.Errorf("audit record of %s has no target", c.Action)
+	}
+
+	before, err := marshal(c.Before)
+	if err != nil {
+		return event.Event{}, fmt.Errorf("failed to encode state before %s: %w", c.Action, err)
+	}
+
+	after, err := marshal(c.After)
+	if err != nil {
+		return event.Event{}, fmt.Errorf("failed to encode state after %s: %w", c.Action, err)
+	}
+
+	targets := make([]string, len(c.Targets))
+	for i, t := range c.Targets {
+		targets[i] = t.String()
+	}
+
+	return event.New(id, event.AuditRecorded, c.Targets[0], at, Record{
+		Actor:     origin.Actor,
+		RequestID: origin.RequestID,
+		Action:    c.Action,
+		Targets:   targets,
+		Before:    before,
+		After:     after,
+	})
+}
+
+func marshal(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// Publish appends the records relayed from the outbox to the log, ignoring
+// every other event. Records published again are not appended twice.
+func (s *Service) Publish(ctx context.Context, e event.Event) error {
+
+	if e.Type != event.AuditRecorded {
+		return nil
+	}
+
+	var r Record
+	if err := json.Unmarshal(e.Payload, &r); err != nil {
+		return fmt.Errorf("failed to decode audit record %s: %w", e.ID, err)
+	}
+
+	_, err := s.Append(ctx, e.ID, e.OccurredAt, r)
+	return err
+}
+
+// Append appends r, recorded at, to the log as the entry id.
+func (s *Service) Append(ctx context.Context, id ulid.ULID, at time.Time, r Record) (*Entry, error) {
+
+	e := Entry{
+		ID: id,
+		// stored with microsecond precision, which the hash must match
+		At:        at.UTC().Truncate(time.Microsecond),
+		Actor:     r.Actor,
+		RequestID: r.RequestID,
+		Action:    r.Action,
+		Targets:   r.Targets,
+		Before:    r.Before,
+		After:     r.After,
+	}
+
+	err := s.repo.AppendEntry(ctx, func(last *Entry) (Entry, error) {
+		e.Seq, e.PrevHash = 1, ""
+		if last != nil {
+			e.Seq, e.PrevHash = last.Seq+1, last.Hash
+		}
+		e.Hash = e.hash()
+		return e, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return &e, nil
+}
+
+// List returns up to f.Limit entries matching f, MaxListLimit at most.
+func (s *Service) List(ctx context.Context, f Filter) ([]Entry, error) {
+
+	if f.Limit <= 0 || f.Limit > MaxListLimit {
+		f.Limit = MaxListLimit
+	}
+
+	es, err := s.repo.ListEntries(ctx, f)
+
+	return es, errwrap.WrapIfNotNil(err, "failed to list audit entries")
+}
+
+// Verification is the outcome of a verification of the log.
+type Verification struct {
+	Entries int
+	// Head is the hash of the last entry. Keeping it elsewhere lets a
+	// later verification tell whether entries were removed from the end.
+	Head string
+}
+
+// Verify walks the whole log, checking that every entry hashes to its hash
+// and links to the one before it. The returned error is an
+// ErrBrokenChain for the first entry that does not.
+func (s *Service) Verify(ctx context.Context) (Verification, error) {
+
+	var (
+		v    Verification
+		last *Entry
+	)
+
+	for {
+		var after int64
+		if last != nil {
+			after = last.Seq
+		}
+
+		es, err := s.repo.ListEntries(ctx, Filter{AfterSeq: after, Limit: MaxListLimit})
+		if err != nil {
+			return v, fmt.Errorf("failed to list audit entries: %w", err)
+		}
+
+		for i := range es {
+			if err := verifyLink(last, &es[i]); err != nil {
+				return v, err
+			}
+
+			last = &es[i]
+			v.Entries++
+			v.Head = last.Hash
+		}
+
+		if len(es) < MaxListLimit {
+			return v, nil
+		}
+	}
+}
+
+func verifyLink(prev, e *Entry) error {
+
+	wantSeq, wantPrev := int64(1), ""
+	if prev != nil {
+		wantSeq, wantPrev = prev.Seq+1, prev.Hash
+	}
+
+	switch {
+	case e.Seq != wantSeq:
+		return &ErrBrokenChain{e.Seq, fmt.Sprintf("expected entry %d, entries are missing", wantSeq)}
+	case e.PrevHash != wantPrev:
+		return &ErrBrokenChain{e.Seq, "does not link to the previous entry"}
+	case e.Hash != e.hash():
+		return &ErrBrokenChain{e.Seq, "content does not match its hash"}
+	}
+
+	return nil
+}
+
+// hash is the SHA-256 of every field of the entry but its own hash. Each
+// field is prefixed with its length, so that no two entries encode alike.
+func (e *Entry) hash() string {
+	h := sha256.New()
+
+	write := func(s string) {
+		binary.Write(h, binary.BigEndian, uint64(len(s)))
+		h.Write([]byte(s))
+	}
+
+	write(strconv.FormatInt(e.Seq, 10))
+	write(e.ID.String())
+	write(e.At.UTC().Format(time.RFC3339Nano))
+	write(e.Actor)
+	write(e.RequestID)
+	write(string(e.Action))
+
+	write(strconv.Itoa(len(e.Targets)))
+	for _, t := range e.Targets {
+		write(t)
+	}
+
+	write(string(e.Before))
+	write(string(e.After))
+	write(e.PrevHash)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// OriginOf returns who makes the changes made with ctx, and in which
+// request.
+func OriginOf(ctx context.Context) Origin {
+	return Origin{Actor: Actor(ctx), RequestID: slogger.RequestIDFromContext(ctx)}
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a copy of ctx whose changes are recorded on
+// behalf of actor, for work no principal asked for, such as the workers.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor names who makes the changes made with ctx: the end user or the API
+// key that authenticated the request, the actor set by ContextWithActor, or
+// anonymous.
+func Actor(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok && p != nil {
+		if p.Subject != "" {
+			return "user:" + p.Subject
+		}
+		return "key:" + p.KeyID.String()
+	}
+
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+
+	return "anonymous"
+}
@@ -0,0 +1,210 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// sliceStorage keeps entries where tests can tamper with them.
+type sliceStorage struct {
+	entries []audit.Entry
+}
+
+func (s *sliceStorage) AppendEntry(ctx context.Context, next func(last *audit.Entry) (audit.Entry, error)) error {
+	var last *audit.Entry
+	if n := len(s.entries); n > 0 {
+		last = &s.entries[n-1]
+	}
+
+	e, err := next(last)
+	if err != nil {
+		return err
+	}
+
+	for _, stored := range s.entries {
+		if stored.ID == e.ID {
+			return nil
+		}
+	}
+
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *sliceStorage) ListEntries(ctx context.Context, f audit.Filter) ([]audit.Entry, error) {
+	var es []audit.Entry
+	for _, e := range s.entries {
+		if e.Seq > f.AfterSeq && (f.Limit <= 0 || len(es) < f.Limit) {
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+
+	tamper := map[string]func(es []audit.Entry) []audit.Entry{
+		"altered": func(es []audit.Entry) []audit.Entry {
+			es[1].After = json.RawMessage(`{"Amount":"1000000"}`)
+			return es
+		},
+		"relinked": func(es []audit.Entry) []audit.Entry {
+			es[1].PrevHash = es[2].Hash
+			return es
+		},
+		"removed": func(es []audit.Entry) []audit.Entry {
+			return append(es[:1], es[2:]...)
+		},
+		"reordered": func(es []audit.Entry) []audit.Entry {
+			es[1], es[2] = es[2], es[1]
+			return es
+		},
+	}
+
+	for name, fn := range tamper {
+		t.Run(name, func(t *testing.T) {
+			storage := &sliceStorage{}
+			log := audit.NewService(storage)
+
+			for i := 0; i < 3; i++ {
+				r := audit.Record{
+					Actor:   "key:test",
+					Action:  audit.TransferCreated,
+					Targets: []string{ulid.Make().String()},
+					After:   json.RawMessage(fmt.Sprintf(`{"Amount":"%d"}`, i)),
+				}
+				if _, err := log.Append(ctx, ulid.Make(), time.Now(), r); err != nil {
+					t.Fatalf("failed to append: %v", err)
+				}
+			}
+
+			if v, err := log.Verify(ctx); err != nil || v.Entries != 3 || v.Head != storage.entries[2].Hash {
+				t.Fatalf("expected an intact chain of 3 entries, got %+v, %v", v, err)
+			}
+
+			storage.entries = fn(storage.entries)
+
+			v, err := log.Verify(ctx)
+
+			var broken *audit.ErrBrokenChain
+			if !errors.As(err, &broken) || !errors.Is(err, audit.ErrTampered) {
+				t.Fatalf("expected the chain to be broken, got %v", err)
+			}
+
+			if broken.Seq < 2 || v.Entries != 1 {
+				t.Fatalf("expected the chain to break after the first entry, got %v after %d entries", err, v.Entries)
+			}
+		})
+	}
+}
+
+func TestPublishAppendsRecordsOnce(t *testing.T) {
+	ctx := context.Background()
+	log := audit.NewService(memorydb.NewAuditStorage())
+
+	ev, err := audit.NewEvent(ulid.Make(), time.Now(), audit.Origin{Actor: "key:test"}, audit.Change{
+		Action:  audit.AccountCreated,
+		Targets: []ulid.ULID{ulid.Make()},
+		After:   map[string]string{"Name": "Alice"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+
+	// relayed again after failing to be marked published
+	for i := 0; i < 2; i++ {
+		if err := log.Publish(ctx, ev); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	if v, err := log.Verify(ctx); err != nil || v.Entries != 1 {
+		t.Fatalf("expected a single entry, got %+v, %v", v, err)
+	}
+}
+
+func TestServicesRecordChanges(t *testing.T) {
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	log := audit.NewService(memorydb.NewAuditStorage())
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{Clock: clock})
+	txService := transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{Clock: clock})
+	relay := event.NewRelay(memorydb.NewOutboxStorage(accounts), log, clock)
+
+	ctx := auth.ContextWithPrincipal(context.Background(), &auth.Principal{Subject: "alice"})
+	ctx = slogger.ContextWithRequestID(ctx, "req-1")
+
+	from, err := accService.New(ctx, account.NewAccount{Name: "Alice", Document: "1", StartingBalance: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	to, err := accService.New(ctx, account.NewAccount{Name: "Bob", Document: "2"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	txID, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(10), ExecuteAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("failed to schedule transfer: %v", err)
+	}
+
+	if err := txService.Cancel(ctx, txID); err != nil {
+		t.Fatalf("failed to cancel transfer: %v", err)
+	}
+
+	if n, err := relay.Relay(context.Background(), 100); err != nil || n != 6 {
+		t.Fatalf("expected the 6 events to be relayed, got %d, %v", n, err)
+	}
+
+	es, err := log.List(context.Background(), audit.Filter{Target: txID.String()})
+	if err != nil {
+		t.Fatalf("failed to list entries: %v", err)
+	}
+
+	if len(es) != 2 || es[0].Action != audit.TransferScheduled || es[1].Action != audit.TransferCanceled {
+		t.Fatalf("expected the transfer to be scheduled then canceled, got %+v", es)
+	}
+
+	canceled := es[1]
+	if canceled.Actor != "user:alice" || canceled.RequestID != "req-1" || !canceled.At.Equal(now) {
+		t.Fatalf("expected the entry to record who changed what and when, got %+v", canceled)
+	}
+
+	var before, after transfer.Transaction
+	if err := errors.Join(json.Unmarshal(canceled.Before, &before), json.Unmarshal(canceled.After, &after)); err != nil {
+		t.Fatalf("failed to decode states: %v", err)
+	}
+
+	if before.Status != transfer.StatusScheduled || after.Status != transfer.StatusCanceled {
+		t.Fatalf("expected the states before and after the cancellation, got %s and %s", before.Status, after.Status)
+	}
+
+	all, err := log.List(context.Background(), audit.Filter{Action: audit.AccountCreated})
+	if err != nil || len(all) != 2 || all[0].Seq != 1 || all[1].PrevHash != all[0].Hash {
+		t.Fatalf("expected both accounts to be recorded and chained, got %+v, %v", all, err)
+	}
+
+	if v, err := log.Verify(context.Background()); err != nil || v.Entries != 4 {
+		t.Fatalf("expected an intact chain of 4 entries, got %+v, %v", v, err)
+	}
+}
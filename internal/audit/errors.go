@@ -0,0 +1,22 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// ErrBrokenChain is the first entry whose link to the chain does not hold.
+type ErrBrokenChain struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ErrBrokenChain) Error() string {
+	return fmt.Sprintf("audit entry %d: %s", e.Seq, e.Reason)
+}
+
+func (e *ErrBrokenChain) Unwrap() error {
+	return ErrTampered
+}
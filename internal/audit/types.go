@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type Action string
+
+const (
+	AccountCreated    Action = "account.created"
+	TransferCreated   Action = "transfer.created"
+	TransferScheduled Action = "transfer.scheduled"
+	TransferCanceled  Action = "transfer.canceled"
+	TransferExecuted  Action = "transfer.executed"
+	TransferFailed    Action = "transfer.failed"
+)
+
+// Change is a change of state to record, described by the state of what it
+// changed before and after it. Before is nil for creations.
+type Change struct {
+	Action Action
+	// Targets are the ids of the entities the change affects, the one it
+	// is about first.
+	Targets []ulid.ULID
+	Before  any
+	After   any
+}
+
+// Origin is who made a change, and in which request.
+type Origin struct {
+	Actor     string
+	RequestID string
+}
+
+// Record is the payload of the event that records a change in the outbox,
+// together with the change itself. The event becomes an entry once relayed.
+type Record struct {
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	Action    Action          `json:"action"`
+	Targets   []string        `json:"targets"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// Entry is a recorded change. Each entry holds the hash of the one before
+// it, so that altering, removing or reordering entries breaks the chain.
+type Entry struct {
+	// Seq numbers the entries in the order they were appended, from 1.
+	Seq       int64
+	ID        ulid.ULID
+	At        time.Time
+	Actor     string
+	RequestID string
+	Action    Action
+	Targets   []string
+	Before    json.RawMessage
+	After     json.RawMessage
+	// PrevHash is the hash of the previous entry, empty for the first one.
+	PrevHash string
+	Hash     string
+}
+
+// Filter selects entries. Zero fields match every entry.
+type Filter struct {
+	Actor  string
+	Action Action
+	// Target matches the entries affecting the entity with this id.
+	Target string
+	// From and To bound the time of the entries, To excluded.
+	From time.Time
+	To   time.Time
+	// AfterSeq pages through entries, starting after the given one.
+	AfterSeq int64
+	Limit    int
+}
+
+type Storage interface {
+	// AppendEntry stores the entry next builds out of the last entry, nil
+	// when there is none. Appends are serialized, so that every entry links
+	// to the one appended right before it. An entry whose id is stored
+	// already is not appended again.
+	AppendEntry(ctx context.Context, next func(last *Entry) (Entry, error)) error
+	// ListEntries returns the entries matching f in the order they were
+	// appended.
+	ListEntries(ctx context.Context, f Filter) ([]Entry, error)
+}
+
+type Service struct {
+	repo Storage
+}
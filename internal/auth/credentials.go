@@ -0,0 +1,19 @@
+package auth
+
+import "strings"
+
+// SecretOf returns the credentials a request was sent with: the bearer
+// token of its Authorization header, or else its API key header, for
+// clients that cannot set Authorization.
+func SecretOf(authorization, apiKey string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return apiKey
+}
+
+// IsJWT tells a compact JWT, three dot separated segments, from an API key.
+func IsJWT(secret string) bool {
+	return strings.Count(secret, ".") == 2
+}
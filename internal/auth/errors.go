@@ -0,0 +1,10 @@
+package auth
+
+import "errors"
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired bearer token")
+	// ErrNotOwner is returned when an end user acts on an account of
+	// someone else.
+	ErrNotOwner = errors.New("account is not owned by the caller")
+)
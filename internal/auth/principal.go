@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Principal is the authenticated caller of a request: a service holding an
+// API key, or an end user holding a bearer token.
+type Principal struct {
+	// KeyID is the API key of a service, zero for end users.
+	KeyID ulid.ULID
+	// Subject is the end user a token was issued to, empty for services.
+	Subject string
+	Name    string
+	Scopes  []Scope
+}
+
+// Has reports whether the principal was granted scope, directly or through
+// ScopeAdmin.
+func (p *Principal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns reports whether the principal may act on an account of owner.
+// Services act for every account; end users only for their own.
+func (p *Principal) Owns(owner string) bool {
+	return p.Subject == "" || p.Subject == owner
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
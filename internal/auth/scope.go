@@ -0,0 +1,36 @@
+package auth
+
+// Scope is a permission granted to a principal.
+type Scope string
+
+const (
+	ScopeAccountsRead        Scope = "accounts:read"
+	ScopeAccountsWrite       Scope = "accounts:write"
+	ScopeTransfersRead       Scope = "transfers:read"
+	ScopeTransfersWrite      Scope = "transfers:write"
+	ScopeStandingOrdersRead  Scope = "standing-orders:read"
+	ScopeStandingOrdersWrite Scope = "standing-orders:write"
+	ScopeWebhooksRead        Scope = "webhooks:read"
+	ScopeWebhooksWrite       Scope = "webhooks:write"
+	// ScopeAdmin manages API keys and grants every other scope.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists every known scope.
+var Scopes = []Scope{
+	ScopeAccountsRead, ScopeAccountsWrite,
+	ScopeTransfersRead, ScopeTransfersWrite,
+	ScopeStandingOrdersRead, ScopeStandingOrdersWrite,
+	ScopeWebhooksRead, ScopeWebhooksWrite,
+	ScopeAdmin,
+}
+
+// Known reports whether s is a scope of the API.
+func Known(s Scope) bool {
+	for _, k := range Scopes {
+		if k == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/lrweck/clean-api/pkg/jwks"
+)
+
+// tokenLeeway absorbs clock skew between the issuer and the API.
+const tokenLeeway = 30 * time.Second
+
+// KeySet resolves the public keys tokens are signed with.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// TokenVerifier authenticates end users by the JWTs an identity provider
+// issued them.
+type TokenVerifier struct {
+	keys     KeySet
+	issuer   string
+	audience string
+	clock    func() time.Time
+}
+
+// NewTokenVerifier verifies tokens signed by keys. Empty issuer or audience
+// are not checked.
+func NewTokenVerifier(keys KeySet, issuer, audience string, clock func() time.Time) *TokenVerifier {
+
+	if clock == nil {
+		clock = time.Now
+	}
+
+	return &TokenVerifier{keys, issuer, audience, clock}
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// Authenticate returns the principal of a signed token. Its subject is
+// the owner of the accounts the principal may act on. Tokens cannot grant
+// ScopeAdmin, which is reserved for API keys.
+func (v *TokenVerifier) Authenticate(ctx context.Context, token string) (*Principal, error) {
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+		jwt.WithTimeFunc(v.clock),
+	}
+
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	var keyErr error
+	claims := new(tokenClaims)
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		k, err := v.keys.Key(ctx, kid)
+		keyErr = err
+		return k, err
+	}, opts...)
+
+	if keyErr != nil && !errors.Is(keyErr, jwks.ErrKeyNotFound) {
+		return nil, fmt.Errorf("failed to resolve token signing key: %w", keyErr)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	p := &Principal{
+		Subject: claims.Subject,
+		Name:    claims.Name,
+	}
+
+	if p.Name == "" {
+		p.Name = claims.Subject
+	}
+
+	for _, s := range strings.Fields(claims.Scope) {
+		if sc := Scope(s); Known(sc) && sc != ScopeAdmin {
+			p.Scopes = append(p.Scopes, sc)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,133 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/jwks"
+)
+
+type staticKeys map[string]crypto.PublicKey
+
+func (s staticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if k, ok := s[kid]; ok {
+		return k, nil
+	}
+	return nil, jwks.ErrKeyNotFound
+}
+
+func TestTokenVerifier(t *testing.T) {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := staticKeys{"rsa": &rk.PublicKey, "ec": &ek.PublicKey, "ed": edPub}
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	v := auth.NewTokenVerifier(keys, "https://id.example.com", "clean-api", func() time.Time { return now })
+
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   "https://id.example.com",
+			"aud":   "clean-api",
+			"sub":   "user-1",
+			"exp":   now.Add(time.Minute).Unix(),
+			"scope": "accounts:read transfers:write admin",
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any, c jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(method, c)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		return s
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    any
+	}{
+		{"RS256", jwt.SigningMethodRS256, "rsa", rk},
+		{"ES256", jwt.SigningMethodES256, "ec", ek},
+		{"EdDSA", jwt.SigningMethodEdDSA, "ed", edKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Authenticate(context.Background(), sign(tt.method, tt.kid, tt.key, claims(nil)))
+			if err != nil {
+				t.Fatalf("failed to authenticate: %v", err)
+			}
+
+			if p.Subject != "user-1" || !p.Owns("user-1") || p.Owns("user-2") {
+				t.Fatalf("unexpected principal %+v", p)
+			}
+
+			if !p.Has(auth.ScopeTransfersWrite) || p.Has(auth.ScopeAccountsWrite) || p.Has(auth.ScopeAdmin) {
+				t.Fatalf("expected the token scopes but admin, got %v", p.Scopes)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name  string
+		token string
+	}{
+		{"expired", sign(jwt.SigningMethodRS256, "rsa", rk, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }))},
+		{"no expiry", sign(jwt.SigningMethodRS256, "rsa", rk, claims(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{"issuer", sign(jwt.SigningMethodRS256, "rsa", rk, claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))},
+		{"audience", sign(jwt.SigningMethodRS256, "rsa", rk, claims(func(c jwt.MapClaims) { c["aud"] = "other-api" }))},
+		{"no subject", sign(jwt.SigningMethodRS256, "rsa", rk, claims(func(c jwt.MapClaims) { delete(c, "sub") }))},
+		{"unknown key", sign(jwt.SigningMethodRS256, "rotated", rk, claims(nil))},
+		{"wrong key", sign(jwt.SigningMethodES256, "rsa", ek, claims(nil))},
+		{"hmac", sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil))},
+		{"garbage", "a.b.c"},
+	}
+
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Authenticate(context.Background(), tt.token); !errors.Is(err, auth.ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierReportsUnavailableKeys(t *testing.T) {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := keySetFunc(func(context.Context, string) (crypto.PublicKey, error) {
+		return nil, fmt.Errorf("failed to load jwk set: %w", errors.New("connection refused"))
+	})
+
+	tok, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Minute).Unix()}).
+		SignedString(rk)
+
+	_, err := auth.NewTokenVerifier(keys, "", "", nil).Authenticate(context.Background(), tok)
+	if err == nil || errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected an outage of the key source not to be blamed on the token, got %v", err)
+	}
+}
+
+type keySetFunc func(ctx context.Context, kid string) (crypto.PublicKey, error)
+
+func (f keySetFunc) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	return f(ctx, kid)
+}
@@ -0,0 +1,88 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/oklog/ulid/v2"
+)
+
+// New creates an event of the given type with payload encoded as JSON.
+func New(id ulid.ULID, t Type, aggregate ulid.ULID, at time.Time, payload any) (Event, error) {
+
+	bs, err := goccy.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s event payload: %w", t, err)
+	}
+
+	return Event{
+		ID:          id,
+		Type:        t,
+		AggregateID: aggregate,
+		Payload:     bs,
+		OccurredAt:  at,
+	}, nil
+}
+
+func NewRelay(s Storage, p Publisher, clock Clock) *Relay {
+
+	if clock == nil {
+		clock = time.Now
+	}
+
+	return &Relay{s, p, clock}
+}
+
+// Relay publishes up to limit unpublished events in the order they were
+// recorded and marks them as published. It stops at the first failure to
+// preserve ordering; a crash before marking causes events to be published
+// again on the next run.
+func (r *Relay) Relay(ctx context.Context, limit int) (int, error) {
+
+	evs, err := r.repo.GetUnpublished(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve unpublished events: %w", err)
+	}
+
+	var (
+		published []ulid.ULID
+		pubErr    error
+	)
+
+	for _, e := range evs {
+		if err := r.pub.Publish(ctx, e); err != nil {
+			pubErr = fmt.Errorf("failed to publish event %s: %w", e.ID, err)
+			break
+		}
+		published = append(published, e.ID)
+	}
+
+	if len(published) == 0 {
+		return 0, pubErr
+	}
+
+	if err := r.repo.MarkPublished(ctx, published, r.clock()); err != nil {
+		return 0, errors.Join(pubErr, fmt.Errorf("failed to mark events as published: %w", err))
+	}
+
+	return len(published), pubErr
+}
+
+// Lag returns how long the oldest unpublished event has been waiting, zero
+// when the outbox is empty.
+func (r *Relay) Lag(ctx context.Context) (time.Duration, error) {
+
+	evs, err := r.repo.GetUnpublished(ctx, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve unpublished events: %w", err)
+	}
+
+	if len(evs) == 0 {
+		return 0, nil
+	}
+
+	return r.clock().Sub(evs[0].OccurredAt), nil
+}
@@ -0,0 +1,142 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+// recorder publishes events by recording them, failing those in fail.
+type recorder struct {
+	published []ulid.ULID
+	fail      map[ulid.ULID]bool
+}
+
+func (r *recorder) Publish(ctx context.Context, e event.Event) error {
+	if r.fail[e.ID] {
+		return errors.New("broker unavailable")
+	}
+	r.published = append(r.published, e.ID)
+	return nil
+}
+
+// newOutbox returns an outbox holding the events of n new accounts.
+func newOutbox(t *testing.T, n int, clock func() time.Time) (*memorydb.OutboxStorage, []ulid.ULID) {
+	t.Helper()
+	ctx := context.Background()
+
+	accounts := memorydb.NewAccountStorage()
+	svc := account.NewService(accounts, account.Options{Clock: clock})
+
+	for i := 0; i < n; i++ {
+		if _, err := svc.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(1)}); err != nil {
+			t.Fatalf("failed to create account: %v", err)
+		}
+	}
+
+	outbox := memorydb.NewOutboxStorage(accounts)
+
+	evs, err := outbox.GetUnpublished(ctx, 0)
+	if err != nil {
+		t.Fatalf("failed to read outbox: %v", err)
+	}
+
+	ids := make([]ulid.ULID, len(evs))
+	for i, e := range evs {
+		ids[i] = e.ID
+	}
+
+	return outbox, ids
+}
+
+func equal(a, b []ulid.ULID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	ctx := context.Background()
+	outbox, ids := newOutbox(t, 3, nil)
+	pub := &recorder{}
+	relay := event.NewRelay(outbox, pub, nil)
+
+	if n, err := relay.Relay(ctx, 2); n != 2 || err != nil {
+		t.Fatalf("expected the limit to be respected, got %d: %v", n, err)
+	}
+
+	if n, err := relay.Relay(ctx, 100); n != len(ids)-2 || err != nil {
+		t.Fatalf("expected the remaining events to be published, got %d: %v", n, err)
+	}
+
+	if !equal(pub.published, ids) {
+		t.Fatalf("expected events to be published in the order they were recorded, got %v, want %v", pub.published, ids)
+	}
+
+	if n, err := relay.Relay(ctx, 100); n != 0 || err != nil {
+		t.Fatalf("expected published events not to be published again, got %d: %v", n, err)
+	}
+}
+
+func TestRelayStopsAtTheFirstFailure(t *testing.T) {
+	ctx := context.Background()
+	outbox, ids := newOutbox(t, 2, nil)
+	pub := &recorder{fail: map[ulid.ULID]bool{ids[1]: true}}
+	relay := event.NewRelay(outbox, pub, nil)
+
+	n, err := relay.Relay(ctx, 100)
+	if n != 1 || err == nil {
+		t.Fatalf("expected the relay to stop at the failing event, got %d: %v", n, err)
+	}
+
+	if !equal(pub.published, ids[:1]) {
+		t.Fatalf("expected no event after the failing one to be published, got %v", pub.published)
+	}
+
+	pending, _ := outbox.GetUnpublished(ctx, 0)
+	if len(pending) != len(ids)-1 || pending[0].ID != ids[1] {
+		t.Fatalf("expected the failing event and the ones after it to stay in the outbox, got %d events", len(pending))
+	}
+
+	pub.fail = nil
+	if n, err := relay.Relay(ctx, 100); n != len(ids)-1 || err != nil {
+		t.Fatalf("expected the unpublished events to be delivered again, got %d: %v", n, err)
+	}
+
+	if !equal(pub.published, ids) {
+		t.Fatalf("expected redelivery to keep the order, got %v, want %v", pub.published, ids)
+	}
+}
+
+func TestRelayLag(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	outbox, _ := newOutbox(t, 1, clock)
+	relay := event.NewRelay(outbox, &recorder{}, clock)
+
+	now = now.Add(time.Minute)
+	if lag, err := relay.Lag(ctx); lag != time.Minute || err != nil {
+		t.Fatalf("expected a lag of 1m, got %s: %v", lag, err)
+	}
+
+	relay.Relay(ctx, 100)
+	if lag, err := relay.Lag(ctx); lag != 0 || err != nil {
+		t.Fatalf("expected no lag once published, got %s: %v", lag, err)
+	}
+}
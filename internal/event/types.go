@@ -0,0 +1,76 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+)
+
+type Type string
+
+const (
+	AccountCreated    Type = "account.created"
+	TransferCompleted Type = "transfer.completed"
+	TransferFailed    Type = "transfer.failed"
+
+	// AuditRecorded carries an audit.Record, see the audit package.
+	AuditRecorded Type = "audit.recorded"
+)
+
+// Event is a domain event recorded in the outbox together with the state
+// change that caused it. Payload holds the JSON encoded payload of its type.
+type Event struct {
+	ID          ulid.ULID
+	Type        Type
+	AggregateID ulid.ULID
+	Payload     []byte
+	OccurredAt  time.Time
+}
+
+type AccountCreatedPayload struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Document  string          `json:"document"`
+	Balance   decimal.Decimal `json:"balance"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type TransferPayload struct {
+	ID              string          `json:"id"`
+	From            string          `json:"from"`
+	To              string          `json:"to,omitempty"`
+	Legs            []TransferLeg   `json:"legs,omitempty"`
+	Amount          decimal.Decimal `json:"amount"`
+	Status          string          `json:"status"`
+	FailureReason   string          `json:"failure_reason,omitempty"`
+	StandingOrderID string          `json:"standing_order_id,omitempty"`
+	Occurrence      int             `json:"occurrence,omitempty"`
+	ProcessedAt     time.Time       `json:"processed_at"`
+}
+
+type TransferLeg struct {
+	To     string          `json:"to"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// Storage is the outbox the relay reads events from.
+type Storage interface {
+	GetUnpublished(ctx context.Context, limit int) ([]Event, error)
+	MarkPublished(ctx context.Context, ids []ulid.ULID, at time.Time) error
+}
+
+// Publisher delivers events to downstream consumers. Delivery is at least
+// once, so consumers must tolerate duplicates, e.g. by event ID.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+type Relay struct {
+	repo  Storage
+	pub   Publisher
+	clock Clock
+}
+
+type Clock func() time.Time
@@ -0,0 +1,38 @@
+package standingorder
+
+import "errors"
+
+var (
+	ErrNotFound           = errors.New("standing order not found")
+	ErrNotActive          = errors.New("standing order is not active")
+	ErrOccurrenceExecuted = errors.New("standing order occurrence already executed")
+
+	ErrInvalidFrequency   = errors.New("frequency must be one of daily, weekly or monthly")
+	ErrInvalidOccurrences = errors.New("occurrences must not be negative")
+	ErrEndBeforeStart     = errors.New("end date must not be before the start date")
+	ErrStartInPast        = errors.New("start date must not be in the past")
+)
+
+type ErrValidation struct {
+	errs []error
+}
+
+func (e *ErrValidation) Error() string {
+	return "validation error"
+}
+
+func (e *ErrValidation) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ErrValidation) Errors() []string {
+	if e == nil {
+		return nil
+	}
+
+	errs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err.Error()
+	}
+	return errs
+}
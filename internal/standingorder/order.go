@@ -0,0 +1,174 @@
+package standingorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+func NewService(s Storage, opts Options) *Service {
+
+	if opts.IDGen == nil {
+		opts.IDGen = ulid.Make
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	return &Service{s, opts.IDGen, opts.Clock}
+}
+
+func (s *Service) New(ctx context.Context, n NewOrder) (ulid.ULID, error) {
+
+	now := s.clock()
+
+	if n.StartAt.IsZero() {
+		n.StartAt = now
+	} else if n.StartAt.Before(now) {
+		return ulid.ULID{}, &ErrValidation{[]error{ErrStartInPast}}
+	}
+
+	if err := n.validate(); err != nil {
+		return ulid.ULID{}, fmt.Errorf("invalid standing order: %w", err)
+	}
+
+	id := s.idGen()
+	o := Order{
+		ID:             id,
+		From:           n.From,
+		To:             n.To,
+		Amount:         n.Amount,
+		Frequency:      n.Frequency,
+		StartAt:        n.StartAt,
+		EndAt:          n.EndAt,
+		MaxOccurrences: n.MaxOccurrences,
+		Status:         StatusActive,
+		CreatedAt:      now,
+		NextRunAt:      n.StartAt,
+	}
+
+	if err := s.repo.CreateOrder(ctx, o); err != nil {
+		return ulid.ULID{}, fmt.Errorf("failed to create standing order: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *Service) Retrieve(ctx context.Context, id ulid.ULID) (*Order, error) {
+
+	o, err := s.repo.GetOrder(ctx, id)
+
+	return o, errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to retrieve standing order %s", id))
+}
+
+// Cancel stops an active standing order from generating new transfers.
+func (s *Service) Cancel(ctx context.Context, id ulid.ULID) error {
+
+	err := s.repo.CancelOrder(ctx, id, s.clock())
+
+	return errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to cancel standing order %s", id))
+}
+
+// ExecuteDue generates the next transfer of up to limit standing orders
+// whose next occurrence is due. Orders behind schedule catch up one
+// occurrence per call. An occurrence that fails for business reasons is
+// recorded as a failed transfer and the order moves on to the next one.
+// Orders canceled after being picked up are skipped.
+func (s *Service) ExecuteDue(ctx context.Context, limit int) (int, error) {
+
+	due, err := s.repo.GetDueOrders(ctx, s.clock(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve due standing orders: %w", err)
+	}
+
+	var (
+		executed int
+		errs     []error
+	)
+
+	for _, o := range due {
+		ok, err := s.executeNext(ctx, o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to execute standing order %s: %w", o.ID, err))
+			continue
+		}
+		if ok {
+			executed++
+		}
+	}
+
+	return executed, errors.Join(errs...)
+}
+
+// executeNext records the next occurrence of o. It reports false, without an
+// error, when there was nothing left to record.
+func (s *Service) executeNext(ctx context.Context, o Order) (bool, error) {
+
+	now := s.clock()
+	n := o.Executed + 1
+
+	occ := Occurrence{
+		OrderID: o.ID,
+		Number:  n,
+		Tx: transfer.Transaction{
+			ID:              s.idGen(),
+			From:            o.From,
+			To:              o.To,
+			Amount:          o.Amount,
+			Status:          transfer.StatusCompleted,
+			CreatedAt:       now,
+			ExecuteAt:       o.NextRunAt,
+			ProcessedAt:     now,
+			StandingOrderID: o.ID,
+			Occurrence:      n,
+		},
+		NextRunAt: o.runAt(n + 1),
+		Finished:  o.isLast(n),
+	}
+
+	err := s.execute(ctx, occ)
+	if transfer.IsExecutionFailure(err) {
+		occ.Tx.Status = transfer.StatusFailed
+		occ.Tx.FailureReason = err.Error()
+		err = s.execute(ctx, occ)
+	}
+
+	if errors.Is(err, ErrOccurrenceExecuted) || errors.Is(err, ErrNotActive) {
+		// executed by a previous or concurrent run, or canceled meanwhile
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *Service) execute(ctx context.Context, occ Occurrence) error {
+
+	ev, err := transfer.NewEvent(s.idGen(), occ.Tx)
+	if err != nil {
+		return err
+	}
+
+	action := audit.TransferExecuted
+	if occ.Tx.Status == transfer.StatusFailed {
+		action = audit.TransferFailed
+	}
+
+	auditEv, err := audit.NewEvent(s.idGen(), occ.Tx.ProcessedAt, audit.OriginOf(ctx), audit.Change{
+		Action:  action,
+		Targets: append(occ.Tx.AuditTargets(), occ.OrderID),
+		After:   occ.Tx,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.repo.ExecuteOccurrence(ctx, occ, ev, auditEv)
+}
@@ -0,0 +1,208 @@
+package standingorder_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+type fixture struct {
+	accounts *account.Service
+	orders   *standingorder.Service
+	storage  *memorydb.StandingOrderStorage
+	now      time.Time
+
+	from, to ulid.ULID
+}
+
+func newFixture(t *testing.T, now time.Time) *fixture {
+	f := &fixture{now: now}
+	clock := func() time.Time { return f.now }
+
+	accounts := memorydb.NewAccountStorage()
+	f.storage = memorydb.NewStandingOrderStorage(memorydb.NewTxStorage(accounts))
+	f.accounts = account.NewService(accounts, account.Options{Clock: clock})
+	f.orders = standingorder.NewService(f.storage, standingorder.Options{Clock: clock})
+
+	ctx := context.Background()
+
+	var err error
+	if f.from, err = f.accounts.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(100)}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if f.to, err = f.accounts.New(ctx, account.NewAccount{Name: "Bob", Document: "98765432100"}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	return f
+}
+
+func (f *fixture) order(t *testing.T, n standingorder.NewOrder) ulid.ULID {
+	t.Helper()
+
+	n.From, n.To = f.from, f.to
+	if n.Amount.IsZero() {
+		n.Amount = decimal.NewFromInt(10)
+	}
+
+	id, err := f.orders.New(context.Background(), n)
+	if err != nil {
+		t.Fatalf("failed to create standing order: %v", err)
+	}
+	return id
+}
+
+func (f *fixture) retrieve(t *testing.T, id ulid.ULID) *standingorder.Order {
+	t.Helper()
+
+	o, err := f.orders.Retrieve(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to retrieve standing order: %v", err)
+	}
+	return o
+}
+
+func (f *fixture) balance(t *testing.T, id ulid.ULID) decimal.Decimal {
+	t.Helper()
+
+	acc, err := f.accounts.Retrieve(context.Background(), id.String())
+	if err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	return acc.Balance
+}
+
+func TestExecuteDueExecutesOccurrencesOnce(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC))
+	id := f.order(t, standingorder.NewOrder{Frequency: standingorder.Daily})
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		executed int
+	)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			n, err := f.orders.ExecuteDue(ctx, 10)
+			if err != nil {
+				t.Errorf("failed to execute due standing orders: %v", err)
+			}
+
+			mu.Lock()
+			executed += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if executed != 1 {
+		t.Fatalf("expected the occurrence to be executed once, got %d", executed)
+	}
+
+	if o := f.retrieve(t, id); o.Executed != 1 || !o.NextRunAt.Equal(f.now.AddDate(0, 0, 1)) {
+		t.Fatalf("expected the order to move on to tomorrow, got %d executed, next at %s", o.Executed, o.NextRunAt)
+	}
+
+	if !f.balance(t, f.from).Equal(decimal.NewFromInt(90)) {
+		t.Fatalf("expected the funds to be moved once, got %s", f.balance(t, f.from))
+	}
+}
+
+func TestExecuteDueClampsMonthEnds(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC))
+	id := f.order(t, standingorder.NewOrder{Frequency: standingorder.Monthly})
+
+	want := []time.Time{
+		time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC),
+	}
+
+	for _, next := range want {
+		if _, err := f.orders.ExecuteDue(ctx, 10); err != nil {
+			t.Fatalf("failed to execute due standing orders: %v", err)
+		}
+
+		if o := f.retrieve(t, id); !o.NextRunAt.Equal(next) {
+			t.Fatalf("expected the next occurrence at %s, got %s", next, o.NextRunAt)
+		}
+
+		f.now = next
+	}
+}
+
+func TestExecuteDueFinishesAfterTheLastOccurrence(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC))
+
+	byCount := f.order(t, standingorder.NewOrder{Frequency: standingorder.Weekly, MaxOccurrences: 2})
+	byDate := f.order(t, standingorder.NewOrder{Frequency: standingorder.Weekly, EndAt: f.now.AddDate(0, 0, 10)})
+
+	for week := 0; week < 4; week++ {
+		if _, err := f.orders.ExecuteDue(ctx, 10); err != nil {
+			t.Fatalf("failed to execute due standing orders: %v", err)
+		}
+		f.now = f.now.AddDate(0, 0, 7)
+	}
+
+	for _, id := range []ulid.ULID{byCount, byDate} {
+		if o := f.retrieve(t, id); o.Status != standingorder.StatusFinished || o.Executed != 2 {
+			t.Errorf("expected the order to finish after 2 occurrences, got %s after %d", o.Status, o.Executed)
+		}
+	}
+
+	if !f.balance(t, f.from).Equal(decimal.NewFromInt(60)) {
+		t.Fatalf("expected 4 occurrences to be paid, got balance %s", f.balance(t, f.from))
+	}
+}
+
+// canceling cancels every order it returns as due, as if they were canceled
+// while being executed.
+type canceling struct {
+	*memorydb.StandingOrderStorage
+}
+
+func (s canceling) GetDueOrders(ctx context.Context, until time.Time, limit int) ([]standingorder.Order, error) {
+	due, err := s.StandingOrderStorage.GetDueOrders(ctx, until, limit)
+	for _, o := range due {
+		if err := s.CancelOrder(ctx, o.ID, until); err != nil {
+			return nil, err
+		}
+	}
+	return due, err
+}
+
+func TestExecuteDueSkipsCanceledOrders(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC))
+	id := f.order(t, standingorder.NewOrder{Frequency: standingorder.Daily})
+
+	orders := standingorder.NewService(canceling{f.storage}, standingorder.Options{Clock: func() time.Time { return f.now }})
+
+	if n, err := orders.ExecuteDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("expected the canceled order to be skipped, got %d: %v", n, err)
+	}
+
+	if err := f.orders.Cancel(ctx, id); !errors.Is(err, standingorder.ErrNotActive) {
+		t.Fatalf("expected canceling again to fail with ErrNotActive, got %v", err)
+	}
+
+	if !f.balance(t, f.from).Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected no funds to be moved, got %s", f.balance(t, f.from))
+	}
+}
@@ -0,0 +1,169 @@
+package standingorder
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+type Storage interface {
+	CreateOrder(ctx context.Context, o Order) error
+	GetOrder(ctx context.Context, id ulid.ULID) (*Order, error)
+	CancelOrder(ctx context.Context, id ulid.ULID, at time.Time) error
+	GetDueOrders(ctx context.Context, until time.Time, limit int) ([]Order, error)
+
+	// ExecuteOccurrence atomically records the occurrence transfer and evs,
+	// moves the funds when the transfer is completed, and advances the order.
+	// It must return ErrOccurrenceExecuted if the occurrence was already
+	// recorded.
+	ExecuteOccurrence(ctx context.Context, occ Occurrence, evs ...event.Event) error
+}
+
+type Frequency string
+
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+)
+
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusFinished Status = "finished"
+	StatusCanceled Status = "canceled"
+)
+
+type NewOrder struct {
+	From      ulid.ULID
+	To        ulid.ULID
+	Amount    decimal.Decimal
+	Frequency Frequency
+
+	// StartAt is the date of the first occurrence. The zero value means now.
+	StartAt time.Time
+
+	// EndAt and MaxOccurrences are optional limits; an order without any of
+	// them runs until canceled.
+	EndAt          time.Time
+	MaxOccurrences int
+}
+
+func (n NewOrder) validate() error {
+	var errs []error
+
+	if n.From == n.To {
+		errs = append(errs, transfer.ErrSameAccount)
+	}
+
+	if !n.Amount.GreaterThan(decimal.Zero) {
+		errs = append(errs, transfer.ErrInvalidAmount)
+	}
+
+	switch n.Frequency {
+	case Daily, Weekly, Monthly:
+	default:
+		errs = append(errs, ErrInvalidFrequency)
+	}
+
+	if n.MaxOccurrences < 0 {
+		errs = append(errs, ErrInvalidOccurrences)
+	}
+
+	if !n.EndAt.IsZero() && n.EndAt.Before(n.StartAt) {
+		errs = append(errs, ErrEndBeforeStart)
+	}
+
+	if len(errs) > 0 {
+		return &ErrValidation{errs}
+	}
+
+	return nil
+}
+
+type Order struct {
+	ID             ulid.ULID
+	From           ulid.ULID
+	To             ulid.ULID
+	Amount         decimal.Decimal
+	Frequency      Frequency
+	StartAt        time.Time
+	EndAt          time.Time
+	MaxOccurrences int
+	Status         Status
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	// Executed is the number of occurrences already generated, and
+	// NextRunAt the date of the next one.
+	Executed  int
+	NextRunAt time.Time
+}
+
+// runAt returns the date of the nth occurrence, starting at 1. Dates are
+// always derived from StartAt so that monthly orders do not drift.
+func (o Order) runAt(n int) time.Time {
+	switch o.Frequency {
+	case Daily:
+		return o.StartAt.AddDate(0, 0, n-1)
+	case Weekly:
+		return o.StartAt.AddDate(0, 0, 7*(n-1))
+	default:
+		return addMonthsClamped(o.StartAt, n-1)
+	}
+}
+
+// isLast reports whether the nth occurrence is the last one of the order.
+func (o Order) isLast(n int) bool {
+	if o.MaxOccurrences > 0 && n >= o.MaxOccurrences {
+		return true
+	}
+	return !o.EndAt.IsZero() && o.runAt(n+1).After(o.EndAt)
+}
+
+// addMonthsClamped adds months to t, clamping the day to the last day of
+// the resulting month instead of overflowing into the next one.
+func addMonthsClamped(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+
+	return first.AddDate(0, 0, d-1)
+}
+
+// Occurrence is a single execution of a standing order.
+type Occurrence struct {
+	OrderID ulid.ULID
+	Number  int
+	Tx      transfer.Transaction
+
+	NextRunAt time.Time
+	Finished  bool
+}
+
+type Service struct {
+	repo  Storage
+	idGen IDGen
+	clock Clock
+}
+
+type (
+	IDGen func() ulid.ULID
+	Clock func() time.Time
+)
+
+// Options customizes a Service. Zero fields fall back to ulid.Make and
+// time.Now.
+type Options struct {
+	IDGen IDGen
+	Clock Clock
+}
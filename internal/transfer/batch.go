@@ -0,0 +1,142 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/pkg/telemetry"
+)
+
+// NewBatch creates several immediate transfers at once, either atomically or
+// independently depending on mode. In independent mode the returned error is
+// only set when the batch itself is invalid; failures of single transfers
+// are reported in their results.
+func (s *Service) NewBatch(ctx context.Context, txs []NewTx, mode BatchMode) (_ []BatchResult, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.NewBatch", trace.WithAttributes(
+		attribute.String("transfer.batch.mode", string(mode)),
+		attribute.Int("transfer.batch.size", len(txs)),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	switch {
+	case len(txs) == 0:
+		return nil, ErrEmptyBatch
+	case len(txs) > MaxBatchSize:
+		return nil, ErrBatchTooLarge
+	}
+
+	switch mode {
+	case BatchAtomic:
+		return s.newAtomicBatch(ctx, txs)
+	case BatchIndependent:
+		return s.newIndependentBatch(ctx, txs), nil
+	default:
+		return nil, ErrInvalidBatchMode
+	}
+}
+
+type fallbackKey struct{}
+
+// ContextWithFallback returns a copy of ctx for callers that create the
+// transfers of a failed atomic batch independently, so that only the
+// offending ones fail. The failures they fall back on are then left to the
+// independent batch to record in metrics, and not counted twice.
+func ContextWithFallback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fallbackKey{}, true)
+}
+
+// fallsBack reports whether the caller of an atomic batch that failed with
+// err creates its transfers independently instead.
+func fallsBack(ctx context.Context, err error) bool {
+	if ok, _ := ctx.Value(fallbackKey{}).(bool); !ok {
+		return false
+	}
+	item := new(ErrBatchItem)
+	return errors.As(err, &item) || IsExecutionFailure(err)
+}
+
+func (s *Service) newAtomicBatch(ctx context.Context, txs []NewTx) (_ []BatchResult, err error) {
+	defer func() {
+		if err != nil && !fallsBack(ctx, err) {
+			s.metrics.recordFailed(ctx, len(txs), false, err)
+		}
+	}()
+
+	now := s.clock()
+
+	ts := make([]Transaction, len(txs))
+	evs := make([]event.Event, 0, 2*len(txs))
+	results := make([]BatchResult, len(txs))
+
+	for i, tx := range txs {
+		if err := validateBatchItem(tx); err != nil {
+			return nil, &ErrBatchItem{i, err}
+		}
+
+		id := s.idGen()
+		ts[i] = Transaction{
+			ID:          id,
+			From:        tx.From,
+			To:          tx.To,
+			Amount:      tx.Amount,
+			Status:      StatusCompleted,
+			CreatedAt:   now,
+			ProcessedAt: now,
+			Legs:        tx.Legs,
+		}
+		results[i] = BatchResult{ID: id}
+
+		ev, err := NewEvent(s.idGen(), ts[i])
+		if err != nil {
+			return nil, err
+		}
+
+		auditEv, err := s.auditEvent(originOf(ctx, tx), now, audit.TransferCreated, nil, ts[i])
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, ev, auditEv)
+	}
+
+	if err := s.retry(ctx, "CreateTxBatch", func() error { return s.repo.CreateTxBatch(ctx, ts, evs...) }); err != nil {
+		return nil, fmt.Errorf("failed to create transfer batch: %w", err)
+	}
+
+	s.metrics.recordCreated(ctx, len(ts), false)
+	for _, t := range ts {
+		s.metrics.recordMoved(ctx, t.Amount)
+	}
+
+	return results, nil
+}
+
+func (s *Service) newIndependentBatch(ctx context.Context, txs []NewTx) []BatchResult {
+
+	results := make([]BatchResult, len(txs))
+
+	for i, tx := range txs {
+		if err := validateBatchItem(tx); err != nil {
+			s.metrics.recordFailed(ctx, 1, false, err)
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+
+		id, err := s.New(ctx, tx)
+		results[i] = BatchResult{ID: id, Err: err}
+	}
+
+	return results
+}
+
+func validateBatchItem(tx NewTx) error {
+	if !tx.ExecuteAt.IsZero() {
+		return ErrScheduledInBatch
+	}
+	return tx.validate()
+}
@@ -0,0 +1,161 @@
+package transfer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+func move(from, to ulid.ULID, amount int64) transfer.NewTx {
+	return transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(amount)}
+}
+
+func TestNewBatchRejectsInvalidBatches(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	a, b := s.account(t, 100), s.account(t, 0)
+
+	tests := []struct {
+		name string
+		txs  []transfer.NewTx
+		mode transfer.BatchMode
+		err  error
+	}{
+		{"empty", nil, transfer.BatchAtomic, transfer.ErrEmptyBatch},
+		{"too large", make([]transfer.NewTx, transfer.MaxBatchSize+1), transfer.BatchIndependent, transfer.ErrBatchTooLarge},
+		{"unknown mode", []transfer.NewTx{move(a, b, 1)}, "eventual", transfer.ErrInvalidBatchMode},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.txs.NewBatch(ctx, tt.txs, tt.mode); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+
+	full := make([]transfer.NewTx, transfer.MaxBatchSize)
+	for i := range full {
+		full[i] = move(a, b, 0)
+	}
+
+	if _, err := s.txs.NewBatch(ctx, full, transfer.BatchAtomic); err != nil {
+		t.Fatalf("expected a batch of %d transfers to be accepted, got %v", transfer.MaxBatchSize, err)
+	}
+}
+
+func TestAtomicBatchRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	a, b, c := s.account(t, 100), s.account(t, 0), s.account(t, 0)
+
+	_, err := s.txs.NewBatch(ctx, []transfer.NewTx{move(a, b, 10), move(a, a, 10)}, transfer.BatchAtomic)
+
+	var item *transfer.ErrBatchItem
+	if !errors.As(err, &item) || item.Index != 1 || !errors.Is(err, transfer.ErrSameAccount) {
+		t.Fatalf("expected the second item to be rejected, got %v", err)
+	}
+
+	_, err = s.txs.NewBatch(ctx, []transfer.NewTx{move(a, b, 60), move(a, c, 60)}, transfer.BatchAtomic)
+	if !errors.Is(err, transfer.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+
+	if !s.balance(t, a).Equal(decimal.NewFromInt(100)) || !s.balance(t, b).IsZero() || !s.balance(t, c).IsZero() {
+		t.Fatalf("expected no funds to be moved, got %s, %s and %s", s.balance(t, a), s.balance(t, b), s.balance(t, c))
+	}
+}
+
+func TestIndependentBatchReportsEachTransfer(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	a, b, c := s.account(t, 100), s.account(t, 0), s.account(t, 0)
+
+	results, err := s.txs.NewBatch(ctx, []transfer.NewTx{move(a, b, 60), move(a, a, 10), move(a, c, 60)}, transfer.BatchIndependent)
+	if err != nil {
+		t.Fatalf("failed to create batch: %v", err)
+	}
+
+	if results[0].Err != nil || results[0].ID == (ulid.ULID{}) {
+		t.Errorf("expected the first transfer to succeed, got %v", results[0].Err)
+	}
+
+	if !errors.Is(results[1].Err, transfer.ErrSameAccount) {
+		t.Errorf("expected the second transfer to be rejected, got %v", results[1].Err)
+	}
+
+	if !errors.Is(results[2].Err, transfer.ErrInsufficientFunds) {
+		t.Errorf("expected the third transfer to lack funds, got %v", results[2].Err)
+	}
+
+	if !s.balance(t, a).Equal(decimal.NewFromInt(40)) || !s.balance(t, b).Equal(decimal.NewFromInt(60)) {
+		t.Fatalf("expected only the first transfer to move funds, got %s and %s", s.balance(t, a), s.balance(t, b))
+	}
+}
+
+func TestAtomicBatchChecksEachTransferInOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	a, b, c := s.account(t, 10), s.account(t, 0), s.account(t, 0)
+
+	// b and c only have funds to send once a has paid b
+	cycle := []transfer.NewTx{move(b, c, 10), move(c, a, 10), move(a, b, 10)}
+
+	if _, err := s.txs.NewBatch(ctx, cycle, transfer.BatchAtomic); !errors.Is(err, transfer.ErrInsufficientFunds) {
+		t.Fatalf("expected a transfer not to spend funds credited by a later one, got %v", err)
+	}
+
+	if !s.balance(t, a).Equal(decimal.NewFromInt(10)) || !s.balance(t, b).IsZero() || !s.balance(t, c).IsZero() {
+		t.Fatalf("expected no funds to be moved, got %s, %s and %s", s.balance(t, a), s.balance(t, b), s.balance(t, c))
+	}
+
+	chain := []transfer.NewTx{move(a, b, 10), move(b, c, 10), move(c, a, 10)}
+
+	if _, err := s.txs.NewBatch(ctx, chain, transfer.BatchAtomic); err != nil {
+		t.Fatalf("expected a transfer to spend funds credited by an earlier one, got %v", err)
+	}
+
+	if !s.balance(t, a).Equal(decimal.NewFromInt(10)) || !s.balance(t, b).IsZero() || !s.balance(t, c).IsZero() {
+		t.Fatalf("expected the chain to leave balances as they were, got %s, %s and %s", s.balance(t, a), s.balance(t, b), s.balance(t, c))
+	}
+}
+
+func TestOpposingBatchesDoNotDeadlock(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	a, b := s.account(t, 1000), s.account(t, 1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.txs.NewBatch(ctx, []transfer.NewTx{move(a, b, 1), move(b, a, 2)}, transfer.BatchAtomic)
+		}()
+		go func() {
+			defer wg.Done()
+			s.txs.NewBatch(ctx, []transfer.NewTx{move(b, a, 1), move(a, b, 2)}, transfer.BatchAtomic)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected batches locking the same accounts in opposite order to finish")
+	}
+
+	if total := s.balance(t, a).Add(s.balance(t, b)); !total.Equal(decimal.NewFromInt(2000)) {
+		t.Fatalf("expected funds to be conserved, got %s", total)
+	}
+}
@@ -10,10 +10,27 @@ import (
 )
 
 var (
-	ErrInvalidAmount = errors.New("amount must be greater than zero")
-	ErrSameAccount   = errors.New("cannot transfer to the same account")
+	ErrInvalidAmount   = errors.New("amount must be greater than zero")
+	ErrSameAccount     = errors.New("cannot transfer to the same account")
+	ErrExecuteAtInPast = errors.New("execution date must be in the future")
+	ErrNotFound        = errors.New("transfer not found")
+	ErrNotScheduled    = errors.New("transfer is not scheduled")
+
+	ErrLegsWithDestination = errors.New("a multi-leg transfer must not have a single destination")
+	ErrTooManyLegs         = fmt.Errorf("a transfer must not have more than %d legs", MaxLegs)
+	ErrDuplicateLeg        = errors.New("a transfer must not credit the same account in several legs")
+	ErrUnbalancedLegs      = errors.New("the amounts of the legs must add up to the transfer amount")
+
+	ErrInvalidBatchMode = errors.New("batch mode must be either atomic or independent")
+	ErrEmptyBatch       = errors.New("batch must contain at least one transfer")
+	ErrBatchTooLarge    = fmt.Errorf("batch must not contain more than %d transfers", MaxBatchSize)
+	ErrScheduledInBatch = errors.New("batch transfers cannot be scheduled")
 
 	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrConflict is returned by storages when a transaction was aborted by
+	// a concurrent one, such as on a deadlock, and may succeed if retried.
+	ErrConflict = errors.New("transaction conflicted with a concurrent one")
 )
 
 type ErrAccountNotFound struct {
@@ -35,3 +52,23 @@ func (e *ErrAccountNotFound) Error() string {
 func (e *ErrAccountNotFound) Unwrap() error {
 	return account.ErrNotFound
 }
+
+// ErrBatchItem identifies the transfer of a batch that caused it to fail.
+type ErrBatchItem struct {
+	Index int
+	Err   error
+}
+
+func (e *ErrBatchItem) Error() string {
+	return fmt.Sprintf("batch item %d: %s", e.Index, e.Err)
+}
+
+func (e *ErrBatchItem) Unwrap() error {
+	return e.Err
+}
+
+// IsExecutionFailure reports whether err is a business failure that
+// should be recorded on a scheduled transfer instead of retried.
+func IsExecutionFailure(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds) || errors.Is(err, account.ErrNotFound)
+}
@@ -0,0 +1,44 @@
+package transfer
+
+import (
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+// NewEvent creates the event announcing that t reached its final status,
+// either completed or failed.
+func NewEvent(id ulid.ULID, t Transaction) (event.Event, error) {
+
+	typ := event.TransferCompleted
+	if t.Status == StatusFailed {
+		typ = event.TransferFailed
+	}
+
+	payload := event.TransferPayload{
+		ID:            t.ID.String(),
+		From:          t.From.String(),
+		Amount:        t.Amount,
+		Status:        string(t.Status),
+		FailureReason: t.FailureReason,
+		Occurrence:    t.Occurrence,
+		ProcessedAt:   t.ProcessedAt,
+	}
+
+	if len(t.Legs) == 0 {
+		payload.To = t.To.String()
+	}
+
+	for _, leg := range t.Legs {
+		payload.Legs = append(payload.Legs, event.TransferLeg{
+			To:     leg.To.String(),
+			Amount: leg.Amount,
+		})
+	}
+
+	if t.StandingOrderID != (ulid.ULID{}) {
+		payload.StandingOrderID = t.StandingOrderID.String()
+	}
+
+	return event.New(id, typ, t.ID, t.ProcessedAt, payload)
+}
@@ -0,0 +1,113 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/lrweck/clean-api/internal/account"
+)
+
+// metrics are the business metrics of money movement. The insufficient
+// funds rate is the share of transfers.failed with error.kind
+// insufficient_funds among transfers.created and transfers.failed.
+type metrics struct {
+	created metric.Int64Counter
+	failed  metric.Int64Counter
+	amount  metric.Float64Histogram
+	retries metric.Int64Counter
+
+	currency attribute.KeyValue
+}
+
+func newMetrics(meter metric.Meter, currency string) metrics {
+	if meter == nil {
+		meter = otel.Meter("github.com/lrweck/clean-api/internal/transfer")
+	}
+
+	created, err := meter.Int64Counter("transfers.created",
+		metric.WithUnit("1"),
+		metric.WithDescription("transfers completed or scheduled"))
+	if err != nil {
+		panic(err)
+	}
+
+	failed, err := meter.Int64Counter("transfers.failed",
+		metric.WithUnit("1"),
+		metric.WithDescription("transfers rejected or failed, by error kind"))
+	if err != nil {
+		panic(err)
+	}
+
+	amount, err := meter.Float64Histogram("transfers.amount",
+		metric.WithUnit("1"),
+		metric.WithDescription("amounts moved between accounts, by currency"))
+	if err != nil {
+		panic(err)
+	}
+
+	retries, err := meter.Int64Counter("db.tx.retries",
+		metric.WithUnit("1"),
+		metric.WithDescription("storage transactions retried after conflicting with a concurrent one"))
+	if err != nil {
+		panic(err)
+	}
+
+	return metrics{created, failed, amount, retries, attribute.String("transfer.currency", currency)}
+}
+
+func (m metrics) recordCreated(ctx context.Context, n int, scheduled bool) {
+	m.created.Add(ctx, int64(n), metric.WithAttributes(attribute.Bool("transfer.scheduled", scheduled)))
+}
+
+func (m metrics) recordFailed(ctx context.Context, n int, scheduled bool, err error) {
+	m.failed.Add(ctx, int64(n), metric.WithAttributes(
+		attribute.Bool("transfer.scheduled", scheduled),
+		attribute.String("error.kind", errorKind(err)),
+	))
+}
+
+// recordMoved records the amount of a transfer whose funds were moved, by
+// currency.
+func (m metrics) recordMoved(ctx context.Context, amount decimal.Decimal) {
+	m.amount.Record(ctx, amount.InexactFloat64(), metric.WithAttributes(m.currency))
+}
+
+// invalidErrs are returned for transfers rejected before reaching storage.
+var invalidErrs = []error{
+	ErrInvalidAmount,
+	ErrSameAccount,
+	ErrExecuteAtInPast,
+	ErrLegsWithDestination,
+	ErrTooManyLegs,
+	ErrDuplicateLeg,
+	ErrUnbalancedLegs,
+	ErrScheduledInBatch,
+}
+
+// errorKind classifies err with a small, fixed set of values fit to be an
+// attribute of metrics.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, account.ErrNotFound):
+		return "account_not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+
+	for _, invalid := range invalidErrs {
+		if errors.Is(err, invalid) {
+			return "invalid"
+		}
+	}
+
+	return "internal"
+}
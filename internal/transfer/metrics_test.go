@@ -0,0 +1,163 @@
+package transfer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+// conflicting fails the first conflicts transfers it is asked to create as
+// if they were aborted by concurrent ones.
+type conflicting struct {
+	*memorydb.TxStorage
+	conflicts int
+}
+
+func (s *conflicting) CreateTx(ctx context.Context, t transfer.Transaction, evs ...event.Event) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return transfer.ErrConflict
+	}
+	return s.TxStorage.CreateTx(ctx, t, evs...)
+}
+
+func TestRecordsBusinessMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{Meter: meter})
+	txs := &conflicting{memorydb.NewTxStorage(accounts), 1}
+	txService := transfer.NewService(txs, transfer.Options{Meter: meter})
+
+	from, err := accService.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	to, err := accService.New(ctx, account.NewAccount{Name: "Bob", Document: "98765432100"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	if _, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(60)}); err != nil {
+		t.Fatalf("expected the conflicting transfer to be retried, got %v", err)
+	}
+
+	if _, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(60)}); !errors.Is(err, transfer.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+
+	if _, err := txService.New(ctx, transfer.NewTx{From: from, To: from, Amount: decimal.NewFromInt(1)}); err == nil {
+		t.Fatal("expected a transfer to the same account to be rejected")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	if got := sum(rm, "accounts.created"); got != 2 {
+		t.Errorf("expected 2 accounts created, got %d", got)
+	}
+
+	if got := sum(rm, "transfers.created"); got != 1 {
+		t.Errorf("expected 1 transfer created, got %d", got)
+	}
+
+	if got := sum(rm, "transfers.failed", attribute.String("error.kind", "insufficient_funds")); got != 1 {
+		t.Errorf("expected 1 transfer failed for insufficient funds, got %d", got)
+	}
+
+	if got := sum(rm, "transfers.failed", attribute.String("error.kind", "invalid")); got != 1 {
+		t.Errorf("expected 1 invalid transfer, got %d", got)
+	}
+
+	if got := sum(rm, "db.tx.retries"); got != 1 {
+		t.Errorf("expected 1 retry, got %d", got)
+	}
+
+	amount, ok := find(rm, "transfers.amount").(metricdata.Histogram[float64])
+	if !ok || len(amount.DataPoints) != 1 || amount.DataPoints[0].Count != 1 || amount.DataPoints[0].Sum != 60 {
+		t.Errorf("expected the moved amount to be recorded once, got %+v", amount)
+	}
+
+	if v, ok := amount.DataPoints[0].Attributes.Value("transfer.currency"); !ok || v.AsString() != transfer.DefaultCurrency {
+		t.Errorf("expected the moved amount to be recorded in %s, got %v", transfer.DefaultCurrency, v.AsString())
+	}
+}
+
+func TestRecordsFinalOutcomesOfBatchesFallenBackOn(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+	txService := transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{Meter: meter})
+
+	ctx := context.Background()
+	from, _ := accService.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(100)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "Bob", Document: "98765432100"})
+
+	txs := []transfer.NewTx{
+		{From: from, To: to, Amount: decimal.NewFromInt(60)},
+		{From: from, To: to, Amount: decimal.NewFromInt(60)},
+	}
+
+	if _, err := txService.NewBatch(transfer.ContextWithFallback(ctx), txs, transfer.BatchAtomic); !errors.Is(err, transfer.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+
+	if _, err := txService.NewBatch(ctx, txs, transfer.BatchIndependent); err != nil {
+		t.Fatalf("failed to create batch: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	if created, failed := sum(rm, "transfers.created"), sum(rm, "transfers.failed"); created != 1 || failed != 1 {
+		t.Fatalf("expected 1 transfer created and 1 failed, got %d and %d", created, failed)
+	}
+}
+
+func find(rm metricdata.ResourceMetrics, name string) metricdata.Aggregation {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+// sum adds the data points of counter name having every attribute of attrs.
+func sum(rm metricdata.ResourceMetrics, name string, attrs ...attribute.KeyValue) int64 {
+	data, _ := find(rm, name).(metricdata.Sum[int64])
+
+	var total int64
+points:
+	for _, dp := range data.DataPoints {
+		for _, attr := range attrs {
+			if v, ok := dp.Attributes.Value(attr.Key); !ok || v != attr.Value {
+				continue points
+			}
+		}
+		total += dp.Value
+	}
+	return total
+}
@@ -2,52 +2,291 @@ package transfer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/event"
 	"github.com/lrweck/clean-api/pkg/errwrap"
+	"github.com/lrweck/clean-api/pkg/telemetry"
 )
 
-func NewService(s Storage, id IDGen, clock Clock) *Service {
+var tracer = otel.Tracer("github.com/lrweck/clean-api/internal/transfer")
 
-	if id == nil {
-		id = ulid.Make
+func NewService(s Storage, opts Options) *Service {
+
+	if opts.IDGen == nil {
+		opts.IDGen = ulid.Make
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
 	}
 
-	if clock == nil {
-		clock = time.Now
+	if opts.Currency == "" {
+		opts.Currency = DefaultCurrency
 	}
 
-	return &Service{s, id, clock}
+	return &Service{s, opts.IDGen, opts.Clock, newMetrics(opts.Meter, opts.Currency)}
 }
 
-func (s *Service) New(ctx context.Context, tx NewTx) (ulid.ULID, error) {
+func (s *Service) New(ctx context.Context, tx NewTx) (_ ulid.ULID, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.New", trace.WithAttributes(
+		attribute.Bool("transfer.scheduled", !tx.ExecuteAt.IsZero()),
+		attribute.Int("transfer.legs", len(tx.Legs)),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	scheduled := !tx.ExecuteAt.IsZero()
+	defer func() {
+		if err != nil {
+			s.metrics.recordFailed(ctx, 1, scheduled, err)
+		}
+	}()
 
 	if err := tx.validate(); err != nil {
 		return ulid.ULID{}, err
 	}
 
+	now := s.clock()
+
 	id := s.idGen()
 	t := Transaction{
 		ID:        id,
 		From:      tx.From,
 		To:        tx.To,
 		Amount:    tx.Amount,
-		CreatedAt: s.clock(),
+		CreatedAt: now,
+		Legs:      tx.Legs,
 	}
 
-	if err := s.repo.CreateTx(ctx, t); err != nil {
+	origin := originOf(ctx, tx)
+
+	if scheduled {
+		if err = s.schedule(ctx, t, tx.ExecuteAt, origin); err == nil {
+			s.metrics.recordCreated(ctx, 1, true)
+		}
+		return id, err
+	}
+
+	t.Status = StatusCompleted
+	t.ProcessedAt = now
+
+	ev, err := NewEvent(s.idGen(), t)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	auditEv, err := s.auditEvent(origin, t.ProcessedAt, audit.TransferCreated, nil, t)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	if err := s.retry(ctx, "CreateTx", func() error { return s.repo.CreateTx(ctx, t, ev, auditEv) }); err != nil {
 		return ulid.ULID{}, fmt.Errorf("failed to create a new transfer transaction: %w", err)
 	}
 
+	s.metrics.recordCreated(ctx, 1, false)
+	s.metrics.recordMoved(ctx, t.Amount)
+
 	return id, nil
 }
 
-func (s *Service) Retrieve(ctx context.Context, id ulid.ULID) (*Transaction, error) {
+func (s *Service) schedule(ctx context.Context, t Transaction, at time.Time, origin audit.Origin) error {
+
+	if !at.After(t.CreatedAt) {
+		return ErrExecuteAtInPast
+	}
+
+	t.Status = StatusScheduled
+	t.ExecuteAt = at
+
+	auditEv, err := s.auditEvent(origin, t.CreatedAt, audit.TransferScheduled, nil, t)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.ScheduleTx(ctx, t, auditEv); err != nil {
+		return fmt.Errorf("failed to schedule a new transfer transaction: %w", err)
+	}
+
+	return nil
+}
+
+// originOf is who made tx: its Origin when set, otherwise the caller in ctx.
+func originOf(ctx context.Context, tx NewTx) audit.Origin {
+	if tx.Origin != (audit.Origin{}) {
+		return tx.Origin
+	}
+	return audit.OriginOf(ctx)
+}
+
+// auditEvent records the change of a transaction from before, nil when it
+// is created, to after.
+func (s *Service) auditEvent(origin audit.Origin, at time.Time, action audit.Action, before *Transaction, after Transaction) (event.Event, error) {
+	c := audit.Change{Action: action, Targets: after.AuditTargets(), After: after}
+	if before != nil {
+		c.Before = before
+	}
+	return audit.NewEvent(s.idGen(), at, origin, c)
+}
+
+func (s *Service) Retrieve(ctx context.Context, id ulid.ULID) (_ *Transaction, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.Retrieve",
+		trace.WithAttributes(attribute.String("transfer.id", id.String())))
+	defer func() { telemetry.End(span, err) }()
 
 	t, err := s.repo.GetTx(ctx, id)
 
 	return t, errwrap.WrapIfNotNil(err, "failed to retrieve transaction")
 }
+
+// Cancel cancels a scheduled transfer that has not been executed yet.
+func (s *Service) Cancel(ctx context.Context, id ulid.ULID) (err error) {
+	ctx, span := tracer.Start(ctx, "transfer.Cancel",
+		trace.WithAttributes(attribute.String("transfer.id", id.String())))
+	defer func() { telemetry.End(span, err) }()
+
+	before, err := s.repo.GetTx(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel transfer %s: %w", id, err)
+	}
+
+	after := *before
+	after.Status = StatusCanceled
+	after.ProcessedAt = s.clock()
+
+	auditEv, err := s.auditEvent(audit.OriginOf(ctx), after.ProcessedAt, audit.TransferCanceled, before, after)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repo.CancelTx(ctx, id, after.ProcessedAt, auditEv); err != nil {
+		return fmt.Errorf("failed to cancel transfer %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// ExecuteDue executes up to limit scheduled transfers whose execution date
+// has passed. Business failures, such as insufficient funds, are recorded on
+// the transfer; any other error leaves it scheduled to be retried later.
+func (s *Service) ExecuteDue(ctx context.Context, limit int) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.ExecuteDue",
+		trace.WithAttributes(attribute.Int("transfer.limit", limit)))
+	defer func() { telemetry.End(span, err) }()
+
+	due, err := s.repo.GetDueTxs(ctx, s.clock(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve due transfers: %w", err)
+	}
+
+	var (
+		executed int
+		errs     []error
+	)
+
+	for _, t := range due {
+		err := s.executeScheduled(ctx, t)
+
+		switch {
+		case err == nil:
+			executed++
+			s.metrics.recordMoved(ctx, t.Amount)
+		case errors.Is(err, ErrNotScheduled):
+			// canceled or executed by someone else in the meantime
+		case IsExecutionFailure(err):
+			s.metrics.recordFailed(ctx, 1, true, err)
+			if err := s.failScheduled(ctx, t, err.Error()); err != nil && !errors.Is(err, ErrNotScheduled) {
+				errs = append(errs, fmt.Errorf("failed to record failure of transfer %s: %w", t.ID, err))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("failed to execute transfer %s: %w", t.ID, err))
+		}
+	}
+
+	return executed, errors.Join(errs...)
+}
+
+func (s *Service) executeScheduled(ctx context.Context, before Transaction) error {
+
+	t := before
+	t.Status = StatusCompleted
+	t.ProcessedAt = s.clock()
+
+	ev, err := NewEvent(s.idGen(), t)
+	if err != nil {
+		return err
+	}
+
+	auditEv, err := s.auditEvent(audit.OriginOf(ctx), t.ProcessedAt, audit.TransferExecuted, &before, t)
+	if err != nil {
+		return err
+	}
+
+	return s.retry(ctx, "ExecuteScheduledTx", func() error {
+		return s.repo.ExecuteScheduledTx(ctx, t.ID, t.ProcessedAt, ev, auditEv)
+	})
+}
+
+func (s *Service) failScheduled(ctx context.Context, before Transaction, reason string) error {
+
+	t := before
+	t.Status = StatusFailed
+	t.ProcessedAt = s.clock()
+	t.FailureReason = reason
+
+	ev, err := NewEvent(s.idGen(), t)
+	if err != nil {
+		return err
+	}
+
+	auditEv, err := s.auditEvent(audit.OriginOf(ctx), t.ProcessedAt, audit.TransferFailed, &before, t)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.FailScheduledTx(ctx, t.ID, t.ProcessedAt, reason, ev, auditEv)
+}
+
+// maxAttempts bounds how many times a storage transaction aborted by a
+// concurrent one is attempted.
+const maxAttempts = 3
+
+// retryDelay is the base delay before attempting a conflicting storage
+// transaction again, doubled on every attempt.
+const retryDelay = 5 * time.Millisecond
+
+// retry runs fn, a storage transaction named op, again while it conflicts
+// with concurrent ones, up to maxAttempts times. Attempts are spaced by a
+// random delay, so that the transactions that conflicted do not collide
+// again right away.
+func (s *Service) retry(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt == maxAttempts || !errors.Is(err, ErrConflict) {
+			return err
+		}
+
+		s.metrics.retries.Add(ctx, 1, metric.WithAttributes(attribute.String("db.operation", op)))
+
+		// full jitter: anywhere up to the exponential delay
+		delay := time.Duration(rand.Int63n(int64(retryDelay << (attempt - 1))))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
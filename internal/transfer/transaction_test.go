@@ -0,0 +1,297 @@
+package transfer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+type fixture struct {
+	accounts *account.Service
+	txs      *transfer.Service
+	now      time.Time
+}
+
+func newFixture() *fixture {
+	s := &fixture{now: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)}
+	clock := func() time.Time { return s.now }
+
+	storage := memorydb.NewAccountStorage()
+	s.accounts = account.NewService(storage, account.Options{Clock: clock})
+	s.txs = transfer.NewService(memorydb.NewTxStorage(storage), transfer.Options{Clock: clock})
+
+	return s
+}
+
+func (s *fixture) account(t *testing.T, balance int64) ulid.ULID {
+	t.Helper()
+
+	id, err := s.accounts.New(context.Background(), account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(balance)})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	return id
+}
+
+func (s *fixture) balance(t *testing.T, id ulid.ULID) decimal.Decimal {
+	t.Helper()
+
+	acc, err := s.accounts.Retrieve(context.Background(), id.String())
+	if err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	return acc.Balance
+}
+
+func (s *fixture) schedule(t *testing.T, from, to ulid.ULID, amount int64) ulid.ULID {
+	t.Helper()
+
+	id, err := s.txs.New(context.Background(), transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(amount), ExecuteAt: s.now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("failed to schedule transfer: %v", err)
+	}
+	return id
+}
+
+func (s *fixture) status(t *testing.T, id ulid.ULID) *transfer.Transaction {
+	t.Helper()
+
+	tx, err := s.txs.Retrieve(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to retrieve transfer: %v", err)
+	}
+	return tx
+}
+
+func TestExecuteDueExecutesDueTransfersOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+
+	from, to := s.account(t, 100), s.account(t, 0)
+	id := s.schedule(t, from, to, 60)
+
+	if n, err := s.txs.ExecuteDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("expected nothing to be due yet, got %d: %v", n, err)
+	}
+
+	s.now = s.now.Add(2 * time.Hour)
+
+	if n, err := s.txs.ExecuteDue(ctx, 10); n != 1 || err != nil {
+		t.Fatalf("expected the transfer to be executed, got %d: %v", n, err)
+	}
+
+	if n, err := s.txs.ExecuteDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("expected the transfer to be executed once, got %d: %v", n, err)
+	}
+
+	if tx := s.status(t, id); tx.Status != transfer.StatusCompleted || !tx.ProcessedAt.Equal(s.now) {
+		t.Fatalf("expected the transfer to be completed now, got %s at %s", tx.Status, tx.ProcessedAt)
+	}
+
+	if !s.balance(t, from).Equal(decimal.NewFromInt(40)) || !s.balance(t, to).Equal(decimal.NewFromInt(60)) {
+		t.Fatalf("expected the funds to be moved, got %s and %s", s.balance(t, from), s.balance(t, to))
+	}
+}
+
+func TestExecuteDueRecordsInsufficientFunds(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+
+	from, to := s.account(t, 10), s.account(t, 0)
+	id := s.schedule(t, from, to, 60)
+
+	s.now = s.now.Add(2 * time.Hour)
+
+	if n, err := s.txs.ExecuteDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("expected the failure to be recorded rather than returned, got %d: %v", n, err)
+	}
+
+	tx := s.status(t, id)
+	if tx.Status != transfer.StatusFailed || tx.FailureReason == "" {
+		t.Fatalf("expected the transfer to fail with a reason, got %s %q", tx.Status, tx.FailureReason)
+	}
+
+	if n, err := s.txs.ExecuteDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("expected a failed transfer not to be attempted again, got %d: %v", n, err)
+	}
+
+	if !s.balance(t, from).Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("expected no funds to be moved, got %s", s.balance(t, from))
+	}
+}
+
+func TestCancelRacesExecution(t *testing.T) {
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		s := newFixture()
+
+		from, to := s.account(t, 100), s.account(t, 0)
+		id := s.schedule(t, from, to, 60)
+
+		s.now = s.now.Add(2 * time.Hour)
+
+		var (
+			wg        sync.WaitGroup
+			executed  int
+			execErr   error
+			cancelErr error
+		)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			executed, execErr = s.txs.ExecuteDue(ctx, 10)
+		}()
+		go func() {
+			defer wg.Done()
+			cancelErr = s.txs.Cancel(ctx, id)
+		}()
+		wg.Wait()
+
+		if execErr != nil {
+			t.Fatalf("failed to execute due transfers: %v", execErr)
+		}
+
+		switch tx := s.status(t, id); {
+		case executed == 1:
+			if !errors.Is(cancelErr, transfer.ErrNotScheduled) || tx.Status != transfer.StatusCompleted {
+				t.Fatalf("expected the executed transfer not to be canceled, got %s: %v", tx.Status, cancelErr)
+			}
+			if !s.balance(t, from).Equal(decimal.NewFromInt(40)) {
+				t.Fatalf("expected the funds to be moved, got %s", s.balance(t, from))
+			}
+		default:
+			if cancelErr != nil || tx.Status != transfer.StatusCanceled {
+				t.Fatalf("expected the transfer to be canceled, got %s: %v", tx.Status, cancelErr)
+			}
+			if !s.balance(t, from).Equal(decimal.NewFromInt(100)) {
+				t.Fatalf("expected no funds to be moved, got %s", s.balance(t, from))
+			}
+		}
+	}
+}
+
+func leg(to ulid.ULID, amount int64) transfer.Leg {
+	return transfer.Leg{To: to, Amount: decimal.NewFromInt(amount)}
+}
+
+func TestNewValidatesLegs(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	from, b, c := s.account(t, 100), s.account(t, 0), s.account(t, 0)
+
+	tooMany := make([]transfer.Leg, transfer.MaxLegs+1)
+	for i := range tooMany {
+		tooMany[i] = leg(ulid.Make(), 1)
+	}
+
+	tests := []struct {
+		name string
+		tx   transfer.NewTx
+		err  error
+	}{
+		{"unbalanced", transfer.NewTx{From: from, Amount: decimal.NewFromInt(10), Legs: []transfer.Leg{leg(b, 4), leg(c, 5)}}, transfer.ErrUnbalancedLegs},
+		{"duplicate", transfer.NewTx{From: from, Amount: decimal.NewFromInt(10), Legs: []transfer.Leg{leg(b, 5), leg(b, 5)}}, transfer.ErrDuplicateLeg},
+		{"too many", transfer.NewTx{From: from, Amount: decimal.NewFromInt(transfer.MaxLegs + 1), Legs: tooMany}, transfer.ErrTooManyLegs},
+		{"with destination", transfer.NewTx{From: from, To: b, Amount: decimal.NewFromInt(10), Legs: []transfer.Leg{leg(c, 10)}}, transfer.ErrLegsWithDestination},
+		{"to the origin", transfer.NewTx{From: from, Amount: decimal.NewFromInt(10), Legs: []transfer.Leg{leg(from, 10)}}, transfer.ErrSameAccount},
+		{"empty leg", transfer.NewTx{From: from, Amount: decimal.NewFromInt(10), Legs: []transfer.Leg{leg(b, 10), leg(c, 0)}}, transfer.ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.txs.New(ctx, tt.tx); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+
+	if !s.balance(t, from).Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected rejected transfers not to move funds, got %s", s.balance(t, from))
+	}
+}
+
+func TestMultiLegTransferMovesFunds(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture()
+	from, b, c := s.account(t, 100), s.account(t, 0), s.account(t, 0)
+
+	id, err := s.txs.New(ctx, transfer.NewTx{From: from, Amount: decimal.NewFromInt(30), Legs: []transfer.Leg{leg(b, 10), leg(c, 20)}})
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+
+	want := map[ulid.ULID]int64{from: 70, b: 10, c: 20}
+	for acc, balance := range want {
+		if !s.balance(t, acc).Equal(decimal.NewFromInt(balance)) {
+			t.Errorf("expected a balance of %d, got %s", balance, s.balance(t, acc))
+		}
+	}
+
+	if _, err := s.txs.New(ctx, transfer.NewTx{From: from, Amount: decimal.NewFromInt(80), Legs: []transfer.Leg{leg(b, 10), leg(c, 70)}}); !errors.Is(err, transfer.ErrInsufficientFunds) {
+		t.Fatalf("expected the legs to be covered as a whole, got %v", err)
+	}
+
+	if tx := s.status(t, id); len(tx.Legs) != 2 || tx.To != (ulid.ULID{}) {
+		t.Fatalf("expected the legs to be stored, got %+v", tx)
+	}
+}
+
+func TestMovements(t *testing.T) {
+	from, b, c := ulid.Make(), ulid.Make(), ulid.Make()
+
+	tests := []struct {
+		name string
+		tx   transfer.Transaction
+		want []transfer.Movement
+	}{
+		{"single", transfer.Transaction{From: from, To: b, Amount: decimal.NewFromInt(10)},
+			[]transfer.Movement{{From: from, To: b, Amount: decimal.NewFromInt(10)}}},
+		{"legs", transfer.Transaction{From: from, Amount: decimal.NewFromInt(30), Legs: []transfer.Leg{leg(b, 10), leg(c, 20)}},
+			[]transfer.Movement{{From: from, To: b, Amount: decimal.NewFromInt(10)}, {From: from, To: c, Amount: decimal.NewFromInt(20)}}},
+	}
+
+	for _, tt := range tests {
+		got := tt.tx.Movements()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %d movements, got %d", tt.name, len(tt.want), len(got))
+			continue
+		}
+		for i := range got {
+			if got[i].From != tt.want[i].From || got[i].To != tt.want[i].To || !got[i].Amount.Equal(tt.want[i].Amount) {
+				t.Errorf("%s: expected movement %d to be %+v, got %+v", tt.name, i, tt.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+	txs := &conflicting{memorydb.NewTxStorage(accounts), 10}
+	txService := transfer.NewService(txs, transfer.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(100)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "Bob", Document: "98765432100"})
+
+	cancel()
+
+	_, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(10)})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, transfer.ErrConflict) {
+		t.Fatalf("expected the conflict to be given up on cancellation, got %v", err)
+	}
+
+	if txs.conflicts != 9 {
+		t.Fatalf("expected a single attempt, got %d", 10-txs.conflicts)
+	}
+}
@@ -6,21 +6,54 @@ import (
 
 	"github.com/oklog/ulid/v2"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/event"
 )
 
+// Storage persists transactions. Methods that receive events record them
+// in the outbox atomically with the state change.
 type Storage interface {
-	CreateTx(ctx context.Context, tx Transaction) error
+	CreateTx(ctx context.Context, tx Transaction, evs ...event.Event) error
 	GetTx(ctx context.Context, id ulid.ULID) (*Transaction, error)
+
+	// CreateTxBatch creates every transaction and moves their funds
+	// atomically: either all of them succeed or none is persisted. Each
+	// transfer must be covered by the balance left by the ones before it.
+	CreateTxBatch(ctx context.Context, txs []Transaction, evs ...event.Event) error
+
+	ScheduleTx(ctx context.Context, tx Transaction, evs ...event.Event) error
+	CancelTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) error
+	GetDueTxs(ctx context.Context, until time.Time, limit int) ([]Transaction, error)
+	ExecuteScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) error
+	FailScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, reason string, evs ...event.Event) error
 }
 
 type NewTx struct {
 	From   ulid.ULID
 	To     ulid.ULID
 	Amount decimal.Decimal
+
+	// ExecuteAt schedules the transfer for a future date.
+	// The zero value means the transfer is executed immediately.
+	ExecuteAt time.Time
+
+	// Legs splits Amount among several destination accounts. When set, To
+	// must be empty and the amounts of the legs must add up to Amount.
+	Legs []Leg
+
+	// Origin is who the transfer is made by, when made on behalf of another
+	// request than the one in the context, as bulk transfers are.
+	Origin audit.Origin
 }
 
 func (n NewTx) validate() error {
 
+	if len(n.Legs) > 0 {
+		return n.validateLegs()
+	}
+
 	if n.From == n.To {
 		return ErrSameAccount
 	}
@@ -31,21 +64,158 @@ func (n NewTx) validate() error {
 	return nil
 }
 
+func (n NewTx) validateLegs() error {
+
+	if n.To != (ulid.ULID{}) {
+		return ErrLegsWithDestination
+	}
+
+	if len(n.Legs) > MaxLegs {
+		return ErrTooManyLegs
+	}
+
+	total := decimal.Zero
+	seen := make(map[ulid.ULID]struct{}, len(n.Legs))
+
+	for _, leg := range n.Legs {
+		if leg.To == n.From {
+			return ErrSameAccount
+		}
+
+		if !leg.Amount.GreaterThan(decimal.Zero) {
+			return ErrInvalidAmount
+		}
+
+		if _, ok := seen[leg.To]; ok {
+			return ErrDuplicateLeg
+		}
+		seen[leg.To] = struct{}{}
+
+		total = total.Add(leg.Amount)
+	}
+
+	if !total.Equal(n.Amount) {
+		return ErrUnbalancedLegs
+	}
+
+	return nil
+}
+
+// MaxLegs is the maximum number of legs of a multi-leg transfer.
+const MaxLegs = 100
+
+// Leg is the credit of a multi-leg transfer to one of its destinations.
+type Leg struct {
+	To     ulid.ULID
+	Amount decimal.Decimal
+}
+
+// Movement is a single movement of funds between two accounts.
+type Movement struct {
+	From   ulid.ULID
+	To     ulid.ULID
+	Amount decimal.Decimal
+}
+
+type BatchMode string
+
+const (
+	// BatchAtomic executes every transfer of the batch, in order, in a
+	// single storage transaction; any failure rolls back the whole batch.
+	// A transfer may spend funds credited by an earlier one, never by a
+	// later one.
+	BatchAtomic BatchMode = "atomic"
+	// BatchIndependent executes each transfer on its own and reports
+	// individual results.
+	BatchIndependent BatchMode = "independent"
+)
+
+// MaxBatchSize is the maximum number of transfers accepted in a batch.
+const MaxBatchSize = 5000
+
+type BatchResult struct {
+	ID  ulid.ULID
+	Err error
+}
+
+type Status string
+
+const (
+	StatusScheduled Status = "scheduled"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
 type Transaction struct {
 	ID        ulid.ULID
 	From      ulid.ULID
 	To        ulid.ULID
 	Amount    decimal.Decimal
+	Status    Status
 	CreatedAt time.Time
+
+	// ExecuteAt is only set for scheduled transfers.
+	ExecuteAt time.Time
+	// ProcessedAt is when the transfer reached its final status.
+	ProcessedAt   time.Time
+	FailureReason string
+
+	// StandingOrderID and Occurrence link a transfer to the standing order
+	// that generated it. Both are zero for one-off transfers.
+	StandingOrderID ulid.ULID
+	Occurrence      int
+
+	// Legs are the destinations of a multi-leg transfer, in which case To
+	// is empty.
+	Legs []Leg
+}
+
+// Movements returns the movements of funds the transaction is made of: one
+// per leg for multi-leg transfers, or a single one otherwise.
+func (t Transaction) Movements() []Movement {
+	if len(t.Legs) == 0 {
+		return []Movement{{From: t.From, To: t.To, Amount: t.Amount}}
+	}
+
+	ms := make([]Movement, len(t.Legs))
+	for i, leg := range t.Legs {
+		ms[i] = Movement{From: t.From, To: leg.To, Amount: leg.Amount}
+	}
+	return ms
+}
+
+// AuditTargets are the ids of the transaction and of the accounts it moves
+// funds between, which its changes affect.
+func (t Transaction) AuditTargets() []ulid.ULID {
+	ids := []ulid.ULID{t.ID, t.From}
+	for _, m := range t.Movements() {
+		ids = append(ids, m.To)
+	}
+	return ids
 }
 
 type Service struct {
-	repo  Storage
-	idGen IDGen
-	clock Clock
+	repo    Storage
+	idGen   IDGen
+	clock   Clock
+	metrics metrics
 }
 
 type (
 	IDGen func() ulid.ULID
 	Clock func() time.Time
 )
+
+// Options customizes a Service. Zero fields fall back to ulid.Make,
+// time.Now, the global meter provider and DefaultCurrency.
+type Options struct {
+	IDGen IDGen
+	Clock Clock
+	Meter metric.Meter
+	// Currency is the ISO 4217 code of the currency accounts hold.
+	Currency string
+}
+
+// DefaultCurrency is the Currency of Options that set none.
+const DefaultCurrency = "BRL"
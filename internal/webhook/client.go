@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// NewClient returns a client for delivering webhooks that refuses to
+// connect to loopback, private and link-local addresses, so that
+// subscriptions cannot reach internal services. Addresses are checked once
+// resolved, which also covers names pointing at them and redirects.
+func NewClient(timeout time.Duration) *http.Client {
+
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrUnsafeAddress, host)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would be dialed instead of the receiver
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// isPublic reports whether ip may receive webhooks.
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// validURL returns ErrInvalidURL unless raw is an absolute https url, and
+// ErrUnsafeAddress when its host is obviously internal. Names are not
+// resolved here; NewClient checks the addresses they resolve to.
+func validURL(raw string) error {
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrUnsafeAddress
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !isPublic(ip) {
+		return ErrUnsafeAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import "errors"
+
+var (
+	ErrNotFound         = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrNotDead          = errors.New("only dead deliveries can be redelivered")
+
+	ErrInvalidURL       = errors.New("url must be an absolute https url")
+	ErrUnsafeAddress    = errors.New("url must not point to a loopback, private or link-local address")
+	ErrNoEventTypes     = errors.New("at least one event type is required")
+	ErrInvalidEventType = errors.New("unknown event type")
+	ErrNoAccounts       = errors.New("at least one account is required")
+	ErrSubscriptionGone = errors.New("webhook subscription was deleted")
+)
+
+type ErrValidation struct {
+	errs []error
+}
+
+func (e *ErrValidation) Error() string {
+	return "validation error"
+}
+
+func (e *ErrValidation) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ErrValidation) Errors() []string {
+	if e == nil {
+		return nil
+	}
+
+	errs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err.Error()
+	}
+	return errs
+}
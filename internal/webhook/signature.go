@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+
+	signatureVersion = "v1="
+)
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256,
+// keyed by the subscription secret, of the timestamp and the body joined by
+// a dot. Binding the timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery received
+// at now, rejecting timestamps older than tolerance.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+
+	if !strings.HasPrefix(signature, signatureVersion) {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
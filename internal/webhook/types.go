@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+type Storage interface {
+	CreateSubscription(ctx context.Context, s Subscription) error
+	GetSubscription(ctx context.Context, id ulid.ULID) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id ulid.ULID) error
+	// FindSubscriptions returns the subscriptions to typ events that watch
+	// any of the given accounts.
+	FindSubscriptions(ctx context.Context, typ event.Type, accounts []ulid.ULID) ([]Subscription, error)
+
+	// CreateDeliveries stores new deliveries, silently skipping those whose
+	// event was already delivered to the same subscription.
+	CreateDeliveries(ctx context.Context, ds []Delivery) error
+	GetDelivery(ctx context.Context, id ulid.ULID) (*Delivery, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries due by
+	// until and postpones their next attempt to lease, so that concurrent
+	// workers do not attempt them too.
+	ClaimDueDeliveries(ctx context.Context, until, lease time.Time, limit int) ([]Delivery, error)
+	ListDeliveries(ctx context.Context, subscription ulid.ULID, limit int) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, d Delivery) error
+}
+
+type NewSubscription struct {
+	URL        string
+	EventTypes []event.Type
+	Accounts   []ulid.ULID
+
+	// Secret signs the deliveries. A random one is generated when empty.
+	Secret string
+}
+
+func (n NewSubscription) validate() error {
+	var errs []error
+
+	if err := validURL(n.URL); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(n.EventTypes) == 0 {
+		errs = append(errs, ErrNoEventTypes)
+	}
+
+	for _, t := range n.EventTypes {
+		switch t {
+		case event.AccountCreated, event.TransferCompleted, event.TransferFailed:
+		default:
+			errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidEventType, t))
+		}
+	}
+
+	if len(n.Accounts) == 0 {
+		errs = append(errs, ErrNoAccounts)
+	}
+
+	if len(errs) > 0 {
+		return &ErrValidation{errs}
+	}
+
+	return nil
+}
+
+type Subscription struct {
+	ID         ulid.ULID
+	URL        string
+	EventTypes []event.Type
+	Accounts   []ulid.ULID
+	Secret     string
+	CreatedAt  time.Time
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is the dead-letter state of deliveries that exhausted
+	// their attempts. They are only retried when explicitly redelivered.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+type Delivery struct {
+	ID             ulid.ULID
+	SubscriptionID ulid.ULID
+	EventID        ulid.ULID
+	EventType      event.Type
+	// Payload is the exact body sent to the receiver.
+	Payload []byte
+	Status  DeliveryStatus
+
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+
+	CreatedAt   time.Time
+	DeliveredAt time.Time
+}
+
+// RetryPolicy controls the exponential backoff between failed attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// HTTPDoer sends delivery requests; *http.Client satisfies it.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DefaultConcurrency is how many deliveries are attempted at once by
+// default, so that a slow receiver does not hold up the others.
+const DefaultConcurrency = 8
+
+type Service struct {
+	repo        Storage
+	client      HTTPDoer
+	policy      RetryPolicy
+	concurrency int
+	idGen       IDGen
+	clock       Clock
+}
+
+type (
+	IDGen func() ulid.ULID
+	Clock func() time.Time
+)
+
+// Options customizes a Service. Zero fields fall back to NewClient with a
+// 10 seconds timeout, DefaultRetryPolicy, DefaultConcurrency, ulid.Make
+// and time.Now.
+type Options struct {
+	Client      HTTPDoer
+	Policy      RetryPolicy
+	Concurrency int
+	IDGen       IDGen
+	Clock       Clock
+}
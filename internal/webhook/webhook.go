@@ -0,0 +1,391 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+func NewService(s Storage, opts Options) *Service {
+
+	if opts.Client == nil {
+		opts.Client = NewClient(10 * time.Second)
+	}
+
+	policy := opts.Policy
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	if opts.IDGen == nil {
+		opts.IDGen = ulid.Make
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	return &Service{s, opts.Client, policy, opts.Concurrency, opts.IDGen, opts.Clock}
+}
+
+func (s *Service) New(ctx context.Context, n NewSubscription) (*Subscription, error) {
+
+	if err := n.validate(); err != nil {
+		return nil, fmt.Errorf("invalid webhook subscription: %w", err)
+	}
+
+	if n.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return nil, err
+		}
+		n.Secret = secret
+	}
+
+	sub := Subscription{
+		ID:         s.idGen(),
+		URL:        n.URL,
+		EventTypes: n.EventTypes,
+		Accounts:   n.Accounts,
+		Secret:     n.Secret,
+		CreatedAt:  s.clock(),
+	}
+
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return &sub, nil
+}
+
+func (s *Service) Retrieve(ctx context.Context, id ulid.ULID) (*Subscription, error) {
+
+	sub, err := s.repo.GetSubscription(ctx, id)
+
+	return sub, errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to retrieve webhook subscription %s", id))
+}
+
+// Delete removes a subscription. Its pending deliveries are dead-lettered
+// when they come due.
+func (s *Service) Delete(ctx context.Context, id ulid.ULID) error {
+
+	err := s.repo.DeleteSubscription(ctx, id)
+
+	return errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to delete webhook subscription %s", id))
+}
+
+// Deliveries returns the latest limit deliveries of a subscription, newest
+// first.
+func (s *Service) Deliveries(ctx context.Context, id ulid.ULID, limit int) ([]Delivery, error) {
+
+	if _, err := s.Retrieve(ctx, id); err != nil {
+		return nil, err
+	}
+
+	ds, err := s.repo.ListDeliveries(ctx, id, limit)
+
+	return ds, errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to list deliveries of webhook subscription %s", id))
+}
+
+// Redeliver moves a dead delivery back to pending with a fresh set of
+// attempts.
+func (s *Service) Redeliver(ctx context.Context, subscription, id ulid.ULID) error {
+
+	d, err := s.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve webhook delivery %s: %w", id, err)
+	}
+
+	if d.SubscriptionID != subscription {
+		return ErrDeliveryNotFound
+	}
+
+	if d.Status != DeliveryDead {
+		return ErrNotDead
+	}
+
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = s.clock()
+
+	err = s.repo.UpdateDelivery(ctx, *d)
+
+	return errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to redeliver webhook delivery %s", id))
+}
+
+// Publish implements event.Publisher by queueing a delivery of e for every
+// subscription watching any of the accounts it involves. Deliveries are
+// keyed by subscription and event, so republished events are not sent
+// twice.
+func (s *Service) Publish(ctx context.Context, e event.Event) error {
+
+	accounts, err := involvedAccounts(e)
+	if err != nil {
+		return err
+	}
+
+	subs, err := s.repo.FindSubscriptions(ctx, e.Type, accounts)
+	if err != nil {
+		return fmt.Errorf("failed to find webhook subscriptions: %w", err)
+	}
+
+	if len(subs) == 0 {
+		return nil
+	}
+
+	body, err := goccy.Marshal(envelope{
+		ID:         e.ID.String(),
+		Type:       e.Type,
+		OccurredAt: e.OccurredAt,
+		Data:       e.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload of event %s: %w", e.ID, err)
+	}
+
+	now := s.clock()
+	ds := make([]Delivery, len(subs))
+	for i, sub := range subs {
+		ds[i] = Delivery{
+			ID:             s.idGen(),
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        body,
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+	}
+
+	return errwrap.WrapIfNotNil(s.repo.CreateDeliveries(ctx, ds), "failed to create webhook deliveries")
+}
+
+// claimLease is how long claimed deliveries are kept from other workers.
+// Deliveries whose claim is never settled, as when their worker dies, are
+// attempted again once it expires.
+const claimLease = 5 * time.Minute
+
+// DeliverDue attempts up to limit pending deliveries whose next attempt is
+// due, up to the configured concurrency at once. A failed attempt is
+// retried with exponential backoff until the policy's attempts are
+// exhausted, when the delivery is dead-lettered. It returns the number of
+// successful deliveries.
+func (s *Service) DeliverDue(ctx context.Context, limit int) (int, error) {
+
+	now := s.clock()
+	due, err := s.repo.ClaimDueDeliveries(ctx, now, now.Add(claimLease), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve due webhook deliveries: %w", err)
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		delivered int
+		errs      []error
+		subs      = map[ulid.ULID]*Subscription{}
+		sem       = make(chan struct{}, s.concurrency)
+	)
+
+	for _, d := range due {
+		sub, ok := subs[d.SubscriptionID]
+		if !ok {
+			sub, err = s.repo.GetSubscription(ctx, d.SubscriptionID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to retrieve webhook subscription %s: %w", d.SubscriptionID, err))
+				mu.Unlock()
+				continue
+			}
+			subs[d.SubscriptionID] = sub
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(sub *Subscription, d Delivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			d = s.attempt(ctx, sub, d)
+			err := s.repo.UpdateDelivery(ctx, d)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if d.Status == DeliveryDelivered {
+				delivered++
+			}
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to update webhook delivery %s: %w", d.ID, err))
+			}
+		}(sub, d)
+	}
+
+	wg.Wait()
+
+	return delivered, errors.Join(errs...)
+}
+
+// attempt sends d to sub, which is nil when it was deleted, and returns d
+// updated with the outcome.
+func (s *Service) attempt(ctx context.Context, sub *Subscription, d Delivery) Delivery {
+
+	if sub == nil {
+		d.Status = DeliveryDead
+		d.LastError = ErrSubscriptionGone.Error()
+		return d
+	}
+
+	d.Attempts++
+	code, err := s.send(ctx, *sub, d)
+	now := s.clock()
+
+	d.LastAttemptAt = now
+	d.LastStatusCode = code
+
+	switch {
+	case err == nil:
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = now
+		d.LastError = ""
+	case d.Attempts >= s.policy.MaxAttempts:
+		d.Status = DeliveryDead
+		d.LastError = err.Error()
+	default:
+		d.NextAttemptAt = now.Add(s.policy.backoff(d.Attempts))
+		d.LastError = err.Error()
+	}
+
+	return d
+}
+
+func (s *Service) send(ctx context.Context, sub Subscription, d Delivery) (int, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	ts := s.clock().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.ID.String())
+	req.Header.Set(HeaderEvent, string(d.EventType))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain a bounded amount so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given failed attempt: the base delay
+// doubled for every previous attempt, capped at the maximum delay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+
+	d := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return d
+}
+
+type envelope struct {
+	ID         string           `json:"id"`
+	Type       event.Type       `json:"type"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	Data       goccy.RawMessage `json:"data"`
+}
+
+// involvedAccounts returns the accounts an event concerns, which decide
+// the subscriptions it is delivered to.
+func involvedAccounts(e event.Event) ([]ulid.ULID, error) {
+
+	switch e.Type {
+	case event.AccountCreated:
+		return []ulid.ULID{e.AggregateID}, nil
+	case event.TransferCompleted, event.TransferFailed:
+	default:
+		return nil, nil
+	}
+
+	var p event.TransferPayload
+	if err := goccy.Unmarshal(e.Payload, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode payload of event %s: %w", e.ID, err)
+	}
+
+	ids := []string{p.From}
+	if p.To != "" {
+		ids = append(ids, p.To)
+	}
+	for _, l := range p.Legs {
+		ids = append(ids, l.To)
+	}
+
+	accounts := make([]ulid.ULID, len(ids))
+	for i, id := range ids {
+		acc, err := ulid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account in payload of event %s: %w", e.ID, err)
+		}
+		accounts[i] = acc
+	}
+
+	return accounts, nil
+}
+
+func newSecret() (string, error) {
+
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return hex.EncodeToString(bs), nil
+}
@@ -0,0 +1,338 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/internal/webhook"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+// receiverURL is where subscriptions of the tests point to. Their clients
+// connect to the test server instead, whose certificate is valid for it.
+const receiverURL = "https://example.com/hooks"
+
+// clientOf returns a client of srv that sends every request to it.
+func clientOf(srv *httptest.Server) *http.Client {
+	client := srv.Client()
+
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	client.Transport = transport
+
+	return client
+}
+
+func TestDeliversSignedTransferEvents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	recv := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewTLSServer(recv)
+	defer srv.Close()
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+	txService := transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "from", Document: "1", StartingBalance: decimal.NewFromInt(10)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "to", Document: "2"})
+
+	svc := webhook.NewService(memorydb.NewWebhookStorage(), webhook.Options{Client: clientOf(srv), Clock: clock})
+
+	sub, err := svc.New(ctx, webhook.NewSubscription{
+		URL:        receiverURL,
+		EventTypes: []event.Type{event.TransferCompleted},
+		Accounts:   []ulid.ULID{to},
+	})
+	if err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+
+	if _, err := txService.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(5)}); err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+
+	outbox := memorydb.NewOutboxStorage(accounts)
+	evs, _ := outbox.GetUnpublished(ctx, 0)
+
+	// publishing twice simulates the relay crashing before marking
+	for i := 0; i < 2; i++ {
+		for _, e := range evs {
+			if err := svc.Publish(ctx, e); err != nil {
+				t.Fatalf("failed to publish event: %v", err)
+			}
+		}
+	}
+
+	delivered, err := svc.DeliverDue(ctx, 10)
+	if err != nil || delivered != 1 {
+		t.Fatalf("expected a single delivery, got %d: %v", delivered, err)
+	}
+
+	req, body := recv.requests[0], recv.bodies[0]
+	if req.Header.Get(webhook.HeaderEvent) != string(event.TransferCompleted) {
+		t.Fatalf("unexpected event header %q", req.Header.Get(webhook.HeaderEvent))
+	}
+
+	if !webhook.Verify(sub.Secret, req.Header.Get(webhook.HeaderTimestamp), req.Header.Get(webhook.HeaderSignature), body, now, time.Minute) {
+		t.Fatal("delivery signature does not verify")
+	}
+
+	if webhook.Verify("wrong secret", req.Header.Get(webhook.HeaderTimestamp), req.Header.Get(webhook.HeaderSignature), body, now, time.Minute) {
+		t.Fatal("delivery signature verifies with the wrong secret")
+	}
+
+	ds, _ := svc.Deliveries(ctx, sub.ID, 10)
+	if len(ds) != 1 || ds[0].Status != webhook.DeliveryDelivered || ds[0].LastStatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected delivery log %+v", ds)
+	}
+}
+
+func TestRetriesWithBackoffUntilDead(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	recv := &receiver{status: http.StatusInternalServerError}
+	srv := httptest.NewTLSServer(recv)
+	defer srv.Close()
+
+	svc := webhook.NewService(memorydb.NewWebhookStorage(), webhook.Options{
+		Client: clientOf(srv),
+		Policy: webhook.RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Second,
+			MaxDelay:    time.Minute,
+		},
+		Clock: clock,
+	})
+
+	acc := ulid.Make()
+	sub, _ := svc.New(ctx, webhook.NewSubscription{
+		URL:        receiverURL,
+		EventTypes: []event.Type{event.AccountCreated},
+		Accounts:   []ulid.ULID{acc},
+	})
+
+	ev, _ := event.New(ulid.Make(), event.AccountCreated, acc, now, event.AccountCreatedPayload{ID: acc.String()})
+	if err := svc.Publish(ctx, ev); err != nil {
+		t.Fatalf("failed to publish event: %v", err)
+	}
+
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		svc.DeliverDue(ctx, 10)
+
+		ds, _ := svc.Deliveries(ctx, sub.ID, 10)
+		if d := ds[0]; d.Status != webhook.DeliveryPending || d.Attempts != i+1 || !d.NextAttemptAt.Equal(now.Add(delay)) {
+			t.Fatalf("attempt %d: unexpected delivery %+v", i+1, d)
+		}
+
+		// not due yet
+		svc.DeliverDue(ctx, 10)
+		if len(recv.requests) != i+1 {
+			t.Fatalf("attempt %d: delivery retried before its backoff", i+1)
+		}
+
+		now = now.Add(delay)
+	}
+
+	svc.DeliverDue(ctx, 10)
+
+	ds, _ := svc.Deliveries(ctx, sub.ID, 10)
+	if d := ds[0]; d.Status != webhook.DeliveryDead || d.Attempts != 3 || d.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected dead delivery, got %+v", d)
+	}
+
+	recv.status = http.StatusOK
+	if err := svc.Redeliver(ctx, sub.ID, ds[0].ID); err != nil {
+		t.Fatalf("failed to redeliver: %v", err)
+	}
+
+	if delivered, _ := svc.DeliverDue(ctx, 10); delivered != 1 {
+		t.Fatal("expected redelivery to succeed")
+	}
+
+	if err := svc.Redeliver(ctx, sub.ID, ds[0].ID); !errors.Is(err, webhook.ErrNotDead) {
+		t.Fatalf("expected ErrNotDead, got %v", err)
+	}
+}
+
+func TestRejectsInternalURLs(t *testing.T) {
+	ctx := context.Background()
+	svc := webhook.NewService(memorydb.NewWebhookStorage(), webhook.Options{})
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"http://example.com/hooks", webhook.ErrInvalidURL},
+		{"/hooks", webhook.ErrInvalidURL},
+		{"https://localhost/hooks", webhook.ErrUnsafeAddress},
+		{"https://api.localhost./hooks", webhook.ErrUnsafeAddress},
+		{"https://127.0.0.1:8080/hooks", webhook.ErrUnsafeAddress},
+		{"https://10.0.0.1/hooks", webhook.ErrUnsafeAddress},
+		{"https://192.168.1.1/hooks", webhook.ErrUnsafeAddress},
+		{"https://169.254.169.254/latest/meta-data", webhook.ErrUnsafeAddress},
+		{"https://[::1]/hooks", webhook.ErrUnsafeAddress},
+		{"https://[fe80::1]/hooks", webhook.ErrUnsafeAddress},
+		{"https://0.0.0.0/hooks", webhook.ErrUnsafeAddress},
+		{"https://93.184.216.34/hooks", nil},
+		{receiverURL, nil},
+	}
+
+	for _, tt := range tests {
+		_, err := svc.New(ctx, webhook.NewSubscription{URL: tt.url, EventTypes: []event.Type{event.AccountCreated}, Accounts: []ulid.ULID{ulid.Make()}})
+		if (tt.err == nil && err != nil) || !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.url, tt.err, err)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	recv := &receiver{status: http.StatusOK}
+	srv := httptest.NewTLSServer(recv)
+	defer srv.Close()
+
+	// names resolving to internal addresses pass validation, but not dialing
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if _, err := webhook.NewClient(time.Second).Do(req); !errors.Is(err, webhook.ErrUnsafeAddress) {
+		t.Fatalf("expected the client to refuse a loopback address, got %v", err)
+	}
+
+	if len(recv.requests) != 0 {
+		t.Fatal("expected no request to reach the receiver")
+	}
+}
+
+func TestDeliversConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		inFlight, peak int
+		mu             sync.Mutex
+	)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	svc := webhook.NewService(memorydb.NewWebhookStorage(), webhook.Options{Client: clientOf(srv), Concurrency: 3})
+
+	acc := ulid.Make()
+	if _, err := svc.New(ctx, webhook.NewSubscription{URL: receiverURL, EventTypes: []event.Type{event.AccountCreated}, Accounts: []ulid.ULID{acc}}); err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+
+	for i := 0; i < 9; i++ {
+		ev, _ := event.New(ulid.Make(), event.AccountCreated, acc, time.Now(), event.AccountCreatedPayload{ID: acc.String()})
+		if err := svc.Publish(ctx, ev); err != nil {
+			t.Fatalf("failed to publish event: %v", err)
+		}
+	}
+
+	if delivered, err := svc.DeliverDue(ctx, 100); delivered != 9 || err != nil {
+		t.Fatalf("expected every delivery to succeed, got %d: %v", delivered, err)
+	}
+
+	if peak < 2 || peak > 3 {
+		t.Fatalf("expected up to 3 deliveries at once, got %d", peak)
+	}
+}
+
+func TestConcurrentWorkersDeliverOnce(t *testing.T) {
+	ctx := context.Background()
+
+	var received atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	storage := memorydb.NewWebhookStorage()
+	workers := []*webhook.Service{
+		webhook.NewService(storage, webhook.Options{Client: clientOf(srv)}),
+		webhook.NewService(storage, webhook.Options{Client: clientOf(srv)}),
+	}
+
+	acc := ulid.Make()
+	if _, err := workers[0].New(ctx, webhook.NewSubscription{URL: receiverURL, EventTypes: []event.Type{event.AccountCreated}, Accounts: []ulid.ULID{acc}}); err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		ev, _ := event.New(ulid.Make(), event.AccountCreated, acc, time.Now(), event.AccountCreatedPayload{ID: acc.String()})
+		if err := workers[0].Publish(ctx, ev); err != nil {
+			t.Fatalf("failed to publish event: %v", err)
+		}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		delivered atomic.Int32
+	)
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *webhook.Service) {
+			defer wg.Done()
+			n, err := w.DeliverDue(ctx, 100)
+			if err != nil {
+				t.Errorf("failed to deliver: %v", err)
+			}
+			delivered.Add(int32(n))
+		}(w)
+	}
+	wg.Wait()
+
+	if delivered.Load() != 20 || received.Load() != 20 {
+		t.Fatalf("expected every event to be delivered once, got %d deliveries and %d requests", delivered.Load(), received.Load())
+	}
+}
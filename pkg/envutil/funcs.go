@@ -3,6 +3,7 @@ package envutil
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -56,3 +57,54 @@ func GetString(key string, def string) string {
 
 	return s
 }
+
+func GetFloat(key string, def float64) float64 {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return def
+	}
+
+	return f
+}
+
+// GetMap parses a comma separated list of key=value pairs. Malformed pairs
+// are skipped.
+func GetMap(key string) map[string]string {
+	s, ok := os.LookupEnv(key)
+	if !ok || s == "" {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return m
+}
+
+// GetList splits the value of key by sep, skipping empty items.
+func GetList(key, sep string) []string {
+	s, ok := os.LookupEnv(key)
+	if !ok || s == "" {
+		return nil
+	}
+
+	var list []string
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
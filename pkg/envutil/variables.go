@@ -1,9 +1,69 @@
 package envutil
 
+import "time"
+
 func OTELExporterEndpointGo() string {
 	return GetString("OTEL_EXPORTER_OTLP_ENDPOINT_GO", "127.0.0.1:4317")
 }
 
+func AppVersion() string {
+	return GetString("APP_VERSION", "dev")
+}
+
+// TelemetryExporter is otlp-grpc, otlp-http, stdout, file or none.
+func TelemetryExporter() string {
+	return GetString("TELEMETRY_EXPORTER", "otlp-grpc")
+}
+
+// MetricsExporter overrides TelemetryExporter for metrics. It also accepts
+// prometheus, to serve them at /metrics.
+func MetricsExporter() string {
+	return GetString("METRICS_EXPORTER", "")
+}
+
+func MetricsInterval() time.Duration {
+	return GetDuration("METRICS_INTERVAL", 2*time.Second)
+}
+
+// TelemetryFile is where the file exporter appends telemetry.
+func TelemetryFile() string {
+	return GetString("TELEMETRY_FILE", "telemetry.jsonl")
+}
+
+func OTELExporterInsecure() bool {
+	return GetBool("OTEL_EXPORTER_OTLP_INSECURE", true)
+}
+
+// OTELExporterCertificate is the CA certificate file the OTLP endpoint is
+// verified with, instead of the system roots.
+func OTELExporterCertificate() string {
+	return GetString("OTEL_EXPORTER_OTLP_CERTIFICATE", "")
+}
+
+// OTELExporterHeaders are sent with every export, e.g.
+// "authorization=Bearer token,x-tenant=acme".
+func OTELExporterHeaders() map[string]string {
+	return GetMap("OTEL_EXPORTER_OTLP_HEADERS")
+}
+
+func OTELTracesSampler() string {
+	return GetString("OTEL_TRACES_SAMPLER", "parentbased_always_on")
+}
+
+func OTELTracesSamplerArg() float64 {
+	return GetFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+}
+
+// Storage is where the application keeps its state: memory, lost on
+// restart, or postgres, at PostgresDSN.
+func Storage() string {
+	return GetString("STORAGE", "memory")
+}
+
+func PostgresDSN() string {
+	return GetString("PG_DSN", "")
+}
+
 func CurrentEnv() string {
 	return GetString("ENV", "devel")
 }
@@ -11,3 +71,237 @@ func CurrentEnv() string {
 func AppName() string {
 	return GetString("APP_NAME", "clean-api")
 }
+
+func TransferSchedulerInterval() time.Duration {
+	return GetDuration("TRANSFER_SCHEDULER_INTERVAL", time.Second)
+}
+
+func TransferSchedulerBatchSize() int {
+	return GetInt("TRANSFER_SCHEDULER_BATCH_SIZE", 100)
+}
+
+func StandingOrderInterval() time.Duration {
+	return GetDuration("STANDING_ORDER_INTERVAL", 10*time.Second)
+}
+
+func StandingOrderBatchSize() int {
+	return GetInt("STANDING_ORDER_BATCH_SIZE", 100)
+}
+
+func BulkTransfersEnabled() bool {
+	return GetBool("BULK_TRANSFERS_ENABLED", false)
+}
+
+func BulkTransferShards() int {
+	return GetInt("BULK_TRANSFER_SHARDS", 16)
+}
+
+func BulkTransferMaxBatchSize() int {
+	return GetInt("BULK_TRANSFER_MAX_BATCH_SIZE", 150)
+}
+
+func BulkTransferMaxWait() time.Duration {
+	return GetDuration("BULK_TRANSFER_MAX_WAIT", 10*time.Millisecond)
+}
+
+func BulkTransferQueueSize() int {
+	return GetInt("BULK_TRANSFER_QUEUE_SIZE", 1024)
+}
+
+func OutboxRelayInterval() time.Duration {
+	return GetDuration("OUTBOX_RELAY_INTERVAL", time.Second)
+}
+
+func OutboxRelayBatchSize() int {
+	return GetInt("OUTBOX_RELAY_BATCH_SIZE", 100)
+}
+
+func WebhookDeliveryInterval() time.Duration {
+	return GetDuration("WEBHOOK_DELIVERY_INTERVAL", time.Second)
+}
+
+func WebhookDeliveryBatchSize() int {
+	return GetInt("WEBHOOK_DELIVERY_BATCH_SIZE", 100)
+}
+
+func WebhookTimeout() time.Duration {
+	return GetDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+}
+
+func WebhookMaxAttempts() int {
+	return GetInt("WEBHOOK_MAX_ATTEMPTS", 8)
+}
+
+func WebhookRetryBaseDelay() time.Duration {
+	return GetDuration("WEBHOOK_RETRY_BASE_DELAY", 5*time.Second)
+}
+
+func WebhookRetryMaxDelay() time.Duration {
+	return GetDuration("WEBHOOK_RETRY_MAX_DELAY", time.Hour)
+}
+
+func WebhookConcurrency() int {
+	return GetInt("WEBHOOK_CONCURRENCY", 8)
+}
+
+// Currency is the ISO 4217 code of the currency accounts hold.
+func Currency() string {
+	return GetString("CURRENCY", "BRL")
+}
+
+// AccountEventsHeartbeat is how often idle account event streams send a
+// heartbeat. Zero or less disables heartbeats.
+func AccountEventsHeartbeat() time.Duration {
+	return GetDuration("ACCOUNT_EVENTS_HEARTBEAT", 15*time.Second)
+}
+
+func AccountEventsHistorySize() int {
+	return GetInt("ACCOUNT_EVENTS_HISTORY_SIZE", 100)
+}
+
+func GRPCPort() int {
+	return GetInt("GRPC_PORT", 5011)
+}
+
+// AdminAPIKey is stored as an admin API key on startup, to bootstrap key
+// management.
+func AdminAPIKey() string {
+	return GetString("ADMIN_API_KEY", "")
+}
+
+// JWKSFile and JWKSURL locate the keys end user tokens are signed with.
+// Bearer tokens are only accepted when one of them is set; the file wins.
+func JWKSFile() string {
+	return GetString("JWT_JWKS_FILE", "")
+}
+
+func JWKSURL() string {
+	return GetString("JWT_JWKS_URL", "")
+}
+
+func JWKSRefreshInterval() time.Duration {
+	return GetDuration("JWKS_REFRESH_INTERVAL", time.Hour)
+}
+
+func JWKSMinRefreshInterval() time.Duration {
+	return GetDuration("JWKS_MIN_REFRESH_INTERVAL", time.Minute)
+}
+
+func JWTIssuer() string {
+	return GetString("JWT_ISSUER", "")
+}
+
+func JWTAudience() string {
+	return GetString("JWT_AUDIENCE", "")
+}
+
+// TrustedProxies are the CIDR ranges of the proxies in front of the API,
+// whose X-Forwarded-For header tells the address of clients. Without any,
+// clients are told apart by the address they connect from.
+func TrustedProxies() []string {
+	return GetList("TRUSTED_PROXIES", ",")
+}
+
+// RateLimitPeriod is the window of the rate limits below. A limit of zero
+// disables it.
+func RateLimitPeriod() time.Duration {
+	return GetDuration("RATE_LIMIT_PERIOD", time.Minute)
+}
+
+func RateLimitPerIP() int {
+	return GetInt("RATE_LIMIT_PER_IP", 1200)
+}
+
+func RateLimitPerClient() int {
+	return GetInt("RATE_LIMIT_PER_CLIENT", 600)
+}
+
+func RateLimitPerAccount() int {
+	return GetInt("RATE_LIMIT_PER_ACCOUNT", 300)
+}
+
+func HealthCheckTimeout() time.Duration {
+	return GetDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+}
+
+// OutboxMaxLag is how long events may wait to be published before the
+// outbox health check reports a failure. The check is optional: it shows in
+// the readiness report without making the application not ready.
+func OutboxMaxLag() time.Duration {
+	return GetDuration("OUTBOX_MAX_LAG", time.Minute)
+}
+
+// ShutdownDrainDelay is how long the application reports itself not ready
+// before it stops accepting requests. It should last at least one readiness
+// probe period.
+func ShutdownDrainDelay() time.Duration {
+	return GetDuration("SHUTDOWN_DRAIN_DELAY", 10*time.Second)
+}
+
+func ShutdownTimeout() time.Duration {
+	return GetDuration("SHUTDOWN_TIMEOUT", 5*time.Second)
+}
+
+// LogHeaders logs the headers of requests, with the sensitive ones
+// redacted.
+func LogHeaders() bool {
+	return GetBool("LOG_HEADERS", true)
+}
+
+// LogMaxBodySize is how many bytes of request and response bodies are
+// logged. Zero uses the default and a negative size logs no bodies.
+func LogMaxBodySize() int {
+	return GetInt("LOG_MAX_BODY_SIZE", 0)
+}
+
+// LogRedactFields, LogRedactPaths, LogRedactPatterns and LogRedactHeaders
+// extend what the request logger redacts by default. Patterns are separated
+// by semicolons, since regular expressions often contain commas.
+func LogRedactFields() []string {
+	return GetList("LOG_REDACT_FIELDS", ",")
+}
+
+func LogRedactPaths() []string {
+	return GetList("LOG_REDACT_PATHS", ",")
+}
+
+func LogRedactPatterns() []string {
+	return GetList("LOG_REDACT_PATTERNS", ";")
+}
+
+func LogRedactHeaders() []string {
+	return GetList("LOG_REDACT_HEADERS", ",")
+}
+
+// LogRedactMode is either mask or hash.
+func LogRedactMode() string {
+	return GetString("LOG_REDACT_MODE", "mask")
+}
+
+// LogRedactHashKey keys the hashes of the hash redaction mode. A random key
+// is used when empty, so hashes only correlate within a process.
+func LogRedactHashKey() string {
+	return GetString("LOG_REDACT_HASH_KEY", "")
+}
+
+// LogLevel is the default log level, debug in devel and info otherwise
+// when empty.
+func LogLevel() string {
+	return GetString("LOG_LEVEL", "")
+}
+
+// LogLevels sets the level of named loggers, such as http=warn,events=debug.
+func LogLevels() map[string]string {
+	return GetMap("LOG_LEVELS")
+}
+
+// LogDebugDuration is how long SIGHUP enables debug logging for.
+func LogDebugDuration() time.Duration {
+	return GetDuration("LOG_DEBUG_DURATION", 10*time.Minute)
+}
+
+// LogSpanEvents mirrors error logs as events of the span they were logged
+// in.
+func LogSpanEvents() bool {
+	return GetBool("LOG_SPAN_EVENTS", true)
+}
@@ -0,0 +1,134 @@
+// Package health reports whether the application can serve traffic.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDown     Status = "down"
+	StatusDraining Status = "draining"
+)
+
+// Check probes a dependency, failing with an error describing why it is
+// unusable.
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+	// Optional checks are reported but do not fail readiness, for
+	// dependencies the application can run without, such as telemetry.
+	Optional bool
+}
+
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckReport `json:"checks,omitempty"`
+}
+
+type CheckReport struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Optional  bool    `json:"optional,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Checker aggregates the checks of the application.
+type Checker struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks []Check
+}
+
+// NewChecker returns a Checker giving every check up to timeout to
+// complete.
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{timeout: timeout, checks: checks}
+}
+
+func (c *Checker) Add(checks ...Check) {
+	c.mu.Lock()
+	c.checks = append(c.checks, checks...)
+	c.mu.Unlock()
+}
+
+// Drain fails readiness from now on, so that load balancers stop routing
+// requests to an application that is shutting down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Live reports whether the process is alive. It never runs the checks: a
+// dependency being down is no reason to restart the application.
+func (c *Checker) Live() Report {
+	return Report{Status: StatusUp}
+}
+
+// Ready runs every check concurrently and reports whether the application
+// can serve traffic.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	r := Report{Status: StatusUp, Checks: make([]CheckReport, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			r.Checks[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, cr := range r.Checks {
+		if cr.Status != StatusUp && !cr.Optional {
+			r.Status = StatusDown
+		}
+	}
+
+	if c.draining.Load() {
+		r.Status = StatusDraining
+	}
+
+	return r
+}
+
+func run(ctx context.Context, check Check) CheckReport {
+	cr := CheckReport{Name: check.Name, Status: StatusUp, Optional: check.Optional}
+
+	start := time.Now()
+
+	// a check ignoring ctx must not hold up the whole report
+	done := make(chan error, 1)
+	go func() { done <- check.Func(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	cr.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		cr.Status = StatusDown
+		cr.Error = err.Error()
+	}
+
+	return cr
+}
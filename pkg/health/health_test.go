@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	hang := func(context.Context) error { select {} }
+
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Status
+	}{
+		{"no checks", nil, StatusUp},
+		{"all up", []Check{{Name: "db", Func: up}, {Name: "outbox", Func: up}}, StatusUp},
+		{"one down", []Check{{Name: "db", Func: down}, {Name: "outbox", Func: up}}, StatusDown},
+		{"optional down", []Check{{Name: "db", Func: up}, {Name: "otel", Func: down, Optional: true}}, StatusUp},
+		{"timeout", []Check{{Name: "db", Func: hang}}, StatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewChecker(50*time.Millisecond, tt.checks...).Ready(context.Background())
+
+			if r.Status != tt.want {
+				t.Fatalf("expected %s, got %+v", tt.want, r)
+			}
+
+			for i, cr := range r.Checks {
+				if cr.Name != tt.checks[i].Name {
+					t.Fatalf("expected checks to be reported in order, got %+v", r.Checks)
+				}
+				if (cr.Status == StatusDown) != (cr.Error != "") {
+					t.Fatalf("expected failed checks to report their error, got %+v", cr)
+				}
+			}
+		})
+	}
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	c := NewChecker(time.Second, Check{Name: "db", Func: func(context.Context) error { return nil }})
+	c.Drain()
+
+	if r := c.Ready(context.Background()); r.Status != StatusDraining {
+		t.Fatalf("expected a draining checker not to be ready, got %+v", r)
+	}
+
+	if r := c.Live(); r.Status != StatusUp {
+		t.Fatalf("expected a draining checker to be alive, got %+v", r)
+	}
+}
@@ -0,0 +1,141 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/goccy/go-json"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Parse decodes a JWK Set into its signature verification keys, by key id.
+// Encryption keys and key types that cannot verify signatures are skipped.
+func Parse(b []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode jwk set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if errors.Is(err, errUnsupported) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = pub
+	}
+
+	return keys, nil
+}
+
+var errUnsupported = errors.New("unsupported key type")
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("exponent: %w", err)
+		}
+
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent out of range")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errUnsupported
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupported
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, errUnsupported
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
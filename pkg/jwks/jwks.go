@@ -0,0 +1,177 @@
+// Package jwks keeps the signing keys of a token issuer, published as a
+// JSON Web Key Set, refreshed so that rotated keys are picked up without a
+// restart.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// Source loads a JWK Set document.
+type Source interface {
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// File is a JWK Set stored on the local filesystem.
+type File string
+
+func (f File) Load(context.Context) ([]byte, error) {
+	return os.ReadFile(string(f))
+}
+
+// URL is a JWK Set served by the issuer, usually at
+// /.well-known/jwks.json.
+type URL string
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+func (u URL) Load(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, string(u), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	// a key set is a few kilobytes; anything larger is not one
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// loadTimeout bounds a load, which outlives the request that started it.
+const loadTimeout = 10 * time.Second
+
+// Set caches the keys of a Source. Keys are reloaded once they are older
+// than the refresh interval, and as soon as a token names an unknown key,
+// which is how a rotation shows up. Reloads are throttled to one per
+// minRefresh, so that forged key ids cannot flood the issuer.
+//
+// Loads run in the background, one at a time, and cached keys are served
+// meanwhile; only requests for keys the set does not have wait for them.
+type Set struct {
+	src        Source
+	refresh    time.Duration
+	minRefresh time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	loading     chan struct{} // closed when the load in flight is done
+	loadErr     error
+}
+
+func New(src Source, refresh, minRefresh time.Duration) *Set {
+	return &Set{
+		src:        src,
+		refresh:    refresh,
+		minRefresh: minRefresh,
+	}
+}
+
+// Key returns the public key with the given id.
+func (s *Set) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+
+	k, ok := s.keys[kid]
+	stale := s.keys == nil || time.Since(s.loadedAt) >= s.refresh
+
+	var loading chan struct{}
+	if stale || !ok {
+		loading = s.reload()
+	}
+
+	s.mu.Unlock()
+
+	if ok {
+		return k, nil
+	}
+
+	if loading == nil {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		return nil, s.loadErr
+	}
+	// otherwise keep serving the keys we have while the source is down
+
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+}
+
+// reload starts loading the keys, unless a load is in flight, which is
+// joined instead, or was attempted less than minRefresh ago, in which case
+// it returns nil. s.mu must be held.
+func (s *Set) reload() chan struct{} {
+	if s.loading != nil {
+		return s.loading
+	}
+
+	if s.keys != nil && time.Since(s.attemptedAt) < s.minRefresh {
+		return nil
+	}
+
+	s.attemptedAt = time.Now()
+	loading := make(chan struct{})
+	s.loading = loading
+
+	go func() {
+		defer close(loading)
+
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
+
+		keys, err := s.load(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err == nil {
+			s.keys = keys
+			s.loadedAt = time.Now()
+		}
+		s.loadErr = err
+		s.loading = nil
+	}()
+
+	return loading
+}
+
+func (s *Set) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	b, err := s.src.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwk set: %w", err)
+	}
+
+	return Parse(b)
+}
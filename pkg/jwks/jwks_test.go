@@ -0,0 +1,195 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+func rsaJWK(kid string, k *rsa.PublicKey) string {
+	return fmt.Sprintf(`{"kty":"RSA","kid":%q,"use":"sig","n":%q,"e":%q}`,
+		kid, b64(k.N.Bytes()), b64(big.NewInt(int64(k.E)).Bytes()))
+}
+
+func TestParse(t *testing.T) {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	doc := fmt.Sprintf(`{"keys":[%s,
+		{"kty":"EC","kid":"ec","crv":"P-256","x":%q,"y":%q},
+		{"kty":"OKP","kid":"ed","crv":"Ed25519","x":%q},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"},
+		{"kty":"oct","kid":"hmac","k":"c2VjcmV0"}]}`,
+		rsaJWK("rsa", &rk.PublicKey), b64(ek.X.Bytes()), b64(ek.Y.Bytes()), b64(ok))
+
+	keys, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected the encryption and symmetric keys to be skipped, got %d keys", len(keys))
+	}
+
+	if k, _ := keys["rsa"].(*rsa.PublicKey); k == nil || !k.Equal(&rk.PublicKey) {
+		t.Errorf("unexpected rsa key %v", keys["rsa"])
+	}
+
+	if k, _ := keys["ec"].(*ecdsa.PublicKey); k == nil || !k.Equal(&ek.PublicKey) {
+		t.Errorf("unexpected ec key %v", keys["ec"])
+	}
+
+	if k, _ := keys["ed"].(ed25519.PublicKey); !k.Equal(ok) {
+		t.Errorf("unexpected ed25519 key %v", keys["ed"])
+	}
+
+	bad := `{"keys":[{"kty":"EC","kid":"ec","crv":"P-256","x":"AQ","y":"AQ"}]}`
+	if _, err := Parse([]byte(bad)); err == nil {
+		t.Error("expected a point off the curve to be rejected")
+	}
+}
+
+func TestSetPicksUpRotatedKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	write := func(kids ...string) {
+		doc := `{"keys":[`
+		for i, kid := range kids {
+			k, _ := rsa.GenerateKey(rand.Reader, 1024)
+			if i > 0 {
+				doc += ","
+			}
+			doc += rsaJWK(kid, &k.PublicKey)
+		}
+		if err := os.WriteFile(path, []byte(doc+"]}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("old")
+	set := New(File(path), 50*time.Millisecond, 0)
+
+	if _, err := set.Key(ctx, "old"); err != nil {
+		t.Fatalf("failed to load key: %v", err)
+	}
+
+	write("old", "new")
+	if _, err := set.Key(ctx, "new"); err != nil {
+		t.Fatalf("expected an unknown key id to reload the set, got %v", err)
+	}
+
+	write("new")
+	time.Sleep(60 * time.Millisecond)
+	if _, err := set.Key(ctx, "old"); err != nil {
+		t.Fatalf("expected the cached keys to be served while the set refreshes, got %v", err)
+	}
+
+	set.wait()
+	if _, err := set.Key(ctx, "old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected the retired key to be gone once the set is refreshed, got %v", err)
+	}
+
+	os.Remove(path)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := set.Key(ctx, "new"); err != nil {
+		t.Fatalf("expected the cached keys to be served while the source is down, got %v", err)
+	}
+
+	set.wait()
+	if _, err := set.Key(ctx, "new"); err != nil {
+		t.Fatalf("expected the cached keys to be kept when a load fails, got %v", err)
+	}
+}
+
+func TestSetLoadsOutsideRequests(t *testing.T) {
+	unblock := make(chan struct{})
+	loads := 0
+	src := sourceFunc(func(ctx context.Context) ([]byte, error) {
+		loads++
+		if loads > 1 {
+			<-unblock
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		k, _ := rsa.GenerateKey(rand.Reader, 1024)
+		return []byte(`{"keys":[` + rsaJWK("known", &k.PublicKey) + `]}`), nil
+	})
+
+	set := New(src, time.Hour, 0)
+	if _, err := set.Key(context.Background(), "known"); err != nil {
+		t.Fatalf("failed to load key: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if _, err := set.Key(ctx, "unknown"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to give up waiting, got %v", err)
+	}
+
+	if _, err := set.Key(context.Background(), "known"); err != nil {
+		t.Fatalf("expected the cached keys to be served while loading, got %v", err)
+	}
+
+	close(unblock)
+	set.wait()
+
+	set.mu.Lock()
+	err := set.loadErr
+	set.mu.Unlock()
+
+	if err != nil || loads != 2 {
+		t.Fatalf("expected a single load to outlive the request that started it, got %d loads: %v", loads, err)
+	}
+}
+
+// wait waits for the load in flight, if any.
+func (s *Set) wait() {
+	s.mu.Lock()
+	loading := s.loading
+	s.mu.Unlock()
+
+	if loading != nil {
+		<-loading
+	}
+}
+
+func TestSetThrottlesReloads(t *testing.T) {
+	loads := 0
+	src := sourceFunc(func(context.Context) ([]byte, error) {
+		loads++
+		return []byte(`{"keys":[]}`), nil
+	})
+
+	set := New(src, time.Hour, time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := set.Key(context.Background(), "forged"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	}
+
+	if loads != 1 {
+		t.Fatalf("expected unknown key ids to reload once per interval, got %d loads", loads)
+	}
+}
+
+type sourceFunc func(context.Context) ([]byte, error)
+
+func (f sourceFunc) Load(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
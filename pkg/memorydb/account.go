@@ -2,21 +2,37 @@ package memorydb
 
 import (
 	"context"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/oklog/ulid/v2"
 	"github.com/puzpuzpuz/xsync/v2"
 
 	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/telemetry"
 )
 
 type AccountStorage struct {
 	storage *xsync.MapOf[string, *account.Account]
+	locks   *xsync.MapOf[string, *sync.Mutex]
+	outbox  *OutboxStorage
 }
 
 func NewAccountStorage() *AccountStorage {
-	return &AccountStorage{xsync.NewMapOf[*account.Account]()}
+	return &AccountStorage{
+		storage: xsync.NewMapOf[*account.Account](),
+		locks:   xsync.NewMapOf[*sync.Mutex](),
+		outbox:  new(OutboxStorage),
+	}
 }
 
-func (s *AccountStorage) GetAccount(ctx context.Context, id string) (*account.Account, error) {
+func (s *AccountStorage) GetAccount(ctx context.Context, id string) (_ *account.Account, err error) {
+	_, span := startSpan(ctx, "GetAccount")
+	defer func() { telemetry.End(span, err) }()
+
 	acc, ok := s.storage.Load(id)
 	if !ok {
 		return nil, account.ErrNotFound
@@ -24,7 +40,94 @@ func (s *AccountStorage) GetAccount(ctx context.Context, id string) (*account.Ac
 	return acc, nil
 }
 
-func (s *AccountStorage) CreateAccount(ctx context.Context, acc account.Account) error {
+func (s *AccountStorage) CreateAccount(ctx context.Context, acc account.Account, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "CreateAccount")
+	defer func() { telemetry.End(span, err) }()
+
 	s.storage.Store(acc.ID.String(), &acc)
+	s.outbox.append(evs...)
+	return nil
+}
+
+// lockAccounts locks every given account, always in the same lexical order
+// to avoid deadlocks, and returns a function that unlocks them.
+func (s *AccountStorage) lockAccounts(ids ...ulid.ULID) func() {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, id.String())
+	}
+	sort.Strings(keys)
+
+	mus := make([]*sync.Mutex, 0, len(keys))
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		mu, _ := s.locks.LoadOrCompute(key, func() *sync.Mutex { return new(sync.Mutex) })
+		mu.Lock()
+		mus = append(mus, mu)
+	}
+
+	return func() {
+		for i := len(mus) - 1; i >= 0; i-- {
+			mus[i].Unlock()
+		}
+	}
+}
+
+// moveFunds applies every movement in order, each covered by the balance
+// left by the ones before it. All involved accounts are locked up front, so
+// either every movement is applied or none is. Stored accounts are never
+// mutated in place; updated copies replace them instead.
+func (s *AccountStorage) moveFunds(ms ...transfer.Movement) error {
+	ids := make([]ulid.ULID, 0, 2*len(ms))
+	for _, m := range ms {
+		ids = append(ids, m.From, m.To)
+	}
+
+	unlock := s.lockAccounts(ids...)
+	defer unlock()
+
+	now := time.Now()
+	updated := make(map[ulid.ULID]*account.Account, len(ids))
+
+	load := func(id ulid.ULID, role string) (*account.Account, error) {
+		if acc, ok := updated[id]; ok {
+			return acc, nil
+		}
+
+		stored, ok := s.storage.Load(id.String())
+		if !ok {
+			return nil, transfer.NewErrAccountNotFound(id, role)
+		}
+
+		acc := *stored
+		acc.UpdateAt = now
+		updated[id] = &acc
+		return &acc, nil
+	}
+
+	for _, m := range ms {
+		from, err := load(m.From, "origin")
+		if err != nil {
+			return err
+		}
+
+		to, err := load(m.To, "destination")
+		if err != nil {
+			return err
+		}
+
+		from.Balance = from.Balance.Sub(m.Amount)
+		if from.Balance.IsNegative() {
+			return transfer.ErrInsufficientFunds
+		}
+		to.Balance = to.Balance.Add(m.Amount)
+	}
+
+	for _, acc := range updated {
+		s.storage.Store(acc.ID.String(), acc)
+	}
+
 	return nil
 }
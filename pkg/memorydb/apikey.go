@@ -0,0 +1,98 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/puzpuzpuz/xsync/v2"
+
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+)
+
+type APIKeyStorage struct {
+	keys *xsync.MapOf[string, *apikey.Key]
+	// hashes indexes key ids by the hash of their secret
+	hashes *xsync.MapOf[string, string]
+}
+
+func NewAPIKeyStorage() *APIKeyStorage {
+	return &APIKeyStorage{
+		keys:   xsync.NewMapOf[*apikey.Key](),
+		hashes: xsync.NewMapOf[string](),
+	}
+}
+
+func (s *APIKeyStorage) CreateKey(ctx context.Context, k apikey.Key) error {
+	k.Scopes = append([]auth.Scope(nil), k.Scopes...)
+
+	s.keys.Store(k.ID.String(), &k)
+	s.hashes.Store(k.Hash, k.ID.String())
+	return nil
+}
+
+func (s *APIKeyStorage) GetKey(ctx context.Context, id ulid.ULID) (*apikey.Key, error) {
+	k, ok := s.keys.Load(id.String())
+	if !ok {
+		return nil, apikey.ErrNotFound
+	}
+
+	cp := *k
+	return &cp, nil
+}
+
+func (s *APIKeyStorage) GetKeyByHash(ctx context.Context, hash string) (*apikey.Key, error) {
+	id, ok := s.hashes.Load(hash)
+	if !ok {
+		return nil, apikey.ErrNotFound
+	}
+
+	k, ok := s.keys.Load(id)
+	if !ok {
+		return nil, apikey.ErrNotFound
+	}
+
+	cp := *k
+	return &cp, nil
+}
+
+func (s *APIKeyStorage) ListKeys(ctx context.Context) ([]apikey.Key, error) {
+	var ks []apikey.Key
+
+	s.keys.Range(func(_ string, k *apikey.Key) bool {
+		ks = append(ks, *k)
+		return true
+	})
+
+	sort.Slice(ks, func(i, j int) bool {
+		return ks[i].ID.Compare(ks[j].ID) < 0
+	})
+
+	return ks, nil
+}
+
+func (s *APIKeyStorage) RevokeKey(ctx context.Context, id ulid.ULID, at time.Time) error {
+	var found bool
+
+	s.keys.Compute(id.String(), func(k *apikey.Key, loaded bool) (*apikey.Key, bool) {
+		if !loaded {
+			return nil, true
+		}
+
+		found = true
+		if k.Revoked() {
+			return k, false
+		}
+
+		cp := *k
+		cp.RevokedAt = at
+		return &cp, false
+	})
+
+	if !found {
+		return apikey.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/audit"
+)
+
+type AuditStorage struct {
+	mu      sync.RWMutex
+	entries []audit.Entry
+	ids     map[ulid.ULID]struct{}
+}
+
+func NewAuditStorage() *AuditStorage {
+	return &AuditStorage{ids: make(map[ulid.ULID]struct{})}
+}
+
+func (s *AuditStorage) AppendEntry(ctx context.Context, next func(last *audit.Entry) (audit.Entry, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last *audit.Entry
+	if n := len(s.entries); n > 0 {
+		cp := s.entries[n-1]
+		last = &cp
+	}
+
+	e, err := next(last)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.ids[e.ID]; ok {
+		return nil
+	}
+
+	s.entries = append(s.entries, copyEntry(e))
+	s.ids[e.ID] = struct{}{}
+	return nil
+}
+
+func (s *AuditStorage) ListEntries(ctx context.Context, f audit.Filter) ([]audit.Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// entries are appended in order of seq
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].Seq > f.AfterSeq
+	})
+
+	var es []audit.Entry
+	for ; i < len(s.entries) && (f.Limit <= 0 || len(es) < f.Limit); i++ {
+		if e := s.entries[i]; entryMatches(e, f) {
+			es = append(es, copyEntry(e))
+		}
+	}
+
+	return es, nil
+}
+
+func entryMatches(e audit.Entry, f audit.Filter) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor,
+		f.Action != "" && e.Action != f.Action,
+		!f.From.IsZero() && e.At.Before(f.From),
+		!f.To.IsZero() && !e.At.Before(f.To):
+		return false
+	case f.Target == "":
+		return true
+	}
+
+	for _, t := range e.Targets {
+		if t == f.Target {
+			return true
+		}
+	}
+	return false
+}
+
+func copyEntry(e audit.Entry) audit.Entry {
+	e.Targets = append([]string(nil), e.Targets...)
+	e.Before = append([]byte(nil), e.Before...)
+	e.After = append([]byte(nil), e.After...)
+	return e
+}
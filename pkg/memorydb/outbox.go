@@ -0,0 +1,72 @@
+package memorydb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+// OutboxStorage keeps unpublished domain events in memory. Every storage
+// created from the same AccountStorage shares a single outbox.
+type OutboxStorage struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func NewOutboxStorage(accounts *AccountStorage) *OutboxStorage {
+	return accounts.outbox
+}
+
+func (s *OutboxStorage) append(evs ...event.Event) {
+	if len(evs) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, evs...)
+	s.mu.Unlock()
+}
+
+func (s *OutboxStorage) GetUnpublished(ctx context.Context, limit int) ([]event.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.events)
+	if limit > 0 && n > limit {
+		n = limit
+	}
+
+	evs := make([]event.Event, n)
+	copy(evs, s.events)
+
+	return evs, nil
+}
+
+// MarkPublished drops published events, since nothing reads them again.
+func (s *OutboxStorage) MarkPublished(ctx context.Context, ids []ulid.ULID, at time.Time) error {
+	published := make(map[ulid.ULID]struct{}, len(ids))
+	for _, id := range ids {
+		published[id] = struct{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.events[:0]
+	for _, e := range s.events {
+		if _, ok := published[e.ID]; !ok {
+			pending = append(pending, e)
+		}
+	}
+
+	for i := len(pending); i < len(s.events); i++ {
+		s.events[i] = event.Event{}
+	}
+	s.events = pending
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/puzpuzpuz/xsync/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+type StandingOrderStorage struct {
+	txs     *TxStorage
+	storage *xsync.MapOf[string, *standingorder.Order]
+
+	// mu serializes changes to standing orders
+	mu sync.Mutex
+}
+
+func NewStandingOrderStorage(txs *TxStorage) *StandingOrderStorage {
+	return &StandingOrderStorage{
+		txs:     txs,
+		storage: xsync.NewMapOf[*standingorder.Order](),
+	}
+}
+
+func (s *StandingOrderStorage) CreateOrder(ctx context.Context, o standingorder.Order) error {
+	s.storage.Store(o.ID.String(), &o)
+	return nil
+}
+
+func (s *StandingOrderStorage) GetOrder(ctx context.Context, id ulid.ULID) (*standingorder.Order, error) {
+	o, ok := s.storage.Load(id.String())
+	if !ok {
+		return nil, standingorder.ErrNotFound
+	}
+
+	order := *o
+	return &order, nil
+}
+
+func (s *StandingOrderStorage) CancelOrder(ctx context.Context, id ulid.ULID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.storage.Load(id.String())
+	if !ok {
+		return standingorder.ErrNotFound
+	}
+
+	if stored.Status != standingorder.StatusActive {
+		return standingorder.ErrNotActive
+	}
+
+	o := *stored
+	o.Status = standingorder.StatusCanceled
+	o.UpdatedAt = at
+
+	s.storage.Store(id.String(), &o)
+	return nil
+}
+
+func (s *StandingOrderStorage) GetDueOrders(ctx context.Context, until time.Time, limit int) ([]standingorder.Order, error) {
+	var orders []standingorder.Order
+
+	s.storage.Range(func(_ string, o *standingorder.Order) bool {
+		if o.Status == standingorder.StatusActive && !o.NextRunAt.After(until) {
+			orders = append(orders, *o)
+		}
+		return true
+	})
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].NextRunAt.Before(orders[j].NextRunAt)
+	})
+
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+
+	return orders, nil
+}
+
+func (s *StandingOrderStorage) ExecuteOccurrence(ctx context.Context, occ standingorder.Occurrence, evs ...event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.storage.Load(occ.OrderID.String())
+	if !ok {
+		return standingorder.ErrNotFound
+	}
+
+	if stored.Executed >= occ.Number {
+		return standingorder.ErrOccurrenceExecuted
+	}
+
+	if stored.Status != standingorder.StatusActive {
+		return standingorder.ErrNotActive
+	}
+
+	if occ.Tx.Status == transfer.StatusCompleted {
+		if err := s.txs.accounts.moveFunds(occ.Tx.Movements()...); err != nil {
+			return err
+		}
+	}
+
+	tx := occ.Tx
+	s.txs.storage.Store(tx.ID.String(), &tx)
+
+	o := *stored
+	o.Executed = occ.Number
+	o.NextRunAt = occ.NextRunAt
+	o.UpdatedAt = occ.Tx.ProcessedAt
+	if occ.Finished {
+		o.Status = standingorder.StatusFinished
+	}
+
+	s.storage.Store(o.ID.String(), &o)
+	s.txs.accounts.outbox.append(evs...)
+	return nil
+}
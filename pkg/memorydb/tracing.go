@@ -0,0 +1,22 @@
+package memorydb
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/lrweck/clean-api/pkg/memorydb")
+
+// startSpan starts the span of a storage call, named after the method, so
+// that traces look alike whatever the storage backing the services.
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "memorydb."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "memory"),
+			attribute.String("db.operation", method),
+		))
+}
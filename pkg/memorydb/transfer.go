@@ -0,0 +1,173 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/puzpuzpuz/xsync/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/telemetry"
+)
+
+type TxStorage struct {
+	accounts *AccountStorage
+	storage  *xsync.MapOf[string, *transfer.Transaction]
+
+	// mu serializes status transitions of scheduled transactions
+	mu sync.Mutex
+}
+
+func NewTxStorage(accounts *AccountStorage) *TxStorage {
+	return &TxStorage{
+		accounts: accounts,
+		storage:  xsync.NewMapOf[*transfer.Transaction](),
+	}
+}
+
+func (s *TxStorage) CreateTx(ctx context.Context, t transfer.Transaction, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "CreateTx")
+	defer func() { telemetry.End(span, err) }()
+
+	if err := s.accounts.moveFunds(t.Movements()...); err != nil {
+		return err
+	}
+
+	s.storage.Store(t.ID.String(), &t)
+	s.accounts.outbox.append(evs...)
+	return nil
+}
+
+func (s *TxStorage) CreateTxBatch(ctx context.Context, txs []transfer.Transaction, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "CreateTxBatch")
+	defer func() { telemetry.End(span, err) }()
+
+	var ms []transfer.Movement
+	for _, t := range txs {
+		ms = append(ms, t.Movements()...)
+	}
+
+	if err := s.accounts.moveFunds(ms...); err != nil {
+		return err
+	}
+
+	for _, t := range txs {
+		t := t
+		s.storage.Store(t.ID.String(), &t)
+	}
+	s.accounts.outbox.append(evs...)
+	return nil
+}
+
+func (s *TxStorage) GetTx(ctx context.Context, id ulid.ULID) (_ *transfer.Transaction, err error) {
+	_, span := startSpan(ctx, "GetTx")
+	defer func() { telemetry.End(span, err) }()
+
+	t, ok := s.storage.Load(id.String())
+	if !ok {
+		return nil, transfer.ErrNotFound
+	}
+
+	tx := *t
+	return &tx, nil
+}
+
+func (s *TxStorage) ScheduleTx(ctx context.Context, t transfer.Transaction, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "ScheduleTx")
+	defer func() { telemetry.End(span, err) }()
+
+	s.storage.Store(t.ID.String(), &t)
+	s.accounts.outbox.append(evs...)
+	return nil
+}
+
+func (s *TxStorage) CancelTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "CancelTx")
+	defer func() { telemetry.End(span, err) }()
+
+	return s.transition(id, evs, func(t *transfer.Transaction) error {
+		t.Status = transfer.StatusCanceled
+		t.ProcessedAt = at
+		return nil
+	})
+}
+
+func (s *TxStorage) GetDueTxs(ctx context.Context, until time.Time, limit int) (_ []transfer.Transaction, err error) {
+	_, span := startSpan(ctx, "GetDueTxs")
+	defer func() { telemetry.End(span, err) }()
+
+	var txs []transfer.Transaction
+
+	s.storage.Range(func(_ string, t *transfer.Transaction) bool {
+		if t.Status == transfer.StatusScheduled && !t.ExecuteAt.After(until) {
+			txs = append(txs, *t)
+		}
+		return true
+	})
+
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].ExecuteAt.Before(txs[j].ExecuteAt)
+	})
+
+	if limit > 0 && len(txs) > limit {
+		txs = txs[:limit]
+	}
+
+	return txs, nil
+}
+
+func (s *TxStorage) ExecuteScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "ExecuteScheduledTx")
+	defer func() { telemetry.End(span, err) }()
+
+	return s.transition(id, evs, func(t *transfer.Transaction) error {
+		if err := s.accounts.moveFunds(t.Movements()...); err != nil {
+			return err
+		}
+		t.Status = transfer.StatusCompleted
+		t.ProcessedAt = at
+		return nil
+	})
+}
+
+func (s *TxStorage) FailScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, reason string, evs ...event.Event) (err error) {
+	_, span := startSpan(ctx, "FailScheduledTx")
+	defer func() { telemetry.End(span, err) }()
+
+	return s.transition(id, evs, func(t *transfer.Transaction) error {
+		t.Status = transfer.StatusFailed
+		t.ProcessedAt = at
+		t.FailureReason = reason
+		return nil
+	})
+}
+
+// transition applies fn to a copy of a scheduled transaction and stores the
+// result along with evs, unless fn fails or the transaction is no longer
+// scheduled.
+func (s *TxStorage) transition(id ulid.ULID, evs []event.Event, fn func(t *transfer.Transaction) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.storage.Load(id.String())
+	if !ok {
+		return transfer.ErrNotFound
+	}
+
+	if stored.Status != transfer.StatusScheduled {
+		return transfer.ErrNotScheduled
+	}
+
+	t := *stored
+	if err := fn(&t); err != nil {
+		return err
+	}
+
+	s.storage.Store(id.String(), &t)
+	s.accounts.outbox.append(evs...)
+	return nil
+}
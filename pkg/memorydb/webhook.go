@@ -0,0 +1,176 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/puzpuzpuz/xsync/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/webhook"
+)
+
+type WebhookStorage struct {
+	subscriptions *xsync.MapOf[string, *webhook.Subscription]
+	deliveries    *xsync.MapOf[string, *webhook.Delivery]
+
+	// mu serializes delivery creation and claiming so that an event is
+	// delivered once per subscription
+	mu        sync.Mutex
+	delivered map[[2]ulid.ULID]struct{}
+}
+
+func NewWebhookStorage() *WebhookStorage {
+	return &WebhookStorage{
+		subscriptions: xsync.NewMapOf[*webhook.Subscription](),
+		deliveries:    xsync.NewMapOf[*webhook.Delivery](),
+		delivered:     map[[2]ulid.ULID]struct{}{},
+	}
+}
+
+func (s *WebhookStorage) CreateSubscription(ctx context.Context, sub webhook.Subscription) error {
+	s.subscriptions.Store(sub.ID.String(), &sub)
+	return nil
+}
+
+func (s *WebhookStorage) GetSubscription(ctx context.Context, id ulid.ULID) (*webhook.Subscription, error) {
+	sub, ok := s.subscriptions.Load(id.String())
+	if !ok {
+		return nil, webhook.ErrNotFound
+	}
+
+	cp := *sub
+	return &cp, nil
+}
+
+func (s *WebhookStorage) DeleteSubscription(ctx context.Context, id ulid.ULID) error {
+	if _, ok := s.subscriptions.LoadAndDelete(id.String()); !ok {
+		return webhook.ErrNotFound
+	}
+	return nil
+}
+
+func (s *WebhookStorage) FindSubscriptions(ctx context.Context, typ event.Type, accounts []ulid.ULID) ([]webhook.Subscription, error) {
+	var subs []webhook.Subscription
+
+	s.subscriptions.Range(func(_ string, sub *webhook.Subscription) bool {
+		if containsType(sub.EventTypes, typ) && containsAny(sub.Accounts, accounts) {
+			subs = append(subs, *sub)
+		}
+		return true
+	})
+
+	return subs, nil
+}
+
+func (s *WebhookStorage) CreateDeliveries(ctx context.Context, ds []webhook.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range ds {
+		key := [2]ulid.ULID{d.SubscriptionID, d.EventID}
+		if _, ok := s.delivered[key]; ok {
+			continue
+		}
+
+		s.delivered[key] = struct{}{}
+		d := d
+		s.deliveries.Store(d.ID.String(), &d)
+	}
+
+	return nil
+}
+
+func (s *WebhookStorage) GetDelivery(ctx context.Context, id ulid.ULID) (*webhook.Delivery, error) {
+	d, ok := s.deliveries.Load(id.String())
+	if !ok {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+
+	cp := *d
+	return &cp, nil
+}
+
+func (s *WebhookStorage) ClaimDueDeliveries(ctx context.Context, until, lease time.Time, limit int) ([]webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ds []webhook.Delivery
+
+	s.deliveries.Range(func(_ string, d *webhook.Delivery) bool {
+		if d.Status == webhook.DeliveryPending && !d.NextAttemptAt.After(until) {
+			ds = append(ds, *d)
+		}
+		return true
+	})
+
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].NextAttemptAt.Before(ds[j].NextAttemptAt)
+	})
+
+	if limit > 0 && len(ds) > limit {
+		ds = ds[:limit]
+	}
+
+	for i := range ds {
+		ds[i].NextAttemptAt = lease
+		claimed := ds[i]
+		s.deliveries.Store(claimed.ID.String(), &claimed)
+	}
+
+	return ds, nil
+}
+
+func (s *WebhookStorage) ListDeliveries(ctx context.Context, subscription ulid.ULID, limit int) ([]webhook.Delivery, error) {
+	var ds []webhook.Delivery
+
+	s.deliveries.Range(func(_ string, d *webhook.Delivery) bool {
+		if d.SubscriptionID == subscription {
+			ds = append(ds, *d)
+		}
+		return true
+	})
+
+	// ULIDs sort by creation time
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].ID.Compare(ds[j].ID) > 0
+	})
+
+	if limit > 0 && len(ds) > limit {
+		ds = ds[:limit]
+	}
+
+	return ds, nil
+}
+
+func (s *WebhookStorage) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	if _, ok := s.deliveries.Load(d.ID.String()); !ok {
+		return webhook.ErrDeliveryNotFound
+	}
+
+	s.deliveries.Store(d.ID.String(), &d)
+	return nil
+}
+
+func containsType(types []event.Type, typ event.Type) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(ids, candidates []ulid.ULID) bool {
+	for _, id := range ids {
+		for _, c := range candidates {
+			if id == c {
+				return true
+			}
+		}
+	}
+	return false
+}
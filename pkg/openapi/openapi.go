@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const jsonContentType = "application/json"
+
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       title,
+			Version:     version,
+			Description: description,
+		},
+		Paths: map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+}
+
+// Add documents a route. Echo style path parameters, such as ":id", are
+// converted to templates and documented as required string parameters.
+func (d *Document) Add(r Route) {
+
+	path, params := convertPath(r.Path)
+
+	op := &Operation{
+		OperationID: r.ID,
+		Summary:     r.Summary,
+		Parameters:  append(params, r.Params...),
+		Responses:   map[string]Response{},
+	}
+
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+
+	if r.Scopes != nil {
+		for name := range d.Components.SecuritySchemes {
+			op.Security = append(op.Security, SecurityRequirement{name: r.Scopes})
+		}
+		sort.Slice(op.Security, func(i, j int) bool {
+			return firstKey(op.Security[i]) < firstKey(op.Security[j])
+		})
+	}
+
+	if r.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  d.content(MediaType{Schema: d.schemaOf(r.Request, false)}),
+		}
+	}
+
+	for _, reply := range r.Replies {
+		res := Response{Description: reply.Description}
+		if res.Description == "" {
+			res.Description = http.StatusText(reply.Status)
+		}
+
+		if reply.Body != nil {
+			mt := MediaType{Schema: d.schemaOf(reply.Body, true)}
+			for name, ex := range reply.Examples {
+				if mt.Examples == nil {
+					mt.Examples = map[string]Example{}
+				}
+				mt.Examples[name] = Example{ex}
+			}
+
+			if reply.ContentType != "" {
+				res.Content = map[string]MediaType{reply.ContentType: mt}
+			} else {
+				res.Content = d.content(mt)
+			}
+		}
+
+		op.Responses[strconv.Itoa(reply.Status)] = res
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(r.Method)] = op
+}
+
+// AddSecurityScheme documents a way to authenticate. Routes added later
+// with scopes require any of the schemes.
+func (d *Document) AddSecurityScheme(name string, s SecurityScheme) {
+	if d.Components.SecuritySchemes == nil {
+		d.Components.SecuritySchemes = map[string]*SecurityScheme{}
+	}
+	d.Components.SecuritySchemes[name] = &s
+}
+
+func firstKey(r SecurityRequirement) string {
+	for k := range r {
+		return k
+	}
+	return ""
+}
+
+// content lists a body as JSON and in every other encoding of the
+// document. Examples are JSON only.
+func (d *Document) content(mt MediaType) map[string]MediaType {
+	content := map[string]MediaType{jsonContentType: mt}
+	for _, encoding := range d.Encodings {
+		content[encoding] = MediaType{Schema: mt.Schema}
+	}
+	return content
+}
+
+// Has reports whether the document covers the route registered with the
+// given method and Echo style path.
+func (d *Document) Has(method, path string) bool {
+	path, _ = convertPath(path)
+
+	item, ok := d.Paths[path]
+	if !ok {
+		return false
+	}
+
+	_, ok = (*item)[strings.ToLower(method)]
+	return ok
+}
+
+// Operations calls fn with the method and Echo style path of every
+// documented operation.
+func (d *Document) Operations(fn func(method, path string)) {
+	for path, item := range d.Paths {
+		for method := range *item {
+			fn(strings.ToUpper(method), echoPath(path))
+		}
+	}
+}
+
+func convertPath(path string) (string, []Parameter) {
+	var params []Parameter
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if !strings.HasPrefix(s, ":") {
+			continue
+		}
+
+		name := s[1:]
+		segments[i] = "{" + name + "}"
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+func echoPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
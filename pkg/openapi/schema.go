@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+)
+
+// known maps types with custom JSON encodings to their schemas.
+var known = map[reflect.Type]Schema{
+	reflect.TypeOf(time.Time{}):       {Type: "string", Format: "date-time"},
+	reflect.TypeOf(ulid.ULID{}):       {Type: "string", Format: "ulid"},
+	reflect.TypeOf(decimal.Decimal{}): {Type: "number", Format: "decimal"},
+}
+
+// Schema returns a named schema from the document components, useful for
+// bodies without a Go type, such as maps.
+func (d *Document) Schema(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Define adds a named schema to the document components.
+func (d *Document) Define(name string, s *Schema) {
+	d.Components.Schemas[name] = s
+}
+
+// schemaOf reflects the schema of v. Named structs are stored as
+// components and referenced. In responses, fields without omitempty are
+// required; requests leave every field optional, as the handlers validate
+// them.
+func (d *Document) schemaOf(v any, response bool) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return d.schemaOfType(reflect.TypeOf(v), response)
+}
+
+func (d *Document) schemaOfType(t reflect.Type, response bool) *Schema {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if s, ok := known[t]; ok {
+		return &s
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaOfType(t.Elem(), response)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOfType(t.Elem(), response)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t, response)
+		}
+
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// registered before recursing to support self references
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t, response)
+		}
+		return d.Schema(t.Name())
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type, response bool) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = d.schemaOfType(f.Type, response)
+
+		if response && !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,118 @@
+package openapi
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// Encodings lists the media types, besides JSON, in which every body
+	// documented without an explicit content type is also available.
+	Encodings []string `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case HTTP methods to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security lists alternative requirements, any of which suffices.
+	Security []SecurityRequirement `json:"security,omitempty"`
+}
+
+// SecurityRequirement maps security scheme names to the scopes they must
+// grant.
+type SecurityRequirement map[string][]string
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema   *Schema            `json:"schema,omitempty"`
+	Examples map[string]Example `json:"examples,omitempty"`
+}
+
+type Example struct {
+	Value any `json:"value"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema 2020-12 used by the documents.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// Route describes an operation of the API. Request and the bodies of the
+// replies are sample values whose types are reflected into schemas.
+type Route struct {
+	Method  string
+	Path    string
+	ID      string
+	Summary string
+	Tag     string
+	Params  []Parameter
+	Request any
+	Replies []Reply
+	// Scopes are required under any security scheme of the document. Nil
+	// leaves the operation public.
+	Scopes []string
+}
+
+type Reply struct {
+	Status      int
+	Description string
+	// ContentType defaults to application/json.
+	ContentType string
+	Body        any
+	// Examples are named sample bodies, such as the error maps.
+	Examples map[string]any
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/event"
 	"github.com/lrweck/clean-api/pkg/errwrap"
 )
 
@@ -30,24 +31,32 @@ type accountScan struct {
 	Name      string
 	Document  string
 	Balance   pgxdecimal.Decimal
+	Owner     sql.NullString
 	CreatedAt time.Time
 	UpdateAt  sql.NullTime
 }
 
 var (
 	getAccountSQL = `
-SELECT id,name,document,balance,created_at,updated_at 
+SELECT id,name,document,balance,owner,created_at,updated_at 
   FROM account
  WHERE id = $1`
 )
 
-func (s *AccountStorage) GetAccount(ctx context.Context, id ulid.ULID) (*account.Account, error) {
+func (s *AccountStorage) GetAccount(ctx context.Context, id string) (*account.Account, error) {
+	accID, err := ulid.ParseStrict(id)
+	if err != nil {
+		// no account has an invalid id
+		return nil, account.ErrNotFound
+	}
+
 	var acc accountScan
-	err := s.db.QueryRow(ctx, getAccountSQL, id).
+	err = s.db.QueryRow(ctx, getAccountSQL, accID).
 		Scan(&acc.ID,
 			&acc.Name,
 			&acc.Document,
 			&acc.Balance,
+			&acc.Owner,
 			&acc.CreatedAt,
 			&acc.UpdateAt)
 
@@ -63,6 +72,7 @@ func (s *AccountStorage) GetAccount(ctx context.Context, id ulid.ULID) (*account
 		Name:      acc.Name,
 		Document:  acc.Document,
 		Balance:   decimal.Decimal(acc.Balance),
+		Owner:     acc.Owner.String,
 		CreatedAt: acc.CreatedAt,
 		UpdateAt:  acc.UpdateAt.Time,
 	}, nil
@@ -70,16 +80,25 @@ func (s *AccountStorage) GetAccount(ctx context.Context, id ulid.ULID) (*account
 }
 
 var (
-	insertAccountSQL = "INSERT INTO account (id,name,document,balance,created_at) VALUES ($1,$2,$3,$4,$5)"
+	insertAccountSQL = "INSERT INTO account (id,name,document,balance,owner,created_at) VALUES ($1,$2,$3,$4,$5,$6)"
 )
 
-func (s *AccountStorage) CreateAccount(ctx context.Context, acc account.Account) error {
-	_, err := s.db.Exec(ctx, insertAccountSQL,
-		acc.ID,
-		acc.Name,
-		acc.Document,
-		acc.Balance,
-		acc.CreatedAt)
+func (s *AccountStorage) CreateAccount(ctx context.Context, acc account.Account, evs ...event.Event) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		batch := new(pgx.Batch)
+		batch.Queue(insertAccountSQL,
+			acc.ID,
+			acc.Name,
+			acc.Document,
+			acc.Balance,
+			nullString(acc.Owner),
+			acc.CreatedAt)
+		queueOutbox(batch, evs...)
+
+		return tx.SendBatch(ctx, batch).Close()
+	})
 
 	return errwrap.WrapIfNotNil(err, "failed to insert into account table")
 }
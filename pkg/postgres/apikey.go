@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+type APIKeyStorage struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyStorage(db *pgxpool.Pool) *APIKeyStorage {
+	return &APIKeyStorage{db}
+}
+
+type apiKeyScan struct {
+	ID        ulid.ULID
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
+
+func (s *apiKeyScan) dest() []any {
+	return []any{
+		&s.ID,
+		&s.Name,
+		&s.Prefix,
+		&s.Hash,
+		&s.Scopes,
+		&s.CreatedAt,
+		&s.RevokedAt,
+	}
+}
+
+func (s *apiKeyScan) key() apikey.Key {
+	scopes := make([]auth.Scope, len(s.Scopes))
+	for i, sc := range s.Scopes {
+		scopes[i] = auth.Scope(sc)
+	}
+
+	return apikey.Key{
+		ID:        s.ID,
+		Name:      s.Name,
+		Prefix:    s.Prefix,
+		Hash:      s.Hash,
+		Scopes:    scopes,
+		CreatedAt: s.CreatedAt,
+		RevokedAt: s.RevokedAt.Time,
+	}
+}
+
+const apiKeyColumns = "id,name,prefix,hash,scopes,created_at,revoked_at"
+
+var (
+	insertAPIKeySQL = `
+INSERT INTO api_key (id,name,prefix,hash,scopes,created_at)
+VALUES ($1,$2,$3,$4,$5,$6)`
+
+	getAPIKeySQL = `
+SELECT ` + apiKeyColumns + `
+  FROM api_key
+ WHERE id = $1`
+
+	// hash has a unique index, authentication looks keys up by it
+	getAPIKeyByHashSQL = `
+SELECT ` + apiKeyColumns + `
+  FROM api_key
+ WHERE hash = $1`
+
+	listAPIKeysSQL = `
+SELECT ` + apiKeyColumns + `
+  FROM api_key
+ ORDER BY id`
+
+	// revoking twice keeps the first revocation date
+	revokeAPIKeySQL = `
+UPDATE api_key
+   SET revoked_at = COALESCE(revoked_at, $2)
+ WHERE id = $1`
+)
+
+func (s *APIKeyStorage) CreateKey(ctx context.Context, k apikey.Key) error {
+	_, err := s.db.Exec(ctx, insertAPIKeySQL,
+		k.ID,
+		k.Name,
+		k.Prefix,
+		k.Hash,
+		k.Scopes,
+		k.CreatedAt)
+
+	return errwrap.WrapIfNotNil(err, "failed to insert into api_key table")
+}
+
+func (s *APIKeyStorage) GetKey(ctx context.Context, id ulid.ULID) (*apikey.Key, error) {
+	return s.queryKey(ctx, getAPIKeySQL, id)
+}
+
+func (s *APIKeyStorage) GetKeyByHash(ctx context.Context, hash string) (*apikey.Key, error) {
+	return s.queryKey(ctx, getAPIKeyByHashSQL, hash)
+}
+
+func (s *APIKeyStorage) queryKey(ctx context.Context, query string, arg any) (*apikey.Key, error) {
+	var sc apiKeyScan
+	err := s.db.QueryRow(ctx, query, arg).Scan(sc.dest()...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apikey.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to query api key: %w", err)
+	}
+
+	k := sc.key()
+	return &k, nil
+}
+
+func (s *APIKeyStorage) ListKeys(ctx context.Context) ([]apikey.Key, error) {
+	rows, err := s.db.Query(ctx, listAPIKeysSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var ks []apikey.Key
+	for rows.Next() {
+		var sc apiKeyScan
+		if err := rows.Scan(sc.dest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		ks = append(ks, sc.key())
+	}
+
+	return ks, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate api keys")
+}
+
+func (s *APIKeyStorage) RevokeKey(ctx context.Context, id ulid.ULID, at time.Time) error {
+	tag, err := s.db.Exec(ctx, revokeAPIKeySQL, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to update api_key table: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apikey.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+type AuditStorage struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditStorage(db *pgxpool.Pool) *AuditStorage {
+	return &AuditStorage{db}
+}
+
+// auditLockID keys the advisory lock serializing appends to audit_log.
+const auditLockID = 0x61756469
+
+const auditColumns = "seq,id,at,actor,request_id,action,targets,before,after,prev_hash,hash"
+
+var (
+	lockAuditSQL = "SELECT pg_advisory_xact_lock($1)"
+
+	auditEntryExistsSQL = "SELECT EXISTS (SELECT 1 FROM audit_log WHERE id = $1)"
+
+	lastAuditEntrySQL = `
+SELECT ` + auditColumns + `
+  FROM audit_log
+ ORDER BY seq DESC
+ LIMIT 1`
+
+	// before and after are json rather than jsonb, which keeps them as they
+	// were hashed
+	insertAuditEntrySQL = `
+INSERT INTO audit_log (` + auditColumns + `)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`
+
+	listAuditEntriesSQL = `
+SELECT ` + auditColumns + `
+  FROM audit_log
+ WHERE seq > $1
+   AND ($2::text = '' OR actor = $2)
+   AND ($3::text = '' OR action = $3)
+   AND ($4::text = '' OR $4 = ANY(targets))
+   AND ($5::timestamptz IS NULL OR at >= $5)
+   AND ($6::timestamptz IS NULL OR at < $6)
+ ORDER BY seq
+ LIMIT $7`
+)
+
+func (s *AuditStorage) AppendEntry(ctx context.Context, next func(last *audit.Entry) (audit.Entry, error)) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		if _, err := tx.Exec(ctx, lockAuditSQL, auditLockID); err != nil {
+			return fmt.Errorf("failed to lock audit log: %w", err)
+		}
+
+		var last *audit.Entry
+		e, err := scanAuditEntry(tx.QueryRow(ctx, lastAuditEntrySQL))
+		switch {
+		case err == nil:
+			last = &e
+		case !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("failed to query last audit entry: %w", err)
+		}
+
+		e, err = next(last)
+		if err != nil {
+			return err
+		}
+
+		// records are relayed at least once
+		var exists bool
+		if err := tx.QueryRow(ctx, auditEntryExistsSQL, e.ID).Scan(&exists); err != nil || exists {
+			return errwrap.WrapIfNotNil(err, "failed to query audit entry")
+		}
+
+		_, err = tx.Exec(ctx, insertAuditEntrySQL,
+			e.Seq,
+			e.ID,
+			e.At,
+			e.Actor,
+			nullString(e.RequestID),
+			e.Action,
+			e.Targets,
+			nullJSON(e.Before),
+			nullJSON(e.After),
+			nullString(e.PrevHash),
+			e.Hash)
+
+		return err
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to insert into audit_log table")
+}
+
+func (s *AuditStorage) ListEntries(ctx context.Context, f audit.Filter) ([]audit.Entry, error) {
+
+	var limit any
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+
+	rows, err := s.db.Query(ctx, listAuditEntriesSQL,
+		f.AfterSeq,
+		f.Actor,
+		f.Action,
+		f.Target,
+		nullTime(f.From),
+		nullTime(f.To),
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var es []audit.Entry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		es = append(es, e)
+	}
+
+	return es, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate audit entries")
+}
+
+func scanAuditEntry(row pgx.Row) (audit.Entry, error) {
+	var (
+		e                   audit.Entry
+		requestID, prevHash *string
+	)
+
+	err := row.Scan(
+		&e.Seq,
+		&e.ID,
+		&e.At,
+		&e.Actor,
+		&requestID,
+		&e.Action,
+		&e.Targets,
+		(*[]byte)(&e.Before),
+		(*[]byte)(&e.After),
+		&prevHash,
+		&e.Hash)
+
+	if requestID != nil {
+		e.RequestID = *requestID
+	}
+	if prevHash != nil {
+		e.PrevHash = *prevHash
+	}
+	e.At = e.At.UTC()
+
+	return e, err
+}
+
+// nullJSON maps an empty document to NULL.
+func nullJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
@@ -2,14 +2,31 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/errwrap"
 )
 
 func NewDB(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 
-	db, err := pgxpool.New(ctx, dsn)
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+
+	cfg.ConnConfig.Tracer = NewTracer(nil)
+
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new pool from DSN: %w", err)
 	}
@@ -20,3 +37,59 @@ func NewDB(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 
 	return db, nil
 }
+
+//go:embed schema.sql
+var schema string
+
+// Migrate creates the tables and indexes the storages rely on, leaving
+// those that already exist untouched.
+func Migrate(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, schema)
+	return errwrap.WrapIfNotNil(err, "failed to apply schema")
+}
+
+// uniqueViolation is the SQLSTATE raised when a unique constraint is violated.
+const uniqueViolation = "23505"
+
+// SQLSTATEs raised when a transaction is aborted by a concurrent one.
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// conflictErr marks err as transfer.ErrConflict when its transaction was
+// aborted by a concurrent one, so that it may be retried.
+func conflictErr(err error) error {
+	if pgErr := new(pgconn.PgError); errors.As(err, &pgErr) &&
+		(pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected) {
+		return fmt.Errorf("%w: %w", transfer.ErrConflict, err)
+	}
+	return err
+}
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// nullULID maps the zero ulid to NULL.
+func nullULID(id ulid.ULID) any {
+	if id == (ulid.ULID{}) {
+		return nil
+	}
+	return id
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(i int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(i), Valid: i != 0}
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+type OutboxStorage struct {
+	db *pgxpool.Pool
+}
+
+func NewOutboxStorage(db *pgxpool.Pool) *OutboxStorage {
+	return &OutboxStorage{db}
+}
+
+var (
+	insertOutboxSQL = "INSERT INTO outbox (id,type,aggregate_id,payload,occurred_at) VALUES ($1,$2,$3,$4,$5)"
+
+	getUnpublishedSQL = `
+SELECT id,type,aggregate_id,payload,occurred_at
+  FROM outbox
+ WHERE published_at IS NULL
+ ORDER BY id
+ LIMIT $1`
+
+	markPublishedSQL = "UPDATE outbox SET published_at = $2 WHERE id = ANY($1)"
+)
+
+// queueOutbox queues the insertion of evs, so that they are recorded in the
+// same transaction as the state change that caused them.
+func queueOutbox(batch *pgx.Batch, evs ...event.Event) {
+	for _, e := range evs {
+		batch.Queue(insertOutboxSQL, e.ID, e.Type, e.AggregateID, e.Payload, e.OccurredAt)
+	}
+}
+
+func (s *OutboxStorage) GetUnpublished(ctx context.Context, limit int) ([]event.Event, error) {
+	rows, err := s.db.Query(ctx, getUnpublishedSQL, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unpublished events: %w", err)
+	}
+	defer rows.Close()
+
+	var evs []event.Event
+	for rows.Next() {
+		var (
+			e   event.Event
+			typ string
+		)
+		if err := rows.Scan(&e.ID, &typ, &e.AggregateID, &e.Payload, &e.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan unpublished event: %w", err)
+		}
+		e.Type = event.Type(typ)
+		evs = append(evs, e)
+	}
+
+	return evs, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate unpublished events")
+}
+
+func (s *OutboxStorage) MarkPublished(ctx context.Context, ids []ulid.ULID, at time.Time) error {
+	_, err := s.db.Exec(ctx, markPublishedSQL, ids, at)
+
+	return errwrap.WrapIfNotNil(err, "failed to update outbox")
+}
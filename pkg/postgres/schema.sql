@@ -0,0 +1,135 @@
+-- Tables of the postgres storage. Every statement may run again on an
+-- existing database, so Migrate applies the whole file on every start.
+
+CREATE TABLE IF NOT EXISTS account (
+    id         bytea PRIMARY KEY,
+    name       text NOT NULL,
+    document   text NOT NULL,
+    balance    numeric NOT NULL,
+    owner      text,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS transaction (
+    id                bytea PRIMARY KEY,
+    from_id           bytea NOT NULL,
+    to_id             bytea,
+    amount            numeric NOT NULL,
+    status            text NOT NULL,
+    created_at        timestamptz NOT NULL,
+    execute_at        timestamptz,
+    processed_at      timestamptz,
+    failure_reason    text,
+    standing_order_id bytea,
+    occurrence        integer
+);
+
+CREATE INDEX IF NOT EXISTS transaction_due_idx
+    ON transaction (execute_at)
+ WHERE status = 'scheduled';
+
+-- an occurrence of a standing order is executed at most once, even by
+-- concurrent workers
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_occurrence_idx
+    ON transaction (standing_order_id, occurrence);
+
+CREATE TABLE IF NOT EXISTS standing_order (
+    id              bytea PRIMARY KEY,
+    from_id         bytea NOT NULL,
+    to_id           bytea NOT NULL,
+    amount          numeric NOT NULL,
+    frequency       text NOT NULL,
+    start_at        timestamptz NOT NULL,
+    end_at          timestamptz,
+    max_occurrences integer NOT NULL,
+    status          text NOT NULL,
+    executed        integer NOT NULL,
+    next_run_at     timestamptz NOT NULL,
+    created_at      timestamptz NOT NULL,
+    updated_at      timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS standing_order_due_idx
+    ON standing_order (next_run_at)
+ WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS transaction_leg (
+    transaction_id bytea NOT NULL REFERENCES transaction (id),
+    position       integer NOT NULL,
+    to_id          bytea NOT NULL,
+    amount         numeric NOT NULL,
+    PRIMARY KEY (transaction_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id           bytea PRIMARY KEY,
+    type         text NOT NULL,
+    aggregate_id bytea NOT NULL,
+    payload      json NOT NULL,
+    occurred_at  timestamptz NOT NULL,
+    published_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx
+    ON outbox (id)
+ WHERE published_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_subscription (
+    id          bytea PRIMARY KEY,
+    url         text NOT NULL,
+    event_types text[] NOT NULL,
+    account_ids bytea[] NOT NULL,
+    secret      text NOT NULL,
+    created_at  timestamptz NOT NULL
+);
+
+-- deliveries outlive their subscription, which they are dead-lettered
+-- without
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id               bytea PRIMARY KEY,
+    subscription_id  bytea NOT NULL,
+    event_id         bytea NOT NULL,
+    event_type       text NOT NULL,
+    payload          bytea NOT NULL,
+    status           text NOT NULL,
+    attempts         integer NOT NULL,
+    next_attempt_at  timestamptz NOT NULL,
+    last_attempt_at  timestamptz,
+    last_status_code integer,
+    last_error       text,
+    created_at       timestamptz NOT NULL,
+    delivered_at     timestamptz,
+    -- an event is delivered once per subscription
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx
+    ON webhook_delivery (next_attempt_at)
+ WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS api_key (
+    id         bytea PRIMARY KEY,
+    name       text NOT NULL,
+    prefix     text NOT NULL,
+    hash       text NOT NULL UNIQUE,
+    scopes     text[] NOT NULL,
+    created_at timestamptz NOT NULL,
+    revoked_at timestamptz
+);
+
+-- before and after are json rather than jsonb, which keeps them as they
+-- were hashed
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq        bigint PRIMARY KEY,
+    id         bytea NOT NULL UNIQUE,
+    at         timestamptz NOT NULL,
+    actor      text NOT NULL,
+    request_id text,
+    action     text NOT NULL,
+    targets    text[] NOT NULL,
+    before     json,
+    after      json,
+    prev_hash  text,
+    hash       text NOT NULL
+);
@@ -0,0 +1,270 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+type StandingOrderStorage struct {
+	db  *pgxpool.Pool
+	txs *TxStorage
+}
+
+func NewStandingOrderStorage(db *pgxpool.Pool) *StandingOrderStorage {
+	return &StandingOrderStorage{db, NewTxStorage(db)}
+}
+
+type standingOrderScan struct {
+	ID             ulid.ULID
+	From           ulid.ULID
+	To             ulid.ULID
+	Amount         pgxdecimal.Decimal
+	Frequency      string
+	StartAt        time.Time
+	EndAt          sql.NullTime
+	MaxOccurrences int
+	Status         string
+	Executed       int
+	NextRunAt      time.Time
+	CreatedAt      time.Time
+	UpdatedAt      sql.NullTime
+}
+
+func (o *standingOrderScan) dest() []any {
+	return []any{
+		&o.ID,
+		&o.From,
+		&o.To,
+		&o.Amount,
+		&o.Frequency,
+		&o.StartAt,
+		&o.EndAt,
+		&o.MaxOccurrences,
+		&o.Status,
+		&o.Executed,
+		&o.NextRunAt,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	}
+}
+
+func (o *standingOrderScan) order() standingorder.Order {
+	return standingorder.Order{
+		ID:             o.ID,
+		From:           o.From,
+		To:             o.To,
+		Amount:         decimal.Decimal(o.Amount),
+		Frequency:      standingorder.Frequency(o.Frequency),
+		StartAt:        o.StartAt,
+		EndAt:          o.EndAt.Time,
+		MaxOccurrences: o.MaxOccurrences,
+		Status:         standingorder.Status(o.Status),
+		Executed:       o.Executed,
+		NextRunAt:      o.NextRunAt,
+		CreatedAt:      o.CreatedAt,
+		UpdatedAt:      o.UpdatedAt.Time,
+	}
+}
+
+const standingOrderColumns = "id,from_id,to_id,amount,frequency,start_at,end_at,max_occurrences,status,executed,next_run_at,created_at,updated_at"
+
+var (
+	insertStandingOrderSQL = `
+INSERT INTO standing_order (id,from_id,to_id,amount,frequency,start_at,end_at,max_occurrences,status,executed,next_run_at,created_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,0,$10,$11)`
+
+	getStandingOrderSQL = `
+SELECT ` + standingOrderColumns + `
+  FROM standing_order
+ WHERE id = $1`
+
+	lockStandingOrderStatusSQL = "SELECT status FROM standing_order WHERE id = $1 FOR UPDATE"
+
+	getStandingOrderProgressSQL = "SELECT executed, status FROM standing_order WHERE id = $1"
+
+	cancelStandingOrderSQL = "UPDATE standing_order SET status = $2, updated_at = $3 WHERE id = $1"
+
+	getDueStandingOrdersSQL = `
+SELECT ` + standingOrderColumns + `
+  FROM standing_order
+ WHERE status = $1
+   AND next_run_at <= $2
+ ORDER BY next_run_at
+ LIMIT $3`
+
+	// the executed counter works as an optimistic lock: only the run that
+	// advances it from the previous occurrence gets to record this one.
+	advanceStandingOrderSQL = `
+UPDATE standing_order
+   SET executed = $2, next_run_at = $3, status = $4, updated_at = $5
+ WHERE id = $1
+   AND executed = $2 - 1
+   AND status = $6`
+)
+
+func (s *StandingOrderStorage) CreateOrder(ctx context.Context, o standingorder.Order) error {
+	_, err := s.db.Exec(ctx, insertStandingOrderSQL,
+		o.ID,
+		o.From,
+		o.To,
+		o.Amount,
+		o.Frequency,
+		o.StartAt,
+		nullTime(o.EndAt),
+		o.MaxOccurrences,
+		o.Status,
+		o.NextRunAt,
+		o.CreatedAt)
+
+	return errwrap.WrapIfNotNil(err, "failed to insert into standing_order table")
+}
+
+func (s *StandingOrderStorage) GetOrder(ctx context.Context, id ulid.ULID) (*standingorder.Order, error) {
+	var o standingOrderScan
+	err := s.db.QueryRow(ctx, getStandingOrderSQL, id).Scan(o.dest()...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, standingorder.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to query standing order by id: %w", err)
+	}
+
+	order := o.order()
+	return &order, nil
+}
+
+func (s *StandingOrderStorage) CancelOrder(ctx context.Context, id ulid.ULID, at time.Time) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		var status string
+		if err := tx.QueryRow(ctx, lockStandingOrderStatusSQL, id).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return standingorder.ErrNotFound
+			}
+			return fmt.Errorf("failed to lock standing order: %w", err)
+		}
+
+		if standingorder.Status(status) != standingorder.StatusActive {
+			return standingorder.ErrNotActive
+		}
+
+		_, err := tx.Exec(ctx, cancelStandingOrderSQL, id, standingorder.StatusCanceled, at)
+		return errwrap.WrapIfNotNil(err, "failed to update standing order status")
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to cancel standing order")
+}
+
+// whyNotAdvanced tells an occurrence executed by another run from an order
+// that is no longer active, as the memory storage does.
+func (s *StandingOrderStorage) whyNotAdvanced(ctx context.Context, tx pgx.Tx, occ standingorder.Occurrence) error {
+
+	var (
+		executed int
+		status   string
+	)
+
+	if err := tx.QueryRow(ctx, getStandingOrderProgressSQL, occ.OrderID).Scan(&executed, &status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return standingorder.ErrNotFound
+		}
+		return fmt.Errorf("failed to query standing order progress: %w", err)
+	}
+
+	if executed >= occ.Number {
+		return standingorder.ErrOccurrenceExecuted
+	}
+
+	return standingorder.ErrNotActive
+}
+
+func (s *StandingOrderStorage) GetDueOrders(ctx context.Context, until time.Time, limit int) ([]standingorder.Order, error) {
+	rows, err := s.db.Query(ctx, getDueStandingOrdersSQL, standingorder.StatusActive, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due standing orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []standingorder.Order
+	for rows.Next() {
+		var o standingOrderScan
+		if err := rows.Scan(o.dest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan due standing order: %w", err)
+		}
+		orders = append(orders, o.order())
+	}
+
+	return orders, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate due standing orders")
+}
+
+// ExecuteOccurrence advances the order, records the occurrence transfer and
+// moves the funds in a single transaction, so a crash at any point either
+// persists the whole occurrence or nothing at all. The unique index on
+// transaction (standing_order_id, occurrence) backs the optimistic lock.
+func (s *StandingOrderStorage) ExecuteOccurrence(ctx context.Context, occ standingorder.Occurrence, evs ...event.Event) error {
+
+	status := standingorder.StatusActive
+	if occ.Finished {
+		status = standingorder.StatusFinished
+	}
+
+	t := occ.Tx
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		tag, err := tx.Exec(ctx, advanceStandingOrderSQL,
+			occ.OrderID,
+			occ.Number,
+			occ.NextRunAt,
+			status,
+			t.ProcessedAt,
+			standingorder.StatusActive)
+		if err != nil {
+			return fmt.Errorf("failed to advance standing order: %w", err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return s.whyNotAdvanced(ctx, tx, occ)
+		}
+
+		batch := new(pgx.Batch)
+		queueInsertTx(batch, t)
+		queueOutbox(batch, evs...)
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			if pgErr := new(pgconn.PgError); errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return standingorder.ErrOccurrenceExecuted
+			}
+			return fmt.Errorf("failed to insert into transaction table: %w", err)
+		}
+
+		if t.Status != transfer.StatusCompleted {
+			return nil
+		}
+
+		if err := s.txs.moveFundsWithoutDeadlock(ctx, tx, t.Movements()...); err != nil {
+			return fmt.Errorf("failed to transfer funds: %w", err)
+		}
+
+		return nil
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to execute standing order occurrence")
+}
@@ -0,0 +1,107 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/pkg/postgres"
+)
+
+// testDB connects to the database at PG_TEST_DSN, skipping the test when
+// none is given.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("PG_TEST_DSN")
+	if dsn == "" {
+		t.Skip("PG_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	db, err := postgres.NewDB(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	if err := postgres.Migrate(ctx, db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestExecuteOccurrenceOnceAcrossExecutors(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	accounts := account.NewService(postgres.NewAccountStorage(db), account.Options{Clock: clock})
+	from, err := accounts.New(ctx, account.NewAccount{Name: "Alice", Document: "12345678909", StartingBalance: decimal.NewFromInt(1000)})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	to, err := accounts.New(ctx, account.NewAccount{Name: "Bob", Document: "98765432100"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	later := now.Add(time.Minute)
+	executors := []*standingorder.Service{
+		standingorder.NewService(postgres.NewStandingOrderStorage(db), standingorder.Options{Clock: func() time.Time { return later }}),
+		standingorder.NewService(postgres.NewStandingOrderStorage(db), standingorder.Options{Clock: func() time.Time { return later }}),
+	}
+
+	const orders = 20
+	for i := 0; i < orders; i++ {
+		id, err := standingorder.NewService(postgres.NewStandingOrderStorage(db), standingorder.Options{Clock: clock}).
+			New(ctx, standingorder.NewOrder{From: from, To: to, Amount: decimal.NewFromInt(10), Frequency: standingorder.Daily})
+		if err != nil {
+			t.Fatalf("failed to create standing order: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(executors))
+		for j, e := range executors {
+			wg.Add(1)
+			go func(j int, e *standingorder.Service) {
+				defer wg.Done()
+				_, errs[j] = e.ExecuteDue(ctx, 100)
+			}(j, e)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("failed to execute due standing orders: %v", err)
+			}
+		}
+
+		o, err := executors[0].Retrieve(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to retrieve standing order: %v", err)
+		}
+		if o.Executed != 1 {
+			t.Fatalf("expected the occurrence to be executed once, got %d", o.Executed)
+		}
+	}
+
+	acc, err := accounts.Retrieve(ctx, to.String())
+	if err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	if !acc.Balance.Equal(decimal.NewFromInt(10 * orders)) {
+		t.Fatalf("expected every occurrence to move funds once, got %s", acc.Balance)
+	}
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lrweck/clean-api/pkg/telemetry"
+)
+
+// Tracer creates a span for every query and batch sent to the database,
+// named after the statement, such as "SELECT account", with the rows it
+// affected and the error it failed with. It implements pgx.QueryTracer and
+// pgx.BatchTracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tp.Tracer("github.com/lrweck/clean-api/pkg/postgres")}
+}
+
+func (t *Tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	op, table := statementOf(data.SQL)
+
+	ctx, _ = t.tracer.Start(ctx, statementName(op, table),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbAttributes(data.SQL, op, table)...))
+
+	return ctx
+}
+
+func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+
+	telemetry.End(span, data.Err)
+}
+
+func (t *Tracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "BATCH",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.Int("db.batch.size", data.Batch.Len()),
+		))
+
+	return ctx
+}
+
+// TraceBatchQuery records each statement of a batch as an event of its span.
+func (t *Tracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	op, table := statementOf(data.SQL)
+
+	attrs := append(dbAttributes(data.SQL, op, table),
+		attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	if data.Err != nil {
+		attrs = append(attrs, attribute.String("exception.message", data.Err.Error()))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent(statementName(op, table), trace.WithAttributes(attrs...))
+}
+
+func (t *Tracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	telemetry.End(trace.SpanFromContext(ctx), data.Err)
+}
+
+func dbAttributes(sql, op, table string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", strings.TrimSpace(sql)),
+		attribute.String("db.operation", op),
+	}
+	if table != "" {
+		attrs = append(attrs, attribute.String("db.sql.table", table))
+	}
+	return attrs
+}
+
+func statementName(op, table string) string {
+	if table == "" {
+		return op
+	}
+	return op + " " + table
+}
+
+// statementOf returns the operation of a statement and the table it works
+// on, when it can be told from the leading keywords. Statements starting
+// with a common table expression are reported by operation only.
+func statementOf(sql string) (op, table string) {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY", ""
+	}
+
+	op = strings.ToUpper(fields[0])
+
+	var after string
+	switch op {
+	case "SELECT", "DELETE":
+		after = "FROM"
+	case "INSERT":
+		after = "INTO"
+	case "UPDATE":
+		if len(fields) > 1 {
+			return op, tableName(fields[1])
+		}
+		return op, ""
+	default:
+		return op, ""
+	}
+
+	for i := 1; i < len(fields)-1; i++ {
+		if strings.EqualFold(fields[i], after) {
+			return op, tableName(fields[i+1])
+		}
+	}
+
+	return op, ""
+}
+
+func tableName(s string) string {
+	if i := strings.IndexAny(s, "(,;"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, `"`)
+}
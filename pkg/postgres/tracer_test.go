@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStatementOf(t *testing.T) {
+	tests := []struct {
+		sql, op, table string
+	}{
+		{getAccountSQL, "SELECT", "account"},
+		{insertTxSQL, "INSERT", "transaction"},
+		{claimScheduledTxSQL, "UPDATE", "transaction"},
+		{"delete from webhook where id = $1", "DELETE", "webhook"},
+		{"WITH due AS (SELECT 1) SELECT * FROM due", "WITH", ""},
+		{"  ", "QUERY", ""},
+	}
+
+	for _, tt := range tests {
+		op, table := statementOf(tt.sql)
+		if op != tt.op || table != tt.table {
+			t.Errorf("statementOf(%q) = %q, %q, want %q, %q", tt.sql, op, table, tt.op, tt.table)
+		}
+	}
+}
+
+func TestTracerRecordsQueries(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tr := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: claimScheduledTxSQL})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 1")})
+
+	ctx = tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: getAccountSQL})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("connection reset")})
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	if got := spans[0].Name(); got != "UPDATE transaction" {
+		t.Errorf("expected the span to be named after the statement, got %q", got)
+	}
+
+	var affected int64
+	for _, kv := range spans[0].Attributes() {
+		if kv.Key == "db.rows_affected" {
+			affected = kv.Value.AsInt64()
+		}
+	}
+	if affected != 1 {
+		t.Errorf("expected 1 row affected, got %d", affected)
+	}
+
+	if got := spans[1].Status().Code; got != codes.Error {
+		t.Errorf("expected a failed query to set the error status, got %v", got)
+	}
+}
@@ -2,8 +2,11 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
 	"github.com/jackc/pgx/v5"
@@ -11,6 +14,7 @@ import (
 	"github.com/oklog/ulid/v2"
 	"github.com/shopspring/decimal"
 
+	"github.com/lrweck/clean-api/internal/event"
 	"github.com/lrweck/clean-api/internal/transfer"
 	"github.com/lrweck/clean-api/pkg/errwrap"
 )
@@ -23,67 +27,185 @@ func NewTxStorage(db *pgxpool.Pool) *TxStorage {
 	return &TxStorage{db}
 }
 
+type txScan struct {
+	ID            ulid.ULID
+	From          ulid.ULID
+	To            ulid.ULID
+	Amount        pgxdecimal.Decimal
+	Status        string
+	CreatedAt     time.Time
+	ExecuteAt     sql.NullTime
+	ProcessedAt   sql.NullTime
+	FailureReason sql.NullString
+
+	StandingOrderID ulid.ULID
+	Occurrence      sql.NullInt32
+}
+
+func (t *txScan) dest() []any {
+	return []any{
+		&t.ID,
+		&t.From,
+		&t.To,
+		&t.Amount,
+		&t.Status,
+		&t.CreatedAt,
+		&t.ExecuteAt,
+		&t.ProcessedAt,
+		&t.FailureReason,
+		&t.StandingOrderID,
+		&t.Occurrence,
+	}
+}
+
+func (t *txScan) transaction() transfer.Transaction {
+	return transfer.Transaction{
+		ID:            t.ID,
+		From:          t.From,
+		To:            t.To,
+		Amount:        decimal.Decimal(t.Amount),
+		Status:        transfer.Status(t.Status),
+		CreatedAt:     t.CreatedAt,
+		ExecuteAt:     t.ExecuteAt.Time,
+		ProcessedAt:   t.ProcessedAt.Time,
+		FailureReason: t.FailureReason.String,
+
+		StandingOrderID: t.StandingOrderID,
+		Occurrence:      int(t.Occurrence.Int32),
+	}
+}
+
 var (
-	insertTxSQL            = "INSERT INTO transaction (id,from_id,to_id,amount,created_at) VALUES ($1,$2,$3,$4,$5)"
+	insertTxSQL = `
+INSERT INTO transaction (id,from_id,to_id,amount,status,created_at,execute_at,processed_at,failure_reason,standing_order_id,occurrence)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`
+
+	insertTxLegSQL = "INSERT INTO transaction_leg (transaction_id,position,to_id,amount) VALUES ($1,$2,$3,$4)"
+
 	increaseAccountBalance = "UPDATE account SET balance = balance + $2, updated_at = NOW() WHERE id = $1"
-	decreaseAccountBalance = "UPDATE account SET balance = balance - $2, updated_at = NOW() WHERE id = $1 RETURNING balance >= $2"
+	decreaseAccountBalance = "UPDATE account SET balance = balance - $2, updated_at = NOW() WHERE id = $1 RETURNING balance >= 0"
+
+	// ids are stored as bytes, which sort like their lexical form
+	lockAccountsSQL = "SELECT id FROM account WHERE id = ANY($1) ORDER BY id FOR UPDATE"
 )
 
-func (s *TxStorage) CreateTx(ctx context.Context, t transfer.Transaction) error {
+// queueInsertTx queues the insertion of the transaction and its legs.
+func queueInsertTx(batch *pgx.Batch, t transfer.Transaction) {
+	batch.Queue(insertTxSQL,
+		t.ID,
+		t.From,
+		nullULID(t.To),
+		t.Amount,
+		t.Status,
+		t.CreatedAt,
+		nullTime(t.ExecuteAt),
+		nullTime(t.ProcessedAt),
+		nullString(t.FailureReason),
+		nullULID(t.StandingOrderID),
+		nullInt(t.Occurrence))
+
+	for i, leg := range t.Legs {
+		batch.Queue(insertTxLegSQL, t.ID, i, leg.To, leg.Amount)
+	}
+}
 
-	amount := pgxdecimal.Decimal(t.Amount)
+func (s *TxStorage) CreateTx(ctx context.Context, t transfer.Transaction, evs ...event.Event) error {
 
 	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
 
-		_, err := tx.Exec(ctx, insertTxSQL, t.ID, t.From, t.To, t.Amount, t.CreatedAt)
-		if err != nil {
+		batch := new(pgx.Batch)
+		queueInsertTx(batch, t)
+		queueOutbox(batch, evs...)
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
 			return fmt.Errorf("failed to insert into transaction table: %w", err)
 		}
 
-		if err := s.transferFundsWithoutDeadlock(ctx, tx, t.From, t.To, amount); err != nil {
+		if err := s.moveFundsWithoutDeadlock(ctx, tx, t.Movements()...); err != nil {
 			return fmt.Errorf("failed to transfer funds: %w", err)
 		}
 
 		return nil
 	})
 
-	return errwrap.WrapIfNotNil(err, "failed to transfer funds in a transaction")
+	return errwrap.WrapIfNotNil(conflictErr(err), "failed to transfer funds in a transaction")
 
 }
 
-func (s *TxStorage) transferFundsWithoutDeadlock(ctx context.Context, tx pgx.Tx, from, to ulid.ULID, amount pgxdecimal.Decimal) error {
+func (s *TxStorage) CreateTxBatch(ctx context.Context, txs []transfer.Transaction, evs ...event.Event) error {
 
-	negativeAmount := pgxdecimal.Decimal(decimal.Decimal(amount).Neg())
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
 
-	// compare it lexically to avoid deadlock
-	if from.String() < to.String() {
+		var ms []transfer.Movement
 
-		if err := s.subtractAccountBalance(ctx, tx, from, negativeAmount); err != nil {
-			return fmt.Errorf("from < to: %w", err)
+		batch := new(pgx.Batch)
+		for _, t := range txs {
+			queueInsertTx(batch, t)
+			ms = append(ms, t.Movements()...)
 		}
+		queueOutbox(batch, evs...)
 
-		if err := s.addAccountBalance(ctx, tx, to, amount); err != nil {
-			return fmt.Errorf("from < to: %w", err)
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to insert batch into transaction table: %w", err)
 		}
 
-	} else {
-
-		if err := s.addAccountBalance(ctx, tx, to, amount); err != nil {
-			return fmt.Errorf("from > to: %w", err)
+		if err := s.moveFundsWithoutDeadlock(ctx, tx, ms...); err != nil {
+			return fmt.Errorf("failed to transfer funds: %w", err)
 		}
 
-		if err := s.subtractAccountBalance(ctx, tx, from, negativeAmount); err != nil {
-			return fmt.Errorf("from > to: %w", err)
-		}
+		return nil
+	})
 
+	return errwrap.WrapIfNotNil(conflictErr(err), "failed to transfer batch funds in a transaction")
+}
+
+// moveFundsWithoutDeadlock applies every movement in order, each covered
+// by the balance left by the ones before it. The involved accounts are
+// locked up front in lexical order of their ids, so concurrent transactions
+// lock rows in the same order and cannot deadlock.
+func (s *TxStorage) moveFundsWithoutDeadlock(ctx context.Context, tx pgx.Tx, ms ...transfer.Movement) error {
+
+	if _, err := tx.Exec(ctx, lockAccountsSQL, lockOrder(ms...)); err != nil {
+		return fmt.Errorf("failed to lock accounts: %w", err)
+	}
+
+	for _, m := range ms {
+		if err := s.subtractAccountBalance(ctx, tx, m.From, pgxdecimal.Decimal(m.Amount)); err != nil {
+			return err
+		}
+		if err := s.addAccountBalance(ctx, tx, m.To, pgxdecimal.Decimal(m.Amount)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// lockOrder returns the accounts moved by ms in lexical order of their ids.
+func lockOrder(ms ...transfer.Movement) []ulid.ULID {
+
+	seen := make(map[ulid.ULID]bool)
+	ids := make([]ulid.ULID, 0, 2*len(ms))
+	for _, m := range ms {
+		for _, id := range []ulid.ULID{m.From, m.To} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	// compare it lexically to avoid deadlock
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	return ids
+}
+
 func (s *TxStorage) addAccountBalance(ctx context.Context, tx pgx.Tx, id ulid.ULID, amount pgxdecimal.Decimal) error {
-	_, err := tx.Exec(ctx, increaseAccountBalance, id, amount)
-	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+	tag, err := tx.Exec(ctx, increaseAccountBalance, id, amount)
+	if err == nil && tag.RowsAffected() == 0 {
 		return transfer.NewErrAccountNotFound(id, "destination")
 	}
 	return errwrap.WrapIfNotNil(err, fmt.Sprintf("failed to increase account %s balance", id))
@@ -109,6 +231,208 @@ func (s *TxStorage) subtractAccountBalance(ctx context.Context, tx pgx.Tx, id ul
 
 }
 
+var (
+	getTxSQL = `
+SELECT id,from_id,to_id,amount,status,created_at,execute_at,processed_at,failure_reason,standing_order_id,occurrence
+  FROM transaction
+ WHERE id = $1`
+
+	getTxLegsSQL = `
+SELECT to_id,amount
+  FROM transaction_leg
+ WHERE transaction_id = $1
+ ORDER BY position`
+)
+
 func (s *TxStorage) GetTx(ctx context.Context, id ulid.ULID) (*transfer.Transaction, error) {
-	panic("not implemented")
+	var t txScan
+	err := s.db.QueryRow(ctx, getTxSQL, id).Scan(t.dest()...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, transfer.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to query transaction by id: %w", err)
+	}
+
+	tx := t.transaction()
+
+	if tx.Legs, err = getTxLegs(ctx, s.db, id); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+func getTxLegs(ctx context.Context, q querier, id ulid.ULID) ([]transfer.Leg, error) {
+	rows, err := q.Query(ctx, getTxLegsSQL, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction legs: %w", err)
+	}
+	defer rows.Close()
+
+	var legs []transfer.Leg
+	for rows.Next() {
+		var (
+			to     ulid.ULID
+			amount pgxdecimal.Decimal
+		)
+		if err := rows.Scan(&to, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction leg: %w", err)
+		}
+		legs = append(legs, transfer.Leg{To: to, Amount: decimal.Decimal(amount)})
+	}
+
+	return legs, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate transaction legs")
+}
+
+var (
+	lockTxStatusSQL = "SELECT status FROM transaction WHERE id = $1 FOR UPDATE"
+
+	cancelTxSQL = "UPDATE transaction SET status = $2, processed_at = $3 WHERE id = $1 AND status = $4"
+
+	getDueTxsSQL = `
+SELECT id,from_id,to_id,amount,status,created_at,execute_at,processed_at,failure_reason,standing_order_id,occurrence
+  FROM transaction
+ WHERE status = $1
+   AND execute_at <= $2
+ ORDER BY execute_at
+ LIMIT $3`
+
+	claimScheduledTxSQL = `
+UPDATE transaction
+   SET status = $2, processed_at = $3
+ WHERE id = $1
+   AND status = $4
+RETURNING from_id,to_id,amount`
+
+	failScheduledTxSQL = `
+UPDATE transaction
+   SET status = $2, processed_at = $3, failure_reason = $4
+ WHERE id = $1
+   AND status = $5`
+)
+
+func (s *TxStorage) ScheduleTx(ctx context.Context, t transfer.Transaction, evs ...event.Event) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		batch := new(pgx.Batch)
+		queueInsertTx(batch, t)
+		queueOutbox(batch, evs...)
+
+		return tx.SendBatch(ctx, batch).Close()
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to insert scheduled transaction")
+}
+
+func (s *TxStorage) CancelTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		var status string
+		if err := tx.QueryRow(ctx, lockTxStatusSQL, id).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return transfer.ErrNotFound
+			}
+			return fmt.Errorf("failed to lock transaction: %w", err)
+		}
+
+		if transfer.Status(status) != transfer.StatusScheduled {
+			return transfer.ErrNotScheduled
+		}
+
+		batch := new(pgx.Batch)
+		batch.Queue(cancelTxSQL, id, transfer.StatusCanceled, at, transfer.StatusScheduled)
+		queueOutbox(batch, evs...)
+
+		return errwrap.WrapIfNotNil(tx.SendBatch(ctx, batch).Close(), "failed to update transaction status")
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to cancel scheduled transaction")
+}
+
+func (s *TxStorage) GetDueTxs(ctx context.Context, until time.Time, limit int) ([]transfer.Transaction, error) {
+	rows, err := s.db.Query(ctx, getDueTxsSQL, transfer.StatusScheduled, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due transactions: %w", err)
+	}
+
+	txs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (transfer.Transaction, error) {
+		var t txScan
+		err := row.Scan(t.dest()...)
+		return t.transaction(), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan due transactions: %w", err)
+	}
+
+	for i := range txs {
+		if txs[i].Legs, err = getTxLegs(ctx, s.db, txs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return txs, nil
+}
+
+// ExecuteScheduledTx moves the funds of a scheduled transaction and marks it
+// as completed. Claiming the row with a conditional update guarantees that
+// concurrent schedulers execute it only once.
+func (s *TxStorage) ExecuteScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, evs ...event.Event) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		var (
+			t      transfer.Transaction
+			amount pgxdecimal.Decimal
+		)
+
+		err := tx.QueryRow(ctx, claimScheduledTxSQL, id, transfer.StatusCompleted, at, transfer.StatusScheduled).
+			Scan(&t.From, &t.To, &amount)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return transfer.ErrNotScheduled
+			}
+			return fmt.Errorf("failed to claim scheduled transaction: %w", err)
+		}
+
+		t.Amount = decimal.Decimal(amount)
+		if t.Legs, err = getTxLegs(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if err := s.moveFundsWithoutDeadlock(ctx, tx, t.Movements()...); err != nil {
+			return fmt.Errorf("failed to transfer funds: %w", err)
+		}
+
+		batch := new(pgx.Batch)
+		queueOutbox(batch, evs...)
+
+		return errwrap.WrapIfNotNil(tx.SendBatch(ctx, batch).Close(), "failed to insert into outbox")
+	})
+
+	return errwrap.WrapIfNotNil(conflictErr(err), "failed to execute scheduled transaction")
+}
+
+func (s *TxStorage) FailScheduledTx(ctx context.Context, id ulid.ULID, at time.Time, reason string, evs ...event.Event) error {
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+
+		tag, err := tx.Exec(ctx, failScheduledTxSQL, id, transfer.StatusFailed, at, reason, transfer.StatusScheduled)
+		if err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return transfer.ErrNotScheduled
+		}
+
+		batch := new(pgx.Batch)
+		queueOutbox(batch, evs...)
+
+		return errwrap.WrapIfNotNil(tx.SendBatch(ctx, batch).Close(), "failed to insert into outbox")
+	})
+
+	return errwrap.WrapIfNotNil(err, "failed to mark scheduled transaction as failed")
 }
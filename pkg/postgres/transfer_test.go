@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+func TestLockOrderIsLexical(t *testing.T) {
+	a := ulid.MustParse("01H7000000000000000000000A")
+	b := ulid.MustParse("01H7000000000000000000000B")
+	c := ulid.MustParse("01H7000000000000000000000C")
+
+	ids := lockOrder(
+		transfer.Movement{From: c, To: b, Amount: decimal.NewFromInt(10)},
+		transfer.Movement{From: b, To: a, Amount: decimal.NewFromInt(4)},
+		transfer.Movement{From: a, To: c, Amount: decimal.NewFromInt(1)},
+	)
+
+	if len(ids) != 3 || ids[0] != a || ids[1] != b || ids[2] != c {
+		t.Fatalf("expected each account once in lexical order, got %v", ids)
+	}
+}
@@ -0,0 +1,316 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/webhook"
+	"github.com/lrweck/clean-api/pkg/errwrap"
+)
+
+type WebhookStorage struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookStorage(db *pgxpool.Pool) *WebhookStorage {
+	return &WebhookStorage{db}
+}
+
+type subscriptionScan struct {
+	ID         ulid.ULID
+	URL        string
+	EventTypes []string
+	Accounts   []ulid.ULID
+	Secret     string
+	CreatedAt  time.Time
+}
+
+func (s *subscriptionScan) dest() []any {
+	return []any{
+		&s.ID,
+		&s.URL,
+		&s.EventTypes,
+		&s.Accounts,
+		&s.Secret,
+		&s.CreatedAt,
+	}
+}
+
+func (s *subscriptionScan) subscription() webhook.Subscription {
+	types := make([]event.Type, len(s.EventTypes))
+	for i, t := range s.EventTypes {
+		types[i] = event.Type(t)
+	}
+
+	return webhook.Subscription{
+		ID:         s.ID,
+		URL:        s.URL,
+		EventTypes: types,
+		Accounts:   s.Accounts,
+		Secret:     s.Secret,
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+type deliveryScan struct {
+	ID             ulid.ULID
+	SubscriptionID ulid.ULID
+	EventID        ulid.ULID
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+	CreatedAt      time.Time
+	DeliveredAt    sql.NullTime
+}
+
+func (d *deliveryScan) dest() []any {
+	return []any{
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	}
+}
+
+func (d *deliveryScan) delivery() webhook.Delivery {
+	return webhook.Delivery{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      event.Type(d.EventType),
+		Payload:        d.Payload,
+		Status:         webhook.DeliveryStatus(d.Status),
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastAttemptAt:  d.LastAttemptAt.Time,
+		LastStatusCode: int(d.LastStatusCode.Int32),
+		LastError:      d.LastError.String,
+		CreatedAt:      d.CreatedAt,
+		DeliveredAt:    d.DeliveredAt.Time,
+	}
+}
+
+const deliveryColumns = "id,subscription_id,event_id,event_type,payload,status,attempts,next_attempt_at,last_attempt_at,last_status_code,last_error,created_at,delivered_at"
+
+var (
+	insertSubscriptionSQL = `
+INSERT INTO webhook_subscription (id,url,event_types,account_ids,secret,created_at)
+VALUES ($1,$2,$3,$4,$5,$6)`
+
+	getSubscriptionSQL = `
+SELECT id,url,event_types,account_ids,secret,created_at
+  FROM webhook_subscription
+ WHERE id = $1`
+
+	// deliveries keep their subscription id so the log outlives it
+	deleteSubscriptionSQL = "DELETE FROM webhook_subscription WHERE id = $1"
+
+	findSubscriptionsSQL = `
+SELECT id,url,event_types,account_ids,secret,created_at
+  FROM webhook_subscription
+ WHERE $1 = ANY(event_types)
+   AND account_ids && $2`
+
+	// the unique index on (subscription_id, event_id) drops deliveries of
+	// republished events
+	insertDeliverySQL = `
+INSERT INTO webhook_delivery (id,subscription_id,event_id,event_type,payload,status,attempts,next_attempt_at,created_at)
+VALUES ($1,$2,$3,$4,$5,$6,0,$7,$8)
+ON CONFLICT (subscription_id, event_id) DO NOTHING`
+
+	getDeliverySQL = `
+SELECT ` + deliveryColumns + `
+  FROM webhook_delivery
+ WHERE id = $1`
+
+	// rows claimed by a concurrent worker are skipped rather than waited
+	// for, and are no longer due once its claim commits
+	claimDueDeliveriesSQL = `
+UPDATE webhook_delivery
+   SET next_attempt_at = $4
+ WHERE id IN (
+       SELECT id
+         FROM webhook_delivery
+        WHERE status = $1
+          AND next_attempt_at <= $2
+        ORDER BY next_attempt_at
+        LIMIT $3
+          FOR UPDATE SKIP LOCKED)
+RETURNING ` + deliveryColumns
+
+	listDeliveriesSQL = `
+SELECT ` + deliveryColumns + `
+  FROM webhook_delivery
+ WHERE subscription_id = $1
+ ORDER BY id DESC
+ LIMIT $2`
+
+	updateDeliverySQL = `
+UPDATE webhook_delivery
+   SET status = $2, attempts = $3, next_attempt_at = $4, last_attempt_at = $5,
+       last_status_code = $6, last_error = $7, delivered_at = $8
+ WHERE id = $1`
+)
+
+func (s *WebhookStorage) CreateSubscription(ctx context.Context, sub webhook.Subscription) error {
+	_, err := s.db.Exec(ctx, insertSubscriptionSQL,
+		sub.ID,
+		sub.URL,
+		sub.EventTypes,
+		sub.Accounts,
+		sub.Secret,
+		sub.CreatedAt)
+
+	return errwrap.WrapIfNotNil(err, "failed to insert into webhook_subscription table")
+}
+
+func (s *WebhookStorage) GetSubscription(ctx context.Context, id ulid.ULID) (*webhook.Subscription, error) {
+	var sc subscriptionScan
+	err := s.db.QueryRow(ctx, getSubscriptionSQL, id).Scan(sc.dest()...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, webhook.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to query webhook subscription by id: %w", err)
+	}
+
+	sub := sc.subscription()
+	return &sub, nil
+}
+
+func (s *WebhookStorage) DeleteSubscription(ctx context.Context, id ulid.ULID) error {
+	tag, err := s.db.Exec(ctx, deleteSubscriptionSQL, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete from webhook_subscription table: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return webhook.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *WebhookStorage) FindSubscriptions(ctx context.Context, typ event.Type, accounts []ulid.ULID) ([]webhook.Subscription, error) {
+	rows, err := s.db.Query(ctx, findSubscriptionsSQL, typ, accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []webhook.Subscription
+	for rows.Next() {
+		var sc subscriptionScan
+		if err := rows.Scan(sc.dest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sc.subscription())
+	}
+
+	return subs, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate webhook subscriptions")
+}
+
+func (s *WebhookStorage) CreateDeliveries(ctx context.Context, ds []webhook.Delivery) error {
+	batch := new(pgx.Batch)
+	for _, d := range ds {
+		batch.Queue(insertDeliverySQL,
+			d.ID,
+			d.SubscriptionID,
+			d.EventID,
+			d.EventType,
+			d.Payload,
+			d.Status,
+			d.NextAttemptAt,
+			d.CreatedAt)
+	}
+
+	err := s.db.SendBatch(ctx, batch).Close()
+
+	return errwrap.WrapIfNotNil(err, "failed to insert into webhook_delivery table")
+}
+
+func (s *WebhookStorage) GetDelivery(ctx context.Context, id ulid.ULID) (*webhook.Delivery, error) {
+	var dc deliveryScan
+	err := s.db.QueryRow(ctx, getDeliverySQL, id).Scan(dc.dest()...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, webhook.ErrDeliveryNotFound
+		}
+		return nil, fmt.Errorf("failed to query webhook delivery by id: %w", err)
+	}
+
+	d := dc.delivery()
+	return &d, nil
+}
+
+func (s *WebhookStorage) ClaimDueDeliveries(ctx context.Context, until, lease time.Time, limit int) ([]webhook.Delivery, error) {
+	return s.queryDeliveries(ctx, claimDueDeliveriesSQL, webhook.DeliveryPending, until, limit, lease)
+}
+
+func (s *WebhookStorage) ListDeliveries(ctx context.Context, subscription ulid.ULID, limit int) ([]webhook.Delivery, error) {
+	return s.queryDeliveries(ctx, listDeliveriesSQL, subscription, limit)
+}
+
+func (s *WebhookStorage) queryDeliveries(ctx context.Context, query string, args ...any) ([]webhook.Delivery, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var ds []webhook.Delivery
+	for rows.Next() {
+		var dc deliveryScan
+		if err := rows.Scan(dc.dest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		ds = append(ds, dc.delivery())
+	}
+
+	return ds, errwrap.WrapIfNotNil(rows.Err(), "failed to iterate webhook deliveries")
+}
+
+func (s *WebhookStorage) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	tag, err := s.db.Exec(ctx, updateDeliverySQL,
+		d.ID,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		nullTime(d.LastAttemptAt),
+		nullInt(d.LastStatusCode),
+		nullString(d.LastError),
+		nullTime(d.DeliveredAt))
+	if err != nil {
+		return fmt.Errorf("failed to update webhook_delivery table: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return webhook.ErrDeliveryNotFound
+	}
+
+	return nil
+}
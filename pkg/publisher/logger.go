@@ -0,0 +1,30 @@
+package publisher
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+// Logger publishes events by logging them, useful when no broker is set up.
+// Payloads carry personal data, such as documents, so only what identifies
+// an event is logged.
+type Logger struct {
+	logger *slog.Logger
+}
+
+func NewLogger(logger *slog.Logger) *Logger {
+	return &Logger{logger}
+}
+
+func (p *Logger) Publish(ctx context.Context, e event.Event) error {
+	p.logger.LogAttrs(ctx, slog.LevelInfo, "event published",
+		slog.String("event.id", e.ID.String()),
+		slog.String("event.type", string(e.Type)),
+		slog.String("event.aggregate_id", e.AggregateID.String()),
+		slog.Time("event.occurred_at", e.OccurredAt),
+	)
+	return nil
+}
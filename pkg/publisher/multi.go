@@ -0,0 +1,25 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lrweck/clean-api/internal/event"
+)
+
+// Multi publishes every event to all of its publishers. Publishers that
+// already succeeded see the event again when another one fails and the
+// relay retries it, which at least once delivery allows.
+type Multi []event.Publisher
+
+func NewMulti(ps ...event.Publisher) Multi {
+	return Multi(ps)
+}
+
+func (m Multi) Publish(ctx context.Context, e event.Event) error {
+	errs := make([]error, 0, len(m))
+	for _, p := range m {
+		errs = append(errs, p.Publish(ctx, e))
+	}
+	return errors.Join(errs...)
+}
@@ -2,7 +2,6 @@ package rest
 
 import (
 	"context"
-	"errors"
 	"net/http"
 	"time"
 
@@ -24,6 +23,7 @@ type GETAccountResponse struct {
 	Name      string          `json:"name"`
 	Document  string          `json:"document"`
 	Balance   decimal.Decimal `json:"starting_balance"`
+	Owner     string          `json:"owner,omitempty"`
 	CreatedAt time.Time       `json:"created_at"`
 	UpdateAt  time.Time       `json:"updated_at,omitempty"`
 }
@@ -45,44 +45,36 @@ func V1_POST_Account(svc AccountService) echo.HandlerFunc {
 			Name:            req.Name,
 			Document:        req.Document,
 			StartingBalance: req.StartingBalance,
+			Owner:           subjectOf(ctx),
 		})
 
 		if err != nil {
-			return handlePostAccountErrors(c, err)
+			return err
 		}
 
-		return c.JSON(http.StatusCreated, echo.Map{
-			"id": id,
-		})
+		return respond(c, http.StatusCreated, CreatedResponse{ID: id.String()})
 	}
 }
 
-func handlePostAccountErrors(c echo.Context, err error) error {
-
-	if errval := new(account.ErrValidation); errors.As(err, &errval) {
-		c.JSON(http.StatusBadRequest, NewUserError(errval.Error(), errval.Errors()))
-		return err
-	}
-
-	c.JSON(http.StatusInternalServerError, ErrInternalServerError)
-	return err
-}
-
 func V1_GET_Account(svc AccountService) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
 		id := c.Param("id")
 
 		if _, err := ulid.ParseStrict(id); err != nil {
-			c.JSON(http.StatusBadRequest, ErrInvalidAccountID)
-			return err
+			return ProblemInvalidID.Wrap(err)
 		}
 
 		ctx := c.Request().Context()
 
 		acc, err := svc.Retrieve(ctx, id)
 		if err != nil {
-			return handleGetAccountErrors(c, err)
+			return err
+		}
+
+		// accounts of other users are hidden, not forbidden
+		if !owns(ctx, acc.Owner) {
+			return account.ErrNotFound
 		}
 
 		response := GETAccountResponse{
@@ -90,44 +82,11 @@ func V1_GET_Account(svc AccountService) echo.HandlerFunc {
 			Name:      acc.Name,
 			Document:  acc.Document,
 			Balance:   acc.Balance,
+			Owner:     acc.Owner,
 			CreatedAt: acc.CreatedAt,
 			UpdateAt:  acc.UpdateAt,
 		}
 
-		return c.JSON(http.StatusOK, response)
-	}
-}
-
-func handleGetAccountErrors(c echo.Context, err error) error {
-
-	if errors.Is(err, account.ErrNotFound) {
-		c.JSON(http.StatusNotFound, ErrAccountNotFound)
-		return err
-	}
-
-	c.JSON(http.StatusInternalServerError, ErrInternalServerError)
-	return err
-
-}
-
-var (
-	ErrInvalidAccountID = echo.Map{
-		"message": "invalid account id",
-		"details": []string{"must be a valid uuid"},
-	}
-
-	ErrAccountNotFound = echo.Map{
-		"message": "account not found",
-	}
-
-	ErrInternalServerError = echo.Map{
-		"message": http.StatusText(http.StatusInternalServerError),
-	}
-)
-
-func NewUserError(msg string, details []string) echo.Map {
-	return echo.Map{
-		"message": msg,
-		"details": details,
+		return respond(c, http.StatusOK, response)
 	}
 }
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/activity"
+)
+
+type ActivityFeed interface {
+	Watch(account ulid.ULID, after *uint64) (*activity.Watcher, []activity.Activity)
+}
+
+// V1_GET_AccountEvents streams the activity of an account as Server-Sent
+// Events. Clients resuming with a Last-Event-ID header first receive the
+// retained activities they missed. Heartbeat comments keep proxies from
+// closing idle streams; a heartbeat of zero or less disables them. Streams
+// end when closing is closed, so that they do not hold up the shutdown of
+// the server.
+//
+// The stream is best-effort and meant for a single instance: the feed only
+// carries the events relayed by this one, and event ids are only
+// meaningful to the instance, and the run, that issued them.
+func V1_GET_AccountEvents(svc AccountService, feed ActivityFeed, heartbeat time.Duration, closing <-chan struct{}) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id := c.Param("id")
+
+		accountID, err := ulid.ParseStrict(id)
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		acc, err := svc.Retrieve(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if !owns(ctx, acc.Owner) {
+			return account.ErrNotFound
+		}
+
+		var after *uint64
+		if last, err := strconv.ParseUint(c.Request().Header.Get("Last-Event-ID"), 10, 64); err == nil {
+			after = &last
+		}
+
+		w, backlog := feed.Watch(accountID, after)
+		defer w.Close()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		// disables response buffering in nginx
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+
+		for _, act := range backlog {
+			if err := writeActivity(res, act); err != nil {
+				return err
+			}
+		}
+		res.Flush()
+
+		var heartbeats <-chan time.Time
+		if heartbeat > 0 {
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			heartbeats = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-closing:
+				return nil
+			case act, ok := <-w.C:
+				if !ok {
+					// fell too far behind; the client resumes from the history
+					return nil
+				}
+				if err := writeActivity(res, act); err != nil {
+					return err
+				}
+			case <-heartbeats:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return err
+				}
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeActivity(res *echo.Response, act activity.Activity) error {
+	_, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", act.ID, act.Kind, act.Data)
+	return err
+}
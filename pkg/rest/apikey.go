@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+)
+
+type POSTAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type GETAPIKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeyService interface {
+	New(ctx context.Context, n apikey.NewKey) (*apikey.Key, string, error)
+	Retrieve(ctx context.Context, id ulid.ULID) (*apikey.Key, error)
+	List(ctx context.Context) ([]apikey.Key, error)
+	Revoke(ctx context.Context, id ulid.ULID) error
+}
+
+func V1_POST_APIKey(svc APIKeyService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req POSTAPIKeyRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		scopes := make([]auth.Scope, len(req.Scopes))
+		for i, s := range req.Scopes {
+			scopes[i] = auth.Scope(s)
+		}
+
+		ctx := c.Request().Context()
+		k, secret, err := svc.New(ctx, apikey.NewKey{
+			Name:   req.Name,
+			Scopes: scopes,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// the key is only ever returned on creation
+		response := newAPIKeyResponse(k)
+		response.Key = secret
+
+		return respond(c, http.StatusCreated, response)
+	}
+}
+
+func V1_GET_APIKeys(svc APIKeyService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		ctx := c.Request().Context()
+
+		ks, err := svc.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		response := make([]GETAPIKeyResponse, len(ks))
+		for i := range ks {
+			response[i] = newAPIKeyResponse(&ks[i])
+		}
+
+		return respond(c, http.StatusOK, echo.Map{
+			"keys": response,
+		})
+	}
+}
+
+func V1_GET_APIKey(svc APIKeyService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		k, err := svc.Retrieve(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusOK, newAPIKeyResponse(k))
+	}
+}
+
+// V1_DELETE_APIKey revokes a key. Revoked keys stay listed for auditing.
+func V1_DELETE_APIKey(svc APIKeyService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if err := svc.Revoke(ctx, id); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func newAPIKeyResponse(k *apikey.Key) GETAPIKeyResponse {
+	scopes := make([]string, len(k.Scopes))
+	for i, s := range k.Scopes {
+		scopes[i] = string(s)
+	}
+
+	return GETAPIKeyResponse{
+		ID:        k.ID.String(),
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    scopes,
+		CreatedAt: k.CreatedAt,
+		RevokedAt: timeOrNil(k.RevokedAt),
+	}
+}
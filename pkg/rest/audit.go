@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/lrweck/clean-api/internal/audit"
+)
+
+type GETAuditEntryResponse struct {
+	Seq       int64     `json:"seq"`
+	ID        string    `json:"id"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	Action    string    `json:"action"`
+	Targets   []string  `json:"targets"`
+	Before    any       `json:"before,omitempty"`
+	After     any       `json:"after,omitempty"`
+	PrevHash  string    `json:"prev_hash,omitempty"`
+	Hash      string    `json:"hash"`
+}
+
+type GETAuditVerificationResponse struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	Head    string `json:"head,omitempty"`
+	// BrokenAt is the first entry that does not link to the chain.
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AuditLog interface {
+	List(ctx context.Context, f audit.Filter) ([]audit.Entry, error)
+	Verify(ctx context.Context) (audit.Verification, error)
+}
+
+// V1_GET_AuditEntries lists the audit log, oldest first. Pages follow each
+// other by passing the seq of the last entry of a page as after.
+func V1_GET_AuditEntries(log AuditLog) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		f := audit.Filter{
+			Actor:  c.QueryParam("actor"),
+			Action: audit.Action(c.QueryParam("action")),
+			Target: c.QueryParam("target"),
+			Limit:  audit.MaxListLimit,
+		}
+
+		var errs []error
+		for param, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+			if v := c.QueryParam(param); v != "" {
+				at, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invalid %s %q, expected an RFC 3339 date", param, v))
+				}
+				*t = at
+			}
+		}
+
+		if v := c.QueryParam("after"); v != "" {
+			after, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || after < 0 {
+				errs = append(errs, fmt.Errorf("invalid after %q, expected the seq of an entry", v))
+			}
+			f.AfterSeq = after
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return ProblemInvalidAuditQuery.Wrap(err)
+		}
+
+		if l := c.QueryParam("limit"); l != "" {
+			limit, err := strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > audit.MaxListLimit {
+				pe := ProblemInvalidLimit.Wrap(fmt.Errorf("invalid audit log limit %q", l))
+				pe.Detail = "must be between 1 and " + strconv.Itoa(audit.MaxListLimit)
+				return pe
+			}
+			f.Limit = limit
+		}
+
+		ctx := c.Request().Context()
+
+		es, err := log.List(ctx, f)
+		if err != nil {
+			return err
+		}
+
+		response := make([]GETAuditEntryResponse, len(es))
+		for i, e := range es {
+			response[i] = GETAuditEntryResponse{
+				Seq:       e.Seq,
+				ID:        e.ID.String(),
+				At:        e.At,
+				Actor:     e.Actor,
+				RequestID: e.RequestID,
+				Action:    string(e.Action),
+				Targets:   e.Targets,
+				Before:    auditState(e.Before),
+				After:     auditState(e.After),
+				PrevHash:  e.PrevHash,
+				Hash:      e.Hash,
+			}
+		}
+
+		return respond(c, http.StatusOK, echo.Map{
+			"entries": response,
+		})
+	}
+}
+
+// auditState decodes a recorded state, so that every codec encodes it as a
+// document rather than as raw bytes. Numbers are kept as they were written.
+func auditState(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return string(raw)
+	}
+	return v
+}
+
+// V1_GET_AuditVerification verifies the hash chain of the whole audit log.
+// A broken chain is a finding rather than a failure of the request.
+func V1_GET_AuditVerification(log AuditLog) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		ctx := c.Request().Context()
+
+		v, err := log.Verify(ctx)
+		response := GETAuditVerificationResponse{Valid: err == nil, Entries: v.Entries, Head: v.Head}
+
+		if broken := new(audit.ErrBrokenChain); errors.As(err, &broken) {
+			response.BrokenAt = broken.Seq
+			response.Reason = broken.Reason
+		} else if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusOK, response)
+	}
+}
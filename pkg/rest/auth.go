@@ -0,0 +1,156 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/exp/slog"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// HeaderAPIKey carries an API key for clients that cannot set the
+// Authorization header.
+const HeaderAPIKey = "X-API-Key"
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, secret string) (*auth.Principal, error)
+}
+
+// Authenticate resolves the credentials of the request and attaches their
+// principal to the request context and to the request-scoped logger.
+// Services send an API key, as a bearer token or in the X-API-Key header;
+// end users send a JWT bearer token, verified by tokens. A nil tokens
+// accepts API keys only.
+func Authenticate(keys, tokens Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+
+			secret := auth.SecretOf(req.Header.Get(echo.HeaderAuthorization), req.Header.Get(HeaderAPIKey))
+
+			authn := keys
+			if tokens != nil && auth.IsJWT(secret) {
+				authn = tokens
+			}
+
+			p, err := authn.Authenticate(ctx, secret)
+			if err != nil {
+				switch {
+				case errors.Is(err, apikey.ErrMissingKey), errors.Is(err, apikey.ErrInvalidKey):
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="clean-api"`)
+				case errors.Is(err, auth.ErrInvalidToken):
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="clean-api", error="invalid_token"`)
+				}
+				return err
+			}
+
+			attr := slog.String("api-key", p.KeyID.String())
+			if p.Subject != "" {
+				attr = slog.String("subject", p.Subject)
+			}
+
+			ctx = auth.ContextWithPrincipal(ctx, p)
+			ctx = context.WithValue(ctx, slogger.LoggerKey, slogger.FromContext(ctx).With(attr))
+
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects requests whose principal was not granted scope. It
+// must run after Authenticate.
+func RequireScope(scope auth.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := auth.PrincipalFromContext(c.Request().Context())
+			if !ok {
+				return apikey.ErrMissingKey
+			}
+
+			if !p.Has(scope) {
+				pe := ProblemForbidden.Wrap(fmt.Errorf("%s lacks the %s scope", p.Name, scope))
+				pe.Detail = fmt.Sprintf("requires the %s scope", scope)
+				return pe
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// owns reports whether the caller of ctx may act on an account of owner.
+// Requests without a principal were not authenticated by design.
+func owns(ctx context.Context, owner string) bool {
+	p, ok := auth.PrincipalFromContext(ctx)
+	return !ok || p.Owns(owner)
+}
+
+// subjectOf returns the end user calling, empty for services.
+func subjectOf(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// authorizeAccount returns auth.ErrNotOwner when the caller of ctx may not
+// act on account id. Unknown accounts are reported alike, so that users
+// cannot probe for the ids of others.
+func authorizeAccount(ctx context.Context, accounts AccountService, id ulid.ULID) error {
+	if subjectOf(ctx) == "" {
+		return nil
+	}
+
+	acc, err := accounts.Retrieve(ctx, id.String())
+	if errors.Is(err, account.ErrNotFound) {
+		return auth.ErrNotOwner
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !owns(ctx, acc.Owner) {
+		return auth.ErrNotOwner
+	}
+
+	return nil
+}
+
+// authorizeAccounts is authorizeAccount for every account of ids. End users
+// may not act on every account at once, which no ids stands for.
+func authorizeAccounts(ctx context.Context, accounts AccountService, ids []ulid.ULID) error {
+	if subjectOf(ctx) == "" {
+		return nil
+	}
+
+	if len(ids) == 0 {
+		return auth.ErrNotOwner
+	}
+
+	for _, id := range ids {
+		if err := authorizeAccount(ctx, accounts, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hideUnowned reports auth.ErrNotOwner as notFound, so that the transfers,
+// standing orders and webhooks of other users are hidden, not forbidden.
+func hideUnowned(err, notFound error) error {
+	if errors.Is(err, auth.ErrNotOwner) {
+		return notFound
+	}
+	return err
+}
@@ -0,0 +1,324 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/internal/webhook"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+func TestAuthenticateEnforcesScopes(t *testing.T) {
+	ctx := context.Background()
+	keys := apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil)
+
+	_, reader, _ := keys.New(ctx, apikey.NewKey{Name: "reader", Scopes: []auth.Scope{auth.ScopeAccountsRead}})
+	_, admin, _ := keys.New(ctx, apikey.NewKey{Name: "admin", Scopes: []auth.Scope{auth.ScopeAdmin}})
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+
+	ok := func(c echo.Context) error {
+		p, _ := auth.PrincipalFromContext(c.Request().Context())
+		return c.String(http.StatusOK, p.Name)
+	}
+
+	g := e.Group("", Authenticate(keys, nil))
+	g.GET("/read", ok, RequireScope(auth.ScopeAccountsRead))
+	g.POST("/write", ok, RequireScope(auth.ScopeAccountsWrite))
+
+	tests := []struct {
+		name, method, path string
+		header, value      string
+		status             int
+	}{
+		{"no key", http.MethodGet, "/read", "", "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/read", echo.HeaderAuthorization, "Bearer cak_nope", http.StatusUnauthorized},
+		{"bearer", http.MethodGet, "/read", echo.HeaderAuthorization, "Bearer " + reader, http.StatusOK},
+		{"header", http.MethodGet, "/read", HeaderAPIKey, reader, http.StatusOK},
+		{"missing scope", http.MethodPost, "/write", HeaderAPIKey, reader, http.StatusForbidden},
+		{"admin", http.MethodPost, "/write", echo.HeaderAuthorization, "bearer " + admin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+
+			if tt.status == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+				t.Fatal("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// tokenStub authenticates the end users of fixed tokens.
+type tokenStub map[string]string
+
+func (s tokenStub) Authenticate(_ context.Context, token string) (*auth.Principal, error) {
+	sub, ok := s[token]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Principal{Subject: sub, Name: sub, Scopes: []auth.Scope{
+		auth.ScopeAccountsRead, auth.ScopeAccountsWrite, auth.ScopeTransfersWrite,
+	}}, nil
+}
+
+type transferStub struct{ TransferService }
+
+func (transferStub) New(context.Context, transfer.NewTx) (ulid.ULID, error) {
+	return ulid.Make(), nil
+}
+
+func (transferStub) NewBatch(_ context.Context, txs []transfer.NewTx, _ transfer.BatchMode) ([]transfer.BatchResult, error) {
+	results := make([]transfer.BatchResult, len(txs))
+	for i, tx := range txs {
+		if tx.From == (ulid.ULID{}) {
+			results[i].Err = transfer.ErrInvalidAmount
+			continue
+		}
+		results[i].ID = ulid.Make()
+	}
+	return results, nil
+}
+
+func TestEndUsersOnlyActOnTheirAccounts(t *testing.T) {
+	ctx := context.Background()
+	keys := apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil)
+	accounts := account.NewService(memorydb.NewAccountStorage(), account.Options{})
+
+	_, service, _ := keys.New(ctx, apikey.NewKey{Name: "service", Scopes: []auth.Scope{auth.ScopeAdmin}})
+	tokens := tokenStub{"alice.token.sig": "alice", "bob.token.sig": "bob"}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+
+	g := e.Group("", Authenticate(keys, tokens))
+	g.POST("/accounts", V1_POST_Account(accounts))
+	g.GET("/accounts/:id", V1_GET_Account(accounts))
+	g.POST("/transfers", V1_POST_Transfer(transferStub{}, accounts))
+	g.POST("/transfers/batch", V1_POST_TransferBatch(transferStub{}, accounts))
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	alice, err := accounts.New(ctx, account.NewAccount{Name: "Alice", Document: "1", StartingBalance: decimal.NewFromInt(10), Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(http.MethodPost, "/accounts", "bob.token.sig", `{"name":"Bob","document":"2"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("failed to create an account: %d %s", rec.Code, rec.Body)
+	}
+
+	var created CreatedResponse
+	if err := goccy.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	if acc, _ := accounts.Retrieve(ctx, created.ID); acc == nil || acc.Owner != "bob" {
+		t.Fatalf("expected the account to be owned by its creator, got %+v", acc)
+	}
+
+	transferFrom := func(from string) string {
+		return `{"from":"` + from + `","to":"` + created.ID + `","amount":1}`
+	}
+
+	batch := func(mode string) string {
+		return `{"mode":"` + mode + `","transfers":[` + transferFrom(created.ID) + `,` + transferFrom(alice.String()) + `]}`
+	}
+
+	tests := []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{"owner reads", http.MethodGet, "/accounts/" + alice.String(), "alice.token.sig", "", http.StatusOK},
+		{"other user reads", http.MethodGet, "/accounts/" + alice.String(), "bob.token.sig", "", http.StatusNotFound},
+		{"service reads", http.MethodGet, "/accounts/" + alice.String(), service, "", http.StatusOK},
+		{"owner transfers", http.MethodPost, "/transfers", "alice.token.sig", transferFrom(alice.String()), http.StatusCreated},
+		{"other user transfers", http.MethodPost, "/transfers", "bob.token.sig", transferFrom(alice.String()), http.StatusForbidden},
+		{"unknown account", http.MethodPost, "/transfers", "bob.token.sig", transferFrom(ulid.Make().String()), http.StatusForbidden},
+		{"service transfers", http.MethodPost, "/transfers", service, transferFrom(alice.String()), http.StatusCreated},
+		{"atomic batch", http.MethodPost, "/transfers/batch", "bob.token.sig", batch("atomic"), http.StatusForbidden},
+		{"invalid token", http.MethodGet, "/accounts/" + alice.String(), "mallory.token.sig", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestPartialBatchSkipsAccountsOfOthers(t *testing.T) {
+	ctx := context.Background()
+	accounts := account.NewService(memorydb.NewAccountStorage(), account.Options{})
+
+	own, _ := accounts.New(ctx, account.NewAccount{Name: "Bob", Document: "2", Owner: "bob"})
+	other, _ := accounts.New(ctx, account.NewAccount{Name: "Alice", Document: "1", Owner: "alice"})
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/transfers/batch", V1_POST_TransferBatch(transferStub{}, accounts),
+		Authenticate(apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil), tokenStub{"bob.token.sig": "bob"}))
+
+	body := `{"mode":"partial","transfers":[` +
+		`{"from":"` + own.String() + `","to":"` + other.String() + `","amount":1},` +
+		`{"from":"` + other.String() + `","to":"` + own.String() + `","amount":1}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/transfers/batch", strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer bob.token.sig")
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var res POSTTransferBatchResponse
+	if err := goccy.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res.Results) != 2 {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+
+	if res.Results[0].Status != http.StatusCreated {
+		t.Errorf("expected the owned transfer to be created, got %+v", res.Results[0])
+	}
+
+	if r := res.Results[1]; r.Status != http.StatusForbidden || r.Error == nil || r.Error.Code != ProblemAccountNotOwned.Code {
+		t.Errorf("expected the transfer of another user to be refused, got %+v", r)
+	}
+}
+
+func TestEndUsersOnlySeeTheirTransfersOrdersAndWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	accStorage := memorydb.NewAccountStorage()
+	txStorage := memorydb.NewTxStorage(accStorage)
+
+	accounts := account.NewService(accStorage, account.Options{})
+	transfers := transfer.NewService(txStorage, transfer.Options{})
+	orders := standingorder.NewService(memorydb.NewStandingOrderStorage(txStorage), standingorder.Options{})
+	webhooks := webhook.NewService(memorydb.NewWebhookStorage(), webhook.Options{})
+
+	alice, _ := accounts.New(ctx, account.NewAccount{Name: "Alice", Document: "1", StartingBalance: decimal.NewFromInt(10), Owner: "alice"})
+	bob, _ := accounts.New(ctx, account.NewAccount{Name: "Bob", Document: "2", Owner: "bob"})
+
+	scheduled, err := transfers.New(ctx, transfer.NewTx{From: alice, To: bob, Amount: decimal.NewFromInt(1), ExecuteAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := orders.New(ctx, standingorder.NewOrder{From: alice, To: bob, Amount: decimal.NewFromInt(1), Frequency: standingorder.Monthly})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := webhooks.New(ctx, webhook.NewSubscription{URL: "https://example.com/hooks", EventTypes: []event.Type{event.TransferCompleted}, Accounts: []ulid.ULID{alice}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+
+	g := e.Group("", Authenticate(apikey.NewService(memorydb.NewAPIKeyStorage(), nil, nil), tokenStub{"alice.token.sig": "alice", "bob.token.sig": "bob"}))
+	g.GET("/transfers/:id", V1_GET_Transfer(transfers, accounts))
+	g.POST("/transfers/:id/cancel", V1_POST_CancelTransfer(transfers, accounts))
+	g.POST("/standing-orders", V1_POST_StandingOrder(orders, accounts))
+	g.GET("/standing-orders/:id", V1_GET_StandingOrder(orders, accounts))
+	g.POST("/standing-orders/:id/cancel", V1_POST_CancelStandingOrder(orders, accounts))
+	g.POST("/webhooks", V1_POST_Webhook(webhooks, accounts))
+	g.GET("/webhooks/:id", V1_GET_Webhook(webhooks, accounts))
+	g.GET("/webhooks/:id/deliveries", V1_GET_WebhookDeliveries(webhooks, accounts))
+	g.DELETE("/webhooks/:id", V1_DELETE_Webhook(webhooks, accounts))
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	orderFrom := func(from ulid.ULID) string {
+		return `{"from":"` + from.String() + `","to":"` + bob.String() + `","amount":1,"frequency":"monthly"}`
+	}
+
+	webhookOf := func(accounts ...string) string {
+		b, _ := goccy.Marshal(map[string]any{"url": "https://example.com/hooks", "events": []event.Type{event.TransferCompleted}, "accounts": accounts})
+		return string(b)
+	}
+
+	// requests of the other user go first, so that nothing is canceled or
+	// deleted before the owner checks it
+	tests := []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{"other user reads transfer", http.MethodGet, "/transfers/" + scheduled.String(), "bob.token.sig", "", http.StatusNotFound},
+		{"other user cancels transfer", http.MethodPost, "/transfers/" + scheduled.String() + "/cancel", "bob.token.sig", "", http.StatusNotFound},
+		{"owner reads transfer", http.MethodGet, "/transfers/" + scheduled.String(), "alice.token.sig", "", http.StatusOK},
+		{"owner cancels transfer", http.MethodPost, "/transfers/" + scheduled.String() + "/cancel", "alice.token.sig", "", http.StatusNoContent},
+
+		{"other user orders", http.MethodPost, "/standing-orders", "bob.token.sig", orderFrom(alice), http.StatusForbidden},
+		{"owner orders", http.MethodPost, "/standing-orders", "alice.token.sig", orderFrom(alice), http.StatusCreated},
+		{"other user reads order", http.MethodGet, "/standing-orders/" + order.String(), "bob.token.sig", "", http.StatusNotFound},
+		{"other user cancels order", http.MethodPost, "/standing-orders/" + order.String() + "/cancel", "bob.token.sig", "", http.StatusNotFound},
+		{"owner reads order", http.MethodGet, "/standing-orders/" + order.String(), "alice.token.sig", "", http.StatusOK},
+		{"owner cancels order", http.MethodPost, "/standing-orders/" + order.String() + "/cancel", "alice.token.sig", "", http.StatusNoContent},
+
+		{"other user subscribes", http.MethodPost, "/webhooks", "bob.token.sig", webhookOf(bob.String(), alice.String()), http.StatusForbidden},
+		{"user subscribes to every account", http.MethodPost, "/webhooks", "bob.token.sig", webhookOf(), http.StatusForbidden},
+		{"owner subscribes", http.MethodPost, "/webhooks", "bob.token.sig", webhookOf(bob.String()), http.StatusCreated},
+		{"other user reads webhook", http.MethodGet, "/webhooks/" + sub.ID.String(), "bob.token.sig", "", http.StatusNotFound},
+		{"other user reads deliveries", http.MethodGet, "/webhooks/" + sub.ID.String() + "/deliveries", "bob.token.sig", "", http.StatusNotFound},
+		{"other user deletes webhook", http.MethodDelete, "/webhooks/" + sub.ID.String(), "bob.token.sig", "", http.StatusNotFound},
+		{"owner reads webhook", http.MethodGet, "/webhooks/" + sub.ID.String(), "alice.token.sig", "", http.StatusOK},
+		{"owner deletes webhook", http.MethodDelete, "/webhooks/" + sub.ID.String(), "alice.token.sig", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -1,167 +1,335 @@
 package rest
 
 import (
+	"context"
+	"errors"
+	"hash/fnv"
 	"sync"
 	"time"
 
-	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lrweck/clean-api/internal/audit"
+	"github.com/lrweck/clean-api/internal/transfer"
 )
 
-type fakeDoer struct{}
+var tracer = otel.Tracer("github.com/lrweck/clean-api/pkg/rest")
+
+var (
+	ErrBulkQueueFull = errors.New("transfer queue is full, try again later")
+	ErrBulkClosed    = errors.New("transfer processor is shutting down")
+)
 
-func (f fakeDoer) Do(a []any) error {
-	return nil
+type BulkTransferService interface {
+	New(ctx context.Context, tx transfer.NewTx) (ulid.ULID, error)
+	NewBatch(ctx context.Context, txs []transfer.NewTx, mode transfer.BatchMode) ([]transfer.BatchResult, error)
 }
 
-type ServiceLayer interface {
-	Do([]any) error
+// DefaultBulkQueueSize is the QueueSize of a BulkConfig that sets none.
+const DefaultBulkQueueSize = 1024
+
+type BulkConfig struct {
+	// Shards is the number of independent batching workers. Requests are
+	// sharded by source account, so transfers from a hot account always
+	// coalesce in the same worker.
+	Shards int
+	// MaxBatchSize flushes a batch as soon as it has this many transfers.
+	MaxBatchSize int
+	// MaxWait flushes a batch this long after its first transfer arrived.
+	MaxWait time.Duration
+	// QueueSize bounds the pending transfers of each shard. Transfers are
+	// rejected with ErrBulkQueueFull when it is exhausted. Defaults to
+	// DefaultBulkQueueSize.
+	QueueSize int
 }
 
+// BulkProcessor coalesces concurrent transfer requests into batches that
+// are written in a single storage transaction, reducing lock contention on
+// hot accounts. Each caller still receives the result of its own transfer.
 type BulkProcessor struct {
-	mu sync.RWMutex
-	mm map[uint64]Shard
+	svc    BulkTransferService
+	cfg    BulkConfig
+	shards []chan *bulkRequest
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
 
-	svc ServiceLayer
+	batchSize metric.Int64Histogram
+	waitTime  metric.Int64Histogram
+	rejected  metric.Int64Counter
 }
 
-func NewBulkProcessor() *BulkProcessor {
-	return &BulkProcessor{
-		mm:  make(map[uint64]Shard),
-		svc: &fakeDoer{},
-	}
+type bulkRequest struct {
+	tx transfer.NewTx
+	// ctx is the caller's, as the batch it ends up in serves many callers
+	// at once
+	ctx      context.Context
+	enqueued time.Time
+	result   chan transfer.BatchResult
 }
 
-func (bp *BulkProcessor) DoStuff(c echo.Context) error {
+func NewBulkProcessor(svc BulkTransferService, cfg BulkConfig) *BulkProcessor {
+	if cfg.Shards <= 0 {
+		cfg.Shards = 1
+	}
+
+	if cfg.MaxBatchSize <= 0 || cfg.MaxBatchSize > transfer.MaxBatchSize {
+		cfg.MaxBatchSize = transfer.MaxBatchSize
+	}
+
+	// an unbuffered queue would reject every transfer as full
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultBulkQueueSize
+	}
+
+	meter := otel.Meter("bulk.transfer")
+
+	batchSize, err := meter.Int64Histogram("bulk.transfer.batch_size",
+		metric.WithUnit("1"))
+	if err != nil {
+		panic(err)
+	}
+
+	waitTime, err := meter.Int64Histogram("bulk.transfer.wait_time",
+		metric.WithUnit("ms"))
+	if err != nil {
+		panic(err)
+	}
+
+	rejected, err := meter.Int64Counter("bulk.transfer.rejected",
+		metric.WithUnit("1"))
+	if err != nil {
+		panic(err)
+	}
+
+	bp := &BulkProcessor{
+		svc:       svc,
+		cfg:       cfg,
+		shards:    make([]chan *bulkRequest, cfg.Shards),
+		batchSize: batchSize,
+		waitTime:  waitTime,
+		rejected:  rejected,
+	}
 
-	shard, running, clean := bp.FindShard(50)
+	for i := range bp.shards {
+		bp.shards[i] = make(chan *bulkRequest, cfg.QueueSize)
 
-	if !running {
-		go shard.BulkRequests(10*time.Millisecond, 150, clean)
+		bp.wg.Add(1)
+		go bp.runShard(bp.shards[i])
 	}
 
-	shard.ch <- 1
+	return bp
+}
 
-	return nil
+// New enqueues an immediate transfer and waits for the result of the batch
+// it ends up in. Scheduled transfers bypass batching. A transfer whose
+// caller gives up before its batch is flushed is dropped; after that it may
+// still be executed.
+func (bp *BulkProcessor) New(ctx context.Context, tx transfer.NewTx) (ulid.ULID, error) {
 
+	if !tx.ExecuteAt.IsZero() {
+		return bp.svc.New(ctx, tx)
+	}
+
+	req := &bulkRequest{
+		tx:       tx,
+		ctx:      ctx,
+		enqueued: time.Now(),
+		result:   make(chan transfer.BatchResult, 1),
+	}
+
+	if err := bp.enqueue(req); err != nil {
+		bp.rejected.Add(context.Background(), 1,
+			metric.WithAttributes(attribute.String("reason", err.Error())))
+		return ulid.ULID{}, err
+	}
+
+	select {
+	case res := <-req.result:
+		return res.ID, res.Err
+	case <-ctx.Done():
+		return ulid.ULID{}, ctx.Err()
+	}
 }
 
-type Shard struct {
-	ch  chan int
-	svc ServiceLayer
+func (bp *BulkProcessor) enqueue(req *bulkRequest) error {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+
+	if bp.closed {
+		return ErrBulkClosed
+	}
+
+	select {
+	case bp.shardFor(req.tx.From) <- req:
+		return nil
+	default:
+		return ErrBulkQueueFull
+	}
 }
 
-func (s Shard) BulkRequests(timeout time.Duration, maxSize int, fnClose func()) {
-	var reqs []any
+func (bp *BulkProcessor) shardFor(account ulid.ULID) chan *bulkRequest {
+	h := fnv.New32a()
+	h.Write(account[:])
+	return bp.shards[h.Sum32()%uint32(len(bp.shards))]
+}
 
-	tt := time.NewTimer(timeout)
-	defer func() {
-		if !tt.Stop() {
-			<-tt.C
+// Close stops accepting transfers and waits until every queued transfer
+// has been flushed, or ctx expires.
+func (bp *BulkProcessor) Close(ctx context.Context) error {
+	bp.mu.Lock()
+	if !bp.closed {
+		bp.closed = true
+		for _, ch := range bp.shards {
+			close(ch)
 		}
+	}
+	bp.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		bp.wg.Wait()
+		close(done)
 	}()
 
-loop:
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (bp *BulkProcessor) runShard(ch <-chan *bulkRequest) {
+	defer bp.wg.Done()
+
+	var (
+		batch   []*bulkRequest
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		bp.flush(batch)
+		batch, timer, timeout = nil, nil, nil
+	}
+
 	for {
 		select {
-		case req, ok := <-s.ch:
+		case req, ok := <-ch:
 			if !ok {
-				if len(reqs) > 0 {
-					s.svc.Do(reqs)
+				if len(batch) > 0 {
+					flush()
 				}
-				break loop
+				return
+			}
+
+			batch = append(batch, req)
+
+			if len(batch) == 1 {
+				timer = time.NewTimer(bp.cfg.MaxWait)
+				timeout = timer.C
 			}
-			reqs = append(reqs, req)
-			if len(reqs) >= maxSize {
-				fnClose()
-				s.svc.Do(reqs)
-				break loop
+
+			if len(batch) >= bp.cfg.MaxBatchSize {
+				flush()
 			}
-		case <-time.After(timeout):
-			fnClose()
-			s.svc.Do(reqs)
-			break loop
+
+		case <-timeout:
+			flush()
 		}
 	}
 }
 
-func (bp *BulkProcessor) FindShard(id uint64) (ch Shard, running bool, clean func()) {
-	bp.mu.RLock()
-	if ch, ok := bp.mm[id]; ok {
-		bp.mu.RUnlock()
-		return ch, true, func() {
-			bp.mu.Lock()
-			defer bp.mu.Unlock()
-			close(bp.mm[id].ch)
-			delete(bp.mm, id)
+// flush writes the batch atomically. When it fails for business reasons,
+// e.g. one transfer lacks funds, the batch is retried in independent mode
+// so that only the offending transfers fail. Transfers whose caller already
+// gave up are dropped, and the rest is written under a span linked to every
+// caller's, canceled only once all of them have given up.
+func (bp *BulkProcessor) flush(batch []*bulkRequest) {
+	start := time.Now()
+
+	live := make([]*bulkRequest, 0, len(batch))
+	links := make([]trace.Link, 0, len(batch))
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.result <- transfer.BatchResult{Err: err}
+			continue
 		}
+		live = append(live, req)
+		links = append(links, trace.LinkFromContext(req.ctx))
 	}
-	bp.mu.RUnlock()
-	bp.mu.Lock()
-	defer bp.mu.Unlock()
 
-	bp.mm[id] = Shard{
-		ch:  make(chan int, 1),
-		svc: bp.svc,
+	if len(live) == 0 {
+		return
 	}
-	return ch, false, func() {
-		bp.mu.Lock()
-		defer bp.mu.Unlock()
-		close(bp.mm[id].ch)
-		delete(bp.mm, id)
-	}
-}
 
-type SafeMap[K comparable, V any] struct {
-	mu sync.RWMutex
-	m  map[K]V
-}
+	flushed, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for _, req := range live {
+			select {
+			case <-req.ctx.Done():
+			case <-flushed.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	ctx, span := tracer.Start(flushed, "bulk.flush", trace.WithLinks(links...), trace.WithAttributes(
+		attribute.Int("transfer.batch.size", len(live)),
+	))
+	defer span.End()
 
-func NewSafeMap[K comparable, V any](size int) *SafeMap[K, V] {
-	return &SafeMap[K, V]{
-		m: make(map[K]V, size),
+	txs := make([]transfer.NewTx, len(live))
+	for i, req := range live {
+		txs[i] = req.tx
+		txs[i].Origin = audit.OriginOf(req.ctx)
+		bp.waitTime.Record(ctx, start.Sub(req.enqueued).Milliseconds())
+	}
+	bp.batchSize.Record(ctx, int64(len(live)))
+
+	results, err := bp.svc.NewBatch(transfer.ContextWithFallback(ctx), txs, transfer.BatchAtomic)
+	if isBatchBusinessFailure(err) {
+		results, err = bp.svc.NewBatch(ctx, txs, transfer.BatchIndependent)
 	}
-}
 
-func (sm *SafeMap[K, V]) Get(k K) (v V, ok bool) {
-	sm.mu.RLock()
-	v, ok = sm.m[k]
-	sm.mu.RUnlock()
-	return
+	for i, req := range live {
+		if err != nil {
+			req.result <- transfer.BatchResult{Err: err}
+			continue
+		}
+		req.result <- results[i]
+	}
 }
 
-func (sm *SafeMap[K, V]) Set(k K, v V) {
-	sm.mu.Lock()
-	sm.m[k] = v
-	sm.mu.Unlock()
+func isBatchBusinessFailure(err error) bool {
+	item := new(transfer.ErrBatchItem)
+	return errors.As(err, &item) || transfer.IsExecutionFailure(err)
 }
 
-func (sm *SafeMap[K, V]) Delete(k K) {
-	sm.mu.Lock()
-	delete(sm.m, k)
-	sm.mu.Unlock()
+// coalescingTransferService creates transfers through a BulkProcessor.
+type coalescingTransferService struct {
+	TransferService
+	bulk *BulkProcessor
 }
 
-func (sm *SafeMap[K, V]) GetOrSet1(k K, v V) (V, bool) {
-	sm.mu.RLock()
-	val, ok := sm.m[k]
-	if ok {
-		sm.mu.RUnlock()
-		return val, ok
-	}
-	sm.mu.RUnlock()
-	sm.mu.Lock()
-	sm.m[k] = v
-	sm.mu.Unlock()
-	return v, true
+// NewCoalescingTransferService returns a TransferService whose transfers
+// are created through bp instead of one storage transaction each.
+func NewCoalescingTransferService(svc TransferService, bp *BulkProcessor) TransferService {
+	return coalescingTransferService{svc, bp}
 }
 
-func (sm *SafeMap[K, V]) GetOrSet2(k K, v V) (V, bool) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	val, ok := sm.m[k]
-	if !ok {
-		sm.m[k] = v
-		return val, ok
-	}
-	return val, ok
+func (s coalescingTransferService) New(ctx context.Context, tx transfer.NewTx) (ulid.ULID, error) {
+	return s.bulk.New(ctx, tx)
 }
@@ -1,37 +1,162 @@
 package rest
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
 
-var Size = 5
+	"github.com/shopspring/decimal"
 
-func BenchmarkMapSimple(b *testing.B) {
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
 
-	b.RunParallel(func(pb *testing.PB) {
-		m := NewSafeMap[int, int](Size)
-		b.ResetTimer()
-		b.ReportAllocs()
+func TestBulkProcessorCoalescesTransfers(t *testing.T) {
+	ctx := context.Background()
 
-		i := 0
-		for pb.Next() {
-			i++
-			m.GetOrSet2(i%Size, i)
-		}
-	})
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "from", Document: "1", StartingBalance: decimal.NewFromInt(150)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "to", Document: "2"})
+
+	bp := NewBulkProcessor(
+		transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{}),
+		BulkConfig{Shards: 4, MaxBatchSize: 50, MaxWait: 5 * time.Millisecond, QueueSize: 1000})
+
+	var (
+		wg               sync.WaitGroup
+		ok, insufficient atomic.Int64
+	)
+
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := bp.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(1)})
+			switch {
+			case err == nil:
+				ok.Add(1)
+			case errors.Is(err, transfer.ErrInsufficientFunds):
+				insufficient.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := bp.Close(ctx); err != nil {
+		t.Fatalf("failed to close bulk processor: %v", err)
+	}
+
+	if ok.Load() != 150 || insufficient.Load() != 50 {
+		t.Fatalf("expected 150 transfers and 50 failures, got %d and %d", ok.Load(), insufficient.Load())
+	}
+
+	acc, _ := accounts.GetAccount(ctx, from.String())
+	if !acc.Balance.IsZero() {
+		t.Fatalf("expected empty origin account, got balance %s", acc.Balance)
+	}
+
+	if _, err := bp.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(1)}); !errors.Is(err, ErrBulkClosed) {
+		t.Fatalf("expected ErrBulkClosed after close, got %v", err)
+	}
+}
+
+func TestBulkProcessorDefaultsQueueSize(t *testing.T) {
+	ctx := context.Background()
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "from", Document: "1", StartingBalance: decimal.NewFromInt(1)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "to", Document: "2"})
+
+	bp := NewBulkProcessor(transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{}), BulkConfig{MaxWait: time.Millisecond})
+	defer bp.Close(ctx)
 
+	if n := cap(bp.shards[0]); n != DefaultBulkQueueSize {
+		t.Fatalf("expected a queue of %d transfers, got %d", DefaultBulkQueueSize, n)
+	}
+
+	if _, err := bp.New(ctx, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(1)}); err != nil {
+		t.Fatalf("expected a processor without a queue size to accept transfers, got %v", err)
+	}
 }
 
-func BenchmarkOptimized(b *testing.B) {
+func TestBulkProcessorDoesNotNetTransfersOfDifferentCallers(t *testing.T) {
+	ctx := context.Background()
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+
+	a, _ := accService.New(ctx, account.NewAccount{Name: "a", Document: "1"})
+	b, _ := accService.New(ctx, account.NewAccount{Name: "b", Document: "2"})
+
+	txService := transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{})
+	bp := NewBulkProcessor(txService, BulkConfig{MaxBatchSize: 2, MaxWait: time.Second})
+	svc := NewCoalescingTransferService(txService, bp)
 
-	b.RunParallel(func(pb *testing.PB) {
-		m := NewSafeMap[int, int](Size)
-		b.ResetTimer()
-		b.ReportAllocs()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, tx := range []transfer.NewTx{
+		{From: a, To: b, Amount: decimal.NewFromInt(10)},
+		{From: b, To: a, Amount: decimal.NewFromInt(10)},
+	} {
+		wg.Add(1)
+		go func(i int, tx transfer.NewTx) {
+			defer wg.Done()
+			_, errs[i] = svc.New(ctx, tx)
+		}(i, tx)
+	}
+	wg.Wait()
 
-		i := 0
-		for pb.Next() {
-			i++
-			m.GetOrSet1(i%Size, i)
+	if err := bp.Close(ctx); err != nil {
+		t.Fatalf("failed to close bulk processor: %v", err)
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, transfer.ErrInsufficientFunds) {
+			t.Errorf("expected transfer %d to lack funds, got %v", i, err)
+		}
+	}
+
+	for _, id := range []string{a.String(), b.String()} {
+		if acc, _ := accounts.GetAccount(ctx, id); !acc.Balance.IsZero() {
+			t.Errorf("expected no funds to be moved, got balance %s", acc.Balance)
 		}
-	})
+	}
+}
+
+func TestBulkProcessorDropsTransfersOfCallersThatGaveUp(t *testing.T) {
+	ctx := context.Background()
+
+	accounts := memorydb.NewAccountStorage()
+	accService := account.NewService(accounts, account.Options{})
+
+	from, _ := accService.New(ctx, account.NewAccount{Name: "from", Document: "1", StartingBalance: decimal.NewFromInt(10)})
+	to, _ := accService.New(ctx, account.NewAccount{Name: "to", Document: "2"})
+
+	bp := NewBulkProcessor(transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{}), BulkConfig{MaxWait: 50 * time.Millisecond})
+
+	waiting, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+
+	if _, err := bp.New(waiting, transfer.NewTx{From: from, To: to, Amount: decimal.NewFromInt(10)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller to give up, got %v", err)
+	}
+
+	if err := bp.Close(ctx); err != nil {
+		t.Fatalf("failed to close bulk processor: %v", err)
+	}
 
+	if acc, _ := accounts.GetAccount(ctx, from.String()); !acc.Balance.Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("expected the abandoned transfer not to be executed, got balance %s", acc.Balance)
+	}
 }
@@ -0,0 +1,254 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	goccy "github.com/goccy/go-json"
+	"github.com/shopspring/decimal"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types of the supported encodings.
+const (
+	MIMEApplicationMessagePack = "application/msgpack"
+	MIMEApplicationCBOR        = "application/cbor"
+)
+
+// Codec encodes and decodes request and response bodies in a media type.
+// Every codec honours the json struct tags. Binary codecs encode decimals
+// as strings, so amounts never lose precision.
+type Codec interface {
+	// MediaType is the Content-Type of the bodies the codec writes.
+	MediaType() string
+	// Accepts reports whether the codec handles the given media type.
+	Accepts(mediaType string) bool
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+var (
+	JSONCodec        Codec = jsonCodec{}
+	MessagePackCodec Codec = msgpackCodec{}
+	CBORCodec        Codec = cborCodec{}
+)
+
+// Codecs lists the supported codecs, in order of preference when the client
+// accepts any of them.
+var Codecs = []Codec{JSONCodec, MessagePackCodec, CBORCodec}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string { return "application/json" }
+
+func (jsonCodec) Accepts(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == ProblemContentType
+}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return goccy.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return goccy.NewDecoder(r).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaType() string { return MIMEApplicationMessagePack }
+
+func (msgpackCodec) Accepts(mediaType string) bool {
+	switch mediaType {
+	case MIMEApplicationMessagePack, "application/x-msgpack", "application/vnd.msgpack":
+		return true
+	}
+	return false
+}
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+
+	enc.Reset(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	dec.Reset(r)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func init() {
+	// decimals implement encoding.BinaryMarshaler, which msgpack prefers
+	// over text; encode them as strings instead.
+	msgpack.Register(decimal.Decimal{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeString(v.Interface().(decimal.Decimal).String())
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			raw, err := d.DecodeInterfaceLoose()
+			if err != nil {
+				return err
+			}
+
+			var dec decimal.Decimal
+			switch n := raw.(type) {
+			case string:
+				dec, err = decimal.NewFromString(n)
+			case int64:
+				dec = decimal.NewFromInt(n)
+			case uint64:
+				dec, err = decimal.NewFromString(strconv.FormatUint(n, 10))
+			case float64:
+				dec = decimal.NewFromFloat(n)
+			default:
+				err = fmt.Errorf("cannot decode %T into a decimal", raw)
+			}
+
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(dec))
+			return nil
+		})
+}
+
+type cborCodec struct{}
+
+var (
+	cborEnc cbor.EncMode
+	cborDec cbor.DecMode
+)
+
+func init() {
+	var err error
+
+	// decimals implement encoding.BinaryMarshaler too; ignoring it makes
+	// them text strings through encoding.TextMarshaler.
+	cborEnc, err = cbor.EncOptions{
+		Time:            cbor.TimeRFC3339Nano,
+		TimeTag:         cbor.EncTagRequired,
+		BinaryMarshaler: cbor.BinaryMarshalerNone,
+		TextMarshaler:   cbor.TextMarshalerTextString,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+
+	cborDec, err = cbor.DecOptions{
+		BinaryUnmarshaler: cbor.BinaryUnmarshalerNone,
+		TextUnmarshaler:   cbor.TextUnmarshalerTextString,
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cborCodec) MediaType() string { return MIMEApplicationCBOR }
+
+func (cborCodec) Accepts(mediaType string) bool {
+	return mediaType == MIMEApplicationCBOR
+}
+
+func (cborCodec) Encode(w io.Writer, v any) error {
+	return cborEnc.NewEncoder(w).Encode(v)
+}
+
+func (cborCodec) Decode(r io.Reader, v any) error {
+	return cborDec.NewDecoder(r).Decode(v)
+}
+
+// CodecFor returns the codec of a Content-Type header.
+func CodecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, codec := range Codecs {
+		if codec.Accepts(mediaType) {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// NegotiateCodec picks the codec best matching an Accept header, honouring
+// quality values. An empty header accepts anything.
+func NegotiateCodec(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return Codecs[0], true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+
+	// codecs explicitly refused with q=0 are never picked, not even by
+	// wildcards
+	excluded := make(map[Codec]bool)
+	for _, r := range ranges {
+		for _, codec := range Codecs {
+			if r.q == 0 && codec.Accepts(r.mediaType) {
+				excluded[codec] = true
+			}
+		}
+	}
+
+	var (
+		best  Codec
+		bestQ float64
+	)
+
+	for _, r := range ranges {
+		for _, codec := range Codecs {
+			if excluded[codec] || !matchesRange(codec, r.mediaType) {
+				continue
+			}
+			if r.q > bestQ {
+				best, bestQ = codec, r.q
+			}
+			break
+		}
+	}
+
+	return best, best != nil
+}
+
+func matchesRange(codec Codec, mediaRange string) bool {
+	switch {
+	case mediaRange == "*/*":
+		return true
+	case strings.HasSuffix(mediaRange, "/*"):
+		return strings.HasPrefix(codec.MediaType(), strings.TrimSuffix(mediaRange, "*"))
+	default:
+		return codec.Accepts(mediaRange)
+	}
+}
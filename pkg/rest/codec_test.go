@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+)
+
+func TestNegotiateCodec(t *testing.T) {
+
+	tests := []struct {
+		accept string
+		want   Codec
+	}{
+		{"", JSONCodec},
+		{"*/*", JSONCodec},
+		{"application/json", JSONCodec},
+		{"application/problem+json", JSONCodec},
+		{"application/msgpack", MessagePackCodec},
+		{"application/x-msgpack", MessagePackCodec},
+		{"application/cbor", CBORCodec},
+		{"application/json;q=0.5, application/cbor", CBORCodec},
+		{"application/msgpack;q=0.2, application/*;q=0.1", MessagePackCodec},
+		{"application/json;q=0, */*", MessagePackCodec},
+		{"text/html, application/cbor;q=0.9", CBORCodec},
+		{"text/html", nil},
+		{"application/json;q=0", nil},
+	}
+
+	for _, tt := range tests {
+		got, ok := NegotiateCodec(tt.accept)
+		if ok != (tt.want != nil) || got != tt.want {
+			t.Errorf("Accept %q: expected %T, got %T", tt.accept, tt.want, got)
+		}
+	}
+}
+
+func TestBinaryCodecsEncodeDecimalsAsStrings(t *testing.T) {
+
+	amount := decimal.RequireFromString("12345678901234567890.123456789")
+	in := TransferLeg{To: "01H8XGJWBWBAQ4Z4XK7N8K5X0M", Amount: amount}
+
+	for _, codec := range []Codec{MessagePackCodec, CBORCodec} {
+		var buf bytes.Buffer
+		if err := codec.Encode(&buf, in); err != nil {
+			t.Fatalf("%s: failed to encode: %v", codec.MediaType(), err)
+		}
+
+		var raw map[string]any
+		switch codec {
+		case MessagePackCodec:
+			if err := msgpack.Unmarshal(buf.Bytes(), &raw); err != nil {
+				t.Fatal(err)
+			}
+		case CBORCodec:
+			if err := cbor.Unmarshal(buf.Bytes(), &raw); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if raw["amount"] != amount.String() || raw["to"] != in.To {
+			t.Fatalf("%s: expected json field names and a string amount, got %#v", codec.MediaType(), raw)
+		}
+
+		var out TransferLeg
+		if err := codec.Decode(&buf, &out); err != nil {
+			t.Fatalf("%s: failed to decode: %v", codec.MediaType(), err)
+		}
+		if !out.Amount.Equal(amount) || out.To != in.To {
+			t.Fatalf("%s: expected %+v, got %+v", codec.MediaType(), in, out)
+		}
+	}
+}
+
+func TestAccountOverCBOR(t *testing.T) {
+
+	svc := account.NewService(memorydb.NewAccountStorage(), account.Options{})
+
+	e := echo.New()
+	e.Binder = NewBinder()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/accounts", V1_POST_Account(svc), Negotiate())
+	e.GET("/accounts/:id", V1_GET_Account(svc), Negotiate())
+
+	body, _ := cbor.Marshal(map[string]any{"name": "cbor", "document": "1", "starting_balance": "10.50"})
+
+	req := httptest.NewRequest(http.MethodPost, "/accounts", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationCBOR)
+	req.Header.Set(echo.HeaderAccept, MIMEApplicationMessagePack)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated || rec.Header().Get(echo.HeaderContentType) != MIMEApplicationMessagePack {
+		t.Fatalf("expected a msgpack 201, got %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	var created CreatedResponse
+	if err := MessagePackCodec.Decode(rec.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts/"+created.ID, nil)
+	req.Header.Set(echo.HeaderAccept, MIMEApplicationCBOR)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var acc struct {
+		Balance   string    `cbor:"starting_balance"`
+		CreatedAt time.Time `cbor:"created_at"`
+	}
+	if err := cbor.Unmarshal(rec.Body.Bytes(), &acc); err != nil {
+		t.Fatal(err)
+	}
+	if acc.Balance != "10.5" || acc.CreatedAt.IsZero() {
+		t.Fatalf("unexpected account %+v", acc)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts/"+created.ID, nil)
+	req.Header.Set(echo.HeaderAccept, "text/html")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotAcceptable || rec.Header().Get(echo.HeaderContentType) != ProblemContentType {
+		t.Fatalf("expected a 406 problem, got %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/accounts", bytes.NewReader([]byte("name=x")))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rec.Code)
+	}
+}
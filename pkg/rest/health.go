@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/lrweck/clean-api/pkg/health"
+)
+
+// GET_HealthLive tells the orchestrator whether to restart the process.
+func GET_HealthLive(h *health.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, h.Live())
+	}
+}
+
+// GET_HealthReady tells load balancers whether to route requests to the
+// process, with the status and latency of every check.
+func GET_HealthReady(h *health.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := h.Ready(c.Request().Context())
+
+		status := http.StatusOK
+		if r.Status != health.StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+
+		return c.JSON(status, r)
+	}
+}
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/slog"
+
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// MaxLogLevelDuration bounds how long a temporary log level lasts.
+const MaxLogLevelDuration = 24 * time.Hour
+
+type PUTLogLevelRequest struct {
+	// Logger is the name of the logger, empty for the default level.
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	// Duration reverts the level after a while, such as 15m. Empty keeps
+	// the level until it is changed again.
+	Duration string `json:"duration,omitempty"`
+}
+
+type LogLevels interface {
+	List() []slogger.LevelInfo
+	Set(name string, level slog.Level, revertAfter time.Duration)
+}
+
+func V1_GET_LogLevels(levels LogLevels) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return respond(c, http.StatusOK, echo.Map{
+			"levels": levels.List(),
+		})
+	}
+}
+
+// V1_PUT_LogLevel changes the level of a logger, for instance to debug an
+// incident in production for a few minutes.
+func V1_PUT_LogLevel(levels LogLevels) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req PUTLogLevelRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		level, err := slogger.ParseLevel(req.Level)
+		if err != nil {
+			pe := ProblemInvalidLogLevel.Wrap(err)
+			pe.Detail = "level must be one of debug, info, warn or error, optionally with an offset such as info+2"
+			return pe
+		}
+
+		var revertAfter time.Duration
+		if req.Duration != "" {
+			revertAfter, err = time.ParseDuration(req.Duration)
+			if err != nil || revertAfter <= 0 || revertAfter > MaxLogLevelDuration {
+				pe := ProblemInvalidLogLevel.Wrap(fmt.Errorf("invalid log level duration %q", req.Duration))
+				pe.Detail = "duration must be positive and at most " + MaxLogLevelDuration.String()
+				return pe
+			}
+		}
+
+		levels.Set(req.Logger, level, revertAfter)
+
+		ctx := c.Request().Context()
+		slogger.FromContext(ctx).WarnCtx(ctx, "log level changed",
+			slog.String("name", req.Logger),
+			slog.String("level", level.String()),
+			slog.Duration("revert_after", revertAfter))
+
+		return respond(c, http.StatusOK, echo.Map{
+			"levels": levels.List(),
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultMaxBodyLog is how many bytes of each body are logged by default.
+const DefaultMaxBodyLog = 8 << 10
+
+const skipBodyLogKey = "slog-echo.skip-body"
+
+// SkipBodyLog is a route middleware that keeps the logger from logging the
+// bodies of its requests and responses, such as for large or sensitive
+// payloads.
+func SkipBodyLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(skipBodyLogKey, true)
+			return next(c)
+		}
+	}
+}
+
+func bodyLogSkipped(c echo.Context) bool {
+	skip, _ := c.Get(skipBodyLogKey).(bool)
+	return skip
+}
+
+// loggable reports whether bodies of contentType are text worth logging.
+// Binary and streamed bodies, such as Server-Sent Events, are not.
+func loggable(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mt == echo.MIMETextPlain, mt == echo.MIMEApplicationForm:
+		return true
+	case mt == "application/json", strings.HasSuffix(mt, "+json"):
+		return true
+	case mt == "application/xml", mt == "text/xml", strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+
+	return false
+}
+
+// bodyCapture keeps up to limit bytes of a body written in any number of
+// chunks.
+type bodyCapture struct {
+	buf       []byte
+	limit     int
+	size      int
+	truncated bool
+}
+
+func (b *bodyCapture) Write(p []byte) (int, error) {
+	b.size += len(p)
+
+	if room := b.limit - len(b.buf); room < len(p) {
+		b.truncated = true
+		p = p[:room]
+	}
+
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// requestCapture captures a request body while the handler reads it, so
+// bodies are never buffered beyond the limit nor read when the handler
+// does not.
+type requestCapture struct {
+	io.ReadCloser
+	body *bodyCapture
+}
+
+func (r *requestCapture) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.Write(p[:n])
+	return n, err
+}
+
+// responseWriter captures the body of a response, unless its content type
+// is not loggable.
+type responseWriter struct {
+	http.ResponseWriter
+	body bodyCapture
+
+	decided, skip bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.decide()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if !w.skip {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide looks at the headers of the response once they are final.
+func (w *responseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	h := w.Header()
+	w.skip = !loggable(h.Get(echo.HeaderContentType)) || h.Get(echo.HeaderContentEncoding) != ""
+}
+
+// Flush lets streaming handlers, such as Server-Sent Events, flush through
+// the logger.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, such as for websockets.
+// Whatever is written afterwards is not captured.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	w.decided, w.skip = true, true
+	return h.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
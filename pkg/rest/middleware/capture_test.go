@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/slog"
+)
+
+func serveLogged(t *testing.T, config Config, h echo.HandlerFunc, req *http.Request, m ...echo.MiddlewareFunc) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	config.Redactor = defaultRedactor()
+
+	e := echo.New()
+	e.Use(NewLoggerWithConfig(slog.New(slog.NewJSONHandler(&buf, nil)), config))
+	e.POST("/", h, m...)
+
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestLoggerAccumulatesChunkedBodies(t *testing.T) {
+	h := func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c.Response().WriteHeader(http.StatusOK)
+		for _, chunk := range []string{`{"status":`, `"completed",`, `"amount":10}`} {
+			c.Response().Write([]byte(chunk))
+		}
+		return nil
+	}
+
+	logged := serveLogged(t, Config{}, h, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if !strings.Contains(logged, `"body":{"amount":10,"status":"completed"}`) {
+		t.Fatalf("expected every chunk of the response to be logged, got %s", logged)
+	}
+}
+
+func TestLoggerTruncatesLargeBodies(t *testing.T) {
+	body := `{"memo":"` + strings.Repeat("a", 64) + `","document":"123.456.789-09"}`
+
+	h := func(c echo.Context) error {
+		b, err := io.ReadAll(c.Request().Body)
+		if err != nil || string(b) != body {
+			t.Errorf("expected the handler to read the whole body, got %q, %v", b, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	// cut right inside the document
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	logged := serveLogged(t, Config{MaxBodySize: len(body) - 5}, h, req)
+
+	if !strings.Contains(logged, "...[truncated]") || !strings.Contains(logged, `"body-size":`) {
+		t.Fatalf("expected the body to be marked as truncated, got %s", logged)
+	}
+
+	if strings.Contains(logged, "123.456") {
+		t.Fatalf("expected the truncated document to be redacted, got %s", logged)
+	}
+}
+
+func TestLoggerSkipsBodies(t *testing.T) {
+	stream := func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Write([]byte("data: event-data\n\n"))
+		c.Response().Flush()
+		return nil
+	}
+
+	if logged := serveLogged(t, Config{}, stream, httptest.NewRequest(http.MethodPost, "/", nil)); strings.Contains(logged, "event-data") {
+		t.Errorf("expected event streams not to be logged, got %s", logged)
+	}
+
+	binary := func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, []byte("binary-data"))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("upload-data"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	if logged := serveLogged(t, Config{}, binary, req); strings.Contains(logged, "binary-data") || strings.Contains(logged, "upload-data") {
+		t.Errorf("expected binary bodies not to be logged, got %s", logged)
+	}
+
+	json := func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "skipped-data"})
+	}
+
+	if logged := serveLogged(t, Config{}, json, httptest.NewRequest(http.MethodPost, "/", nil), SkipBodyLog()); strings.Contains(logged, "skipped-data") || !strings.Contains(logged, `"status":200`) {
+		t.Errorf("expected the route to log without its bodies, got %s", logged)
+	}
+}
+
+type hijackable struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackable) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriterPassesThrough(t *testing.T) {
+	rec := &hijackable{ResponseRecorder: httptest.NewRecorder()}
+	w := &responseWriter{ResponseWriter: rec, body: bodyCapture{limit: DefaultMaxBodyLog}}
+
+	w.Flush()
+	if !rec.Flushed {
+		t.Error("expected Flush to reach the underlying writer")
+	}
+
+	if _, _, err := http.NewResponseController(w).Hijack(); err != nil || !rec.hijacked {
+		t.Errorf("expected Hijack to reach the underlying writer, got %v", err)
+	}
+}
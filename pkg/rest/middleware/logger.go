@@ -1,15 +1,11 @@
 package middleware
 
 import (
-	"bytes"
-	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
-	"github.com/goccy/go-json"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/exp/slog"
 
@@ -23,7 +19,21 @@ type Config struct {
 	ClientErrorLevel slog.Level
 	ServerErrorLevel slog.Level
 
+	// WithRequestID puts the request id in the request context, to be
+	// logged by slogger.ContextHandler, when the request id middleware did
+	// not.
 	WithRequestID bool
+	// WithHeaders logs the request headers.
+	WithHeaders bool
+
+	// MaxBodySize is how many bytes of each body are logged; longer bodies
+	// are truncated. Zero means DefaultMaxBodyLog and a negative size
+	// disables the logging of bodies.
+	MaxBodySize int
+
+	// Redactor removes sensitive data from the logged bodies, headers and
+	// errors. Nil redacts DefaultRedactConfig.
+	Redactor *Redactor
 }
 
 // NewLogger returns a echo.MiddlewareFunc (middleware) that logs requests using slog.
@@ -40,6 +50,14 @@ func NewLogger(logger *slog.Logger) echo.MiddlewareFunc {
 	})
 }
 
+func defaultRedactor() *Redactor {
+	r, err := NewRedactor(DefaultRedactConfig)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
 func getRequestIdFromHeader(req *http.Request, resp *echo.Response) string {
 	requestID := req.Header.Get(echo.HeaderXRequestID)
 	if requestID == "" {
@@ -50,6 +68,19 @@ func getRequestIdFromHeader(req *http.Request, resp *echo.Response) string {
 
 // NewLoggerWithConfig returns a echo.HandlerFunc (middleware) that logs requests using slog.
 func NewLoggerWithConfig(logger *slog.Logger, config Config) echo.MiddlewareFunc {
+	redactor := config.Redactor
+	if redactor == nil {
+		redactor = defaultRedactor()
+	}
+
+	limit := config.MaxBodySize
+	switch {
+	case limit == 0:
+		limit = DefaultMaxBodyLog
+	case limit < 0:
+		limit = 0
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
 
@@ -66,27 +97,29 @@ func NewLoggerWithConfig(logger *slog.Logger, config Config) echo.MiddlewareFunc
 			}
 
 			respWrt := &responseWriter{
-				ResponseWriter: c.Response().Writer,
+				ResponseWriter: res.Writer,
+				body:           bodyCapture{limit: limit},
 			}
+			res.Writer = respWrt
 
-			c.Response().Writer = respWrt
-
-			reqBody := getRequestBody(c)
-
-			reqID := req.Header.Get(echo.HeaderXRequestID)
-
-			l := slogger.FromContext(req.Context())
-
-			// set request-id for every request-scoped logger
-			ctx := context.WithValue(
-				req.Context(),
-				slogger.LoggerKey,
-				l.With(slog.String("request-id", reqID)))
+			reqBody := &bodyCapture{limit: limit}
+			if req.Body != nil && loggable(req.Header.Get(echo.HeaderContentType)) {
+				req.Body = &requestCapture{req.Body, reqBody}
+			}
 
-			c.SetRequest(req.WithContext(ctx))
+			// the request id middleware usually set it already
+			ctx := req.Context()
+			if config.WithRequestID && slogger.RequestIDFromContext(ctx) == "" {
+				ctx = slogger.ContextWithRequestID(ctx, getRequestIdFromHeader(req, res))
+				c.SetRequest(req.WithContext(ctx))
+			}
 
 			start := time.Now()
 			err = next(c)
+			if err != nil {
+				// renders the error now, so its status and body are logged
+				c.Error(err)
+			}
 			end := time.Now()
 
 			status := res.Status
@@ -98,48 +131,59 @@ func NewLoggerWithConfig(logger *slog.Logger, config Config) echo.MiddlewareFunc
 
 			httpErr := new(echo.HTTPError)
 			if err != nil && errors.As(err, &httpErr) {
-				status = httpErr.Code
 				if msg, ok := httpErr.Message.(string); ok {
 					err = errors.New(msg)
 				}
 			}
 
+			logBodies := limit > 0 && !bodyLogSkipped(c)
+
+			request := []any{
+				slog.String("method", method),
+				slog.String("uri", req.URL.Path),
+			}
+
+			if logBodies {
+				request = append(request, bodyAttrs(redactor, reqBody)...)
+			}
+
+			if config.WithHeaders {
+				request = append(request, slog.Any("headers", redactor.Header(req.Header)))
+			}
+
+			response := []any{
+				slog.String("latency", latency.String()),
+				slog.Int("status", status),
+			}
+
+			if logBodies {
+				response = append(response, bodyAttrs(redactor, &respWrt.body)...)
+			}
+
 			attributes := []slog.Attr{
 				slog.String("path", path),
 				slog.String("remote-ip", ip),
 				slog.String("user-agent", userAgent),
-				slog.Group("request",
-					slog.String("method", method),
-					slog.String("uri", req.URL.Path),
-					slog.Any("body", reqBody),
-				),
-				slog.Group("response",
-					slog.Any("body", bytesToMap(respWrt.body)),
-					slog.String("latency", latency.String()),
-					slog.Int("status", status),
-				),
+				slog.Group("request", request...),
+				slog.Group("response", response...),
 			}
 
 			if err != nil {
-				attributes = append(attributes, slog.String("error", err.Error()))
-			}
-
-			if config.WithRequestID {
-				attributes = append(attributes, slog.String("request-id", getRequestIdFromHeader(req, res)))
+				attributes = append(attributes, slog.String("error", redactor.String(err.Error())))
 			}
 
 			msg := fmt.Sprintf("%s %s", req.Method, req.URL.Path)
 
 			switch {
 			case status >= http.StatusInternalServerError:
-				logger.LogAttrs(context.Background(), config.ServerErrorLevel, msg, attributes...)
+				logger.LogAttrs(ctx, config.ServerErrorLevel, msg, attributes...)
 			case status >= http.StatusBadRequest && status < http.StatusInternalServerError:
-				logger.LogAttrs(context.Background(), config.ClientErrorLevel, msg, attributes...)
+				logger.LogAttrs(ctx, config.ClientErrorLevel, msg, attributes...)
 			case status >= http.StatusMultipleChoices && status < http.StatusBadRequest:
 				attributes = append(attributes, slog.Bool("redirect", true))
-				logger.LogAttrs(context.Background(), config.DefaultLevel, msg, attributes...)
+				logger.LogAttrs(ctx, config.DefaultLevel, msg, attributes...)
 			default:
-				logger.LogAttrs(context.Background(), config.DefaultLevel, msg, attributes...)
+				logger.LogAttrs(ctx, config.DefaultLevel, msg, attributes...)
 			}
 
 			return
@@ -156,57 +200,19 @@ func GetRequestID(c echo.Context) string {
 	return ""
 }
 
-type responseWriter struct {
-	http.ResponseWriter
-	body []byte
-}
-
-func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body = cloneBytes(b)
-	return w.ResponseWriter.Write(b)
-}
-
-func cloneBytes(b []byte) []byte {
-	c := make([]byte, len(b))
-	copy(c, b)
-	return c
-}
-
-func getRequestBody(c echo.Context) any {
-	if c.Request().Method == echo.GET || c.Request().Body == nil {
-		return nil
-	}
-
-	bs, _ := io.ReadAll(c.Request().Body)
-	c.Request().Body = io.NopCloser(bytes.NewReader(bs))
-	c.Request().Body.Close()
-
-	if len(bs) == 0 {
-		return nil
-	}
-
-	return bytesToMap(bs)
-}
-
-func bytesToMap(bs []byte) any {
-
-	if len(bs) == 0 {
+// bodyAttrs describes a captured body, redacted. Truncated bodies are
+// rarely valid JSON, so they are logged as redacted text along with their
+// full size.
+func bodyAttrs(redactor *Redactor, b *bodyCapture) []any {
+	switch {
+	case b.size == 0:
 		return nil
+	case b.truncated:
+		return []any{
+			slog.String("body", redactor.Text(string(b.buf))+"...[truncated]"),
+			slog.Int("body-size", b.size),
+		}
+	default:
+		return []any{slog.Any("body", redactor.Body(b.buf))}
 	}
-
-	// obj
-	if bs[0] == '{' {
-		m := make(map[string]any)
-		json.Unmarshal(bs, &m)
-		return m
-	}
-
-	// array
-	if bs[0] == '[' {
-		var arr []map[string]any
-		json.Unmarshal(bs, &arr)
-		return arr
-	}
-
-	return bs
 }
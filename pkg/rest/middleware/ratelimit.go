@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/lrweck/clean-api/internal/auth"
+)
+
+// RateLimitConfig allows each client Limit requests per Period. Clients
+// that were idle may burst up to Limit requests at once.
+type RateLimitConfig struct {
+	// Name tells limits apart in metrics.
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    RateLimitKey
+	// Clock defaults to time.Now.
+	Clock func() time.Time
+}
+
+// RateLimitKey returns the client a request is accounted to. Requests with
+// an empty key are not limited.
+type RateLimitKey func(c echo.Context) string
+
+// KeyByIP accounts requests to the address of the client, as told by the
+// IPExtractor of the server. Without one, echo trusts headers that clients
+// can spoof, see IPExtractor.
+func KeyByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// IPExtractor tells the address of clients from the connection, or from the
+// X-Forwarded-For header when the request comes through one of the proxies
+// in the CIDR ranges of trusted.
+func IPExtractor(trusted []string) (echo.IPExtractor, error) {
+
+	if len(trusted) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	opts := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+
+	for _, cidr := range trusted {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", cidr, err)
+		}
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+// KeyByPrincipal accounts requests to their API key or end user, and to
+// the address of the client when unauthenticated. It must run after
+// rest.Authenticate.
+func KeyByPrincipal(c echo.Context) string {
+	p, ok := auth.PrincipalFromContext(c.Request().Context())
+	switch {
+	case !ok:
+		return KeyByIP(c)
+	case p.Subject != "":
+		return "sub:" + p.Subject
+	default:
+		return "key:" + p.KeyID.String()
+	}
+}
+
+// KeyByAccount accounts requests to the account named by the path
+// parameter param.
+func KeyByAccount(param string) RateLimitKey {
+	return func(c echo.Context) string {
+		if id := c.Param(param); id != "" {
+			return "account:" + id
+		}
+		return ""
+	}
+}
+
+// RateLimit rejects the requests of clients over their limit with a 429
+// and a Retry-After header. Every limited response carries RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, so that clients can pace
+// themselves. A non-positive Limit disables the middleware.
+func RateLimit(cfg RateLimitConfig) echo.MiddlewareFunc {
+
+	if cfg.Limit <= 0 || cfg.Period <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+
+	rejected, err := otel.Meter("ratelimit").
+		Int64Counter("ratelimit.rejected",
+			metric.WithUnit("1"),
+			metric.WithDescription("requests rejected for exceeding a rate limit"))
+	if err != nil {
+		panic(err)
+	}
+
+	limiter := newLimiter(cfg.Limit, cfg.Period)
+	policy := fmt.Sprintf("%d;w=%d", cfg.Limit, int(math.Ceil(cfg.Period.Seconds())))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			key := cfg.Key(c)
+			if key == "" {
+				return next(c)
+			}
+
+			q := limiter.take(key, cfg.Clock())
+
+			// with stacked limits, clients are told about the tightest one
+			h := c.Response().Header()
+			if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || q.remaining <= prev {
+				h.Set("RateLimit-Limit", strconv.Itoa(cfg.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(q.remaining))
+				h.Set("RateLimit-Reset", seconds(q.reset))
+				h.Set("RateLimit-Policy", policy)
+			}
+
+			if !q.allowed {
+				h.Set("Retry-After", seconds(q.retryAfter))
+
+				rejected.Add(context.Background(), 1, metric.WithAttributes(
+					attribute.String("ratelimit.name", cfg.Name),
+					attribute.String("http.path", c.Path()),
+				))
+
+				return echo.NewHTTPError(http.StatusTooManyRequests,
+					fmt.Sprintf("rate limit of %d requests per %s exceeded", cfg.Limit, cfg.Period))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Limiter accounts requests like RateLimit does, for servers other than
+// echo's.
+type Limiter struct {
+	l *limiter
+}
+
+func NewLimiter(limit int, period time.Duration) *Limiter {
+	return &Limiter{newLimiter(limit, period)}
+}
+
+// Allow takes a request of key into account. When key is over its limit,
+// it returns false and how long until the next request is allowed.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	q := l.l.take(key, now)
+	return q.allowed, q.retryAfter
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// limiter keeps a token bucket per client. Buckets idle for a whole
+// period are full again, same as new ones, so they are dropped to bound
+// memory.
+type limiter struct {
+	limit  float64
+	period time.Duration
+	rate   float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type quota struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func newLimiter(limit int, period time.Duration) *limiter {
+	return &limiter{
+		limit:   float64(limit),
+		period:  period,
+		rate:    float64(limit) / period.Seconds(),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *limiter) take(key string, now time.Time) quota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.period {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= l.period {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.limit, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.limit, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	var q quota
+	if b.tokens >= 1 {
+		b.tokens--
+		q.allowed = true
+	} else {
+		q.retryAfter = l.until(1 - b.tokens)
+	}
+
+	q.remaining = int(b.tokens)
+	q.reset = l.until(l.limit - b.tokens)
+
+	return q
+}
+
+// until returns how long it takes to refill n tokens.
+func (l *limiter) until(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	e := echo.New()
+	e.GET("/accounts/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RateLimit(RateLimitConfig{
+		Name: "account", Limit: 2, Period: time.Minute, Key: KeyByAccount("id"),
+		Clock: func() time.Time { return now },
+	}))
+
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/"+id, nil))
+		return rec
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := get("a")
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request %d: expected 200 with %s remaining, got %d with %q", i, remaining, rec.Code, rec.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	rec := get("a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+
+	h := rec.Header()
+	if h.Get("Retry-After") != "30" || h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Reset") != "60" || h.Get("RateLimit-Policy") != "2;w=60" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+
+	if rec := get("b"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other accounts not to be limited, got %d", rec.Code)
+	}
+
+	now = now.Add(30 * time.Second)
+	if rec := get("a"); rec.Code != http.StatusOK {
+		t.Fatalf("expected a token to be refilled, got %d", rec.Code)
+	}
+}
+
+func TestLimiterDropsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(10, time.Minute)
+
+	l.take("a", now)
+	l.take("b", now.Add(time.Minute))
+
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Fatalf("expected the idle bucket to be dropped, got %v", l.buckets)
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		want    string
+	}{
+		{"no proxy", nil, "203.0.113.7:1234", "203.0.113.7"},
+		{"untrusted proxy", []string{"10.0.0.0/8"}, "192.168.1.1:1234", "192.168.1.1"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.2:1234", "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := IPExtractor(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.9")
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.9")
+
+			if ip := extract(req); ip != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, ip)
+			}
+		})
+	}
+
+	if _, err := IPExtractor([]string{"10.0.0.0"}); err == nil {
+		t.Fatal("expected an invalid range to be rejected")
+	}
+}
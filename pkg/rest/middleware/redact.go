@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+type RedactMode string
+
+const (
+	// RedactMask replaces sensitive values with a fixed placeholder.
+	RedactMask RedactMode = "mask"
+	// RedactHash replaces sensitive values with a keyed hash, so that log
+	// lines about the same value can still be correlated.
+	RedactHash RedactMode = "hash"
+)
+
+const redacted = "[REDACTED]"
+
+type RedactConfig struct {
+	// Fields are JSON keys, matched case-insensitively at any depth.
+	Fields []string
+	// Paths are dot separated JSON paths from the root of the body, where
+	// "*" matches any key or array item, such as "legs.*.to".
+	Paths []string
+	// Patterns are regular expressions whose matches are redacted from
+	// every string, such as CPFs or emails.
+	Patterns []string
+	// Headers are the names of the request headers redacted.
+	Headers []string
+
+	Mode RedactMode
+	// HashKey keys the hashes of RedactHash. Unkeyed hashes of values as
+	// short as a CPF are reversed by brute force; a random key, unique to
+	// the process, is used when empty.
+	HashKey []byte
+}
+
+// DefaultRedactConfig redacts credentials and the personal data of account
+// holders.
+var DefaultRedactConfig = RedactConfig{
+	Fields: []string{"key", "secret", "password", "token", "document", "name", "email"},
+	Patterns: []string{
+		// CPF, formatted or not
+		`\b\d{3}\.?\d{3}\.?\d{3}-?\d{2}\b`,
+		// CNPJ, formatted or not
+		`\b\d{2}\.?\d{3}\.?\d{3}/?\d{4}-?\d{2}\b`,
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	},
+	Headers: []string{echo.HeaderAuthorization, "X-API-Key", echo.HeaderCookie, echo.HeaderSetCookie},
+	Mode:    RedactMask,
+}
+
+// Redactor removes sensitive data from the bodies and headers logged.
+type Redactor struct {
+	fields   map[string]bool
+	fieldsRe *regexp.Regexp
+	paths    [][]string
+	patterns []*regexp.Regexp
+	headers  map[string]bool
+	mode     RedactMode
+	key      []byte
+}
+
+// NewRedactor creates a Redactor from cfg, failing on invalid patterns or
+// modes. The zero RedactConfig masks nothing.
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	r := &Redactor{
+		fields:  make(map[string]bool, len(cfg.Fields)),
+		headers: make(map[string]bool, len(cfg.Headers)),
+		mode:    cfg.Mode,
+		key:     cfg.HashKey,
+	}
+
+	switch r.mode {
+	case "":
+		r.mode = RedactMask
+	case RedactMask, RedactHash:
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q", cfg.Mode)
+	}
+
+	if r.mode == RedactHash && len(r.key) == 0 {
+		r.key = make([]byte, 32)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, fmt.Errorf("failed to generate hash key: %w", err)
+		}
+	}
+
+	quoted := make([]string, 0, len(cfg.Fields))
+	for _, f := range cfg.Fields {
+		r.fields[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+
+	if len(quoted) > 0 {
+		// a field name followed by its value, a string, possibly cut short,
+		// or a scalar
+		r.fieldsRe = regexp.MustCompile(`"(?i:` + strings.Join(quoted, "|") + `)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+
+	for _, p := range cfg.Paths {
+		r.paths = append(r.paths, strings.Split(p, "."))
+	}
+
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	for _, h := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return r, nil
+}
+
+// Merge returns cfg with the fields, paths, patterns and headers of other
+// appended, and its mode and hash key when set.
+func (cfg RedactConfig) Merge(other RedactConfig) RedactConfig {
+	merged := RedactConfig{
+		Fields:   append(append([]string(nil), cfg.Fields...), other.Fields...),
+		Paths:    append(append([]string(nil), cfg.Paths...), other.Paths...),
+		Patterns: append(append([]string(nil), cfg.Patterns...), other.Patterns...),
+		Headers:  append(append([]string(nil), cfg.Headers...), other.Headers...),
+		Mode:     cfg.Mode,
+		HashKey:  cfg.HashKey,
+	}
+
+	if other.Mode != "" {
+		merged.Mode = other.Mode
+	}
+
+	if len(other.HashKey) > 0 {
+		merged.HashKey = other.HashKey
+	}
+
+	return merged
+}
+
+// Body decodes a logged body and redacts it. Bodies that are not valid
+// JSON are logged as text, see Text.
+func (r *Redactor) Body(bs []byte) any {
+	if len(bs) == 0 {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return r.Text(string(bs))
+	}
+
+	return r.value(nil, v)
+}
+
+// Text redacts a body that could not be decoded, such as a truncated JSON
+// document: the values of the fields found and the matches of the patterns.
+// Paths are not redacted, since they cannot be told in text.
+func (r *Redactor) Text(s string) string {
+	if r.fieldsRe != nil {
+		s = r.fieldsRe.ReplaceAllStringFunc(s, func(m string) string {
+			loc := r.fieldsRe.FindStringSubmatchIndex(m)
+			value := strings.Trim(m[loc[2]:loc[3]], `"`)
+			return m[:loc[2]] + `"` + r.replace(value) + `"`
+		})
+	}
+
+	return r.String(s)
+}
+
+// Header returns the first value of every header in h, redacting the
+// sensitive ones.
+func (r *Redactor) Header(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string, len(h))
+	for k, vs := range h {
+		if len(vs) == 0 {
+			continue
+		}
+
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			m[k] = r.replace(vs[0])
+			continue
+		}
+		m[k] = r.String(vs[0])
+	}
+
+	return m
+}
+
+// String redacts the matches of every pattern from s.
+func (r *Redactor) String(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, r.replace)
+	}
+	return s
+}
+
+func (r *Redactor) value(path []string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			p := append(path[:len(path):len(path)], k)
+			if r.fields[strings.ToLower(k)] || r.matchesPath(p) {
+				v[k] = r.replaceValue(item)
+				continue
+			}
+			v[k] = r.value(p, item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			p := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if r.matchesPath(p) {
+				v[i] = r.replaceValue(item)
+				continue
+			}
+			v[i] = r.value(p, item)
+		}
+		return v
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) matchesPath(path []string) bool {
+paths:
+	for _, p := range r.paths {
+		if len(p) != len(path) {
+			continue
+		}
+		for i := range p {
+			if p[i] != "*" && p[i] != path[i] {
+				continue paths
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// replaceValue returns what is logged in place of the sensitive JSON
+// value v.
+func (r *Redactor) replaceValue(v any) string {
+	s, ok := v.(string)
+	if !ok && r.mode == RedactHash {
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	return r.replace(s)
+}
+
+// replace returns what is logged in place of the sensitive string s.
+func (r *Redactor) replace(s string) string {
+	if r.mode != RedactHash {
+		return redacted
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
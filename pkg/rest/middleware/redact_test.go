@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/slog"
+)
+
+// sensitive are values that must never reach the logs.
+var sensitive = []string{
+	"Alice Liddell",
+	"123.456.789-09",
+	"12345678909",
+	"alice@example.com",
+	"root-secret",
+	"whsec_0123456789",
+	"01H8XGJWBWBAQ4Z5V3ZJ6D1TEN",
+}
+
+func TestLoggerRedactsSensitiveData(t *testing.T) {
+	redactor, err := NewRedactor(DefaultRedactConfig.Merge(RedactConfig{
+		Paths: []string{"legs.*.to"},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	e := echo.New()
+	e.POST("/accounts", func(c echo.Context) error {
+		io.Copy(io.Discard, c.Request().Body)
+		return c.JSONBlob(http.StatusCreated, []byte(`{"name":"Alice Liddell","secret":"whsec_0123456789","notes":["reach alice@example.com"]}`))
+	}, NewLoggerWithConfig(logger, Config{WithHeaders: true, Redactor: redactor}))
+
+	body := `{"name":"Alice Liddell","document":"123.456.789-09","memo":"cpf 12345678909","legs":[{"to":"01H8XGJWBWBAQ4Z5V3ZJ6D1TEN","amount":10}]}`
+	req := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer root-secret")
+	req.Header.Set("X-Forwarded-Email", "alice@example.com")
+
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	logged := buf.String()
+	if !strings.Contains(logged, redacted) {
+		t.Fatalf("expected the request to be logged redacted, got %s", logged)
+	}
+
+	for _, v := range sensitive {
+		if strings.Contains(logged, v) {
+			t.Errorf("%q leaked into the logs: %s", v, logged)
+		}
+	}
+
+	if !strings.Contains(logged, `"amount":10`) || !strings.Contains(logged, echo.MIMEApplicationJSON) {
+		t.Errorf("expected values that are not sensitive to be logged, got %s", logged)
+	}
+}
+
+func TestRedactHashCorrelatesValues(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{Fields: []string{"document"}, Mode: RedactHash, HashKey: []byte("key")})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+
+	first := r.Body([]byte(`{"document":"12345678909"}`)).(map[string]any)["document"]
+	second := r.Body([]byte(`{"Document":"12345678909"}`)).(map[string]any)["Document"]
+	other := r.Body([]byte(`{"document":"98765432100"}`)).(map[string]any)["document"]
+
+	if first != second || first == other {
+		t.Fatalf("expected equal values to hash alike and others not, got %v, %v and %v", first, second, other)
+	}
+
+	if s := first.(string); !strings.HasPrefix(s, "sha256:") || strings.Contains(s, "12345678909") {
+		t.Fatalf("expected a hash, got %s", s)
+	}
+}
+
+func TestRedactRejectsInvalidConfig(t *testing.T) {
+	if _, err := NewRedactor(RedactConfig{Patterns: []string{"("}}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+
+	if _, err := NewRedactor(RedactConfig{Mode: "scramble"}); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
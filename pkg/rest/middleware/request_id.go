@@ -2,7 +2,10 @@ package middleware
 
 import (
 	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/lrweck/clean-api/pkg/slogger"
 )
 
 func RequestIDConfig() middleware.RequestIDConfig {
@@ -12,5 +15,10 @@ func RequestIDConfig() middleware.RequestIDConfig {
 			return uuid.NewString()
 		},
 		TargetHeader: middleware.DefaultRequestIDConfig.TargetHeader,
+		// lets slogger.ContextHandler log the id with every record
+		RequestIDHandler: func(c echo.Context, id string) {
+			req := c.Request()
+			c.SetRequest(req.WithContext(slogger.ContextWithRequestID(req.Context(), id)))
+		},
 	}
 }
@@ -4,7 +4,7 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var paths2ignore = []string{"/health", "/metrics"}
+var paths2ignore = []string{"/health/live", "/health/ready", "/metrics"}
 
 func Skipper(c echo.Context) bool {
 	for _, path := range paths2ignore {
@@ -12,10 +12,8 @@ import (
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
-	"golang.org/x/exp/slog"
 
 	"github.com/lrweck/clean-api/pkg/envutil"
-	"github.com/lrweck/clean-api/pkg/slogger"
 	"github.com/lrweck/clean-api/pkg/telemetry"
 )
 
@@ -63,15 +61,6 @@ func OpenTelemetry() echo.MiddlewareFunc {
 			ctx = context.WithValue(ctx, telemetry.TraceID, traceID)
 			ctx = context.WithValue(ctx, telemetry.SpanID, spanID)
 
-			logger := slogger.FromContext(ctx)
-
-			logger = logger.With(
-				slog.String(string(telemetry.TraceID), traceID),
-				slog.String(string(telemetry.SpanID), spanID),
-			)
-
-			ctx = context.WithValue(ctx, slogger.LoggerKey, logger)
-
 			// pass the span through the request context
 			c.SetRequest(req.WithContext(ctx))
 
@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const codecCtx = "rest.codec"
+
+// Negotiate picks the response codec from the Accept header before the
+// handler runs, so requests the API cannot answer fail with 406 instead of
+// having effects.
+func Negotiate() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+			accept := c.Request().Header.Get(echo.HeaderAccept)
+
+			codec, ok := NegotiateCodec(accept)
+			if !ok {
+				return ProblemNotAcceptable.Wrap(fmt.Errorf("unsupported media types %q", accept))
+			}
+
+			c.Set(codecCtx, codec)
+			return next(c)
+		}
+	}
+}
+
+// responseCodec returns the codec negotiated for the request, defaulting
+// to JSON.
+func responseCodec(c echo.Context) Codec {
+	if codec, ok := c.Get(codecCtx).(Codec); ok {
+		return codec
+	}
+	return JSONCodec
+}
+
+// respond writes v with the negotiated codec.
+func respond(c echo.Context, status int, v any) error {
+	codec := responseCodec(c)
+	if codec == JSONCodec {
+		return c.JSON(status, v)
+	}
+
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, v); err != nil {
+		return err
+	}
+
+	return c.Blob(status, codec.MediaType(), buf.Bytes())
+}
+
+// Binder decodes request bodies with the codec of their Content-Type.
+type Binder struct{}
+
+func NewBinder() *Binder {
+	return &Binder{}
+}
+
+func (b *Binder) Bind(i any, c echo.Context) error {
+
+	req := c.Request()
+	if req.ContentLength == 0 {
+		return nil
+	}
+
+	codec, ok := CodecFor(req.Header.Get(echo.HeaderContentType))
+	if !ok {
+		return echo.ErrUnsupportedMediaType
+	}
+
+	var err error
+	if codec == JSONCodec {
+		err = c.Echo().JSONSerializer.Deserialize(c, i)
+	} else {
+		err = codec.Decode(req.Body, i)
+	}
+
+	if httpErr := new(echo.HTTPError); err != nil && !errors.As(err, &httpErr) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return err
+}
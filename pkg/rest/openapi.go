@@ -0,0 +1,389 @@
+package rest
+
+import (
+	_ "embed"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/openapi"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// CreatedResponse is the body of successful creations.
+type CreatedResponse struct {
+	ID string `json:"id"`
+}
+
+var (
+	specOnce sync.Once
+	spec     *openapi.Document
+)
+
+// OpenAPI returns the OpenAPI document of the v1 API. Every route
+// registered by the application must be documented here.
+func OpenAPI() *openapi.Document {
+	specOnce.Do(func() {
+		spec = newOpenAPI()
+	})
+	return spec
+}
+
+func newOpenAPI() *openapi.Document {
+
+	doc := openapi.New("clean-api", "1.0.0", "Accounts and transfers between them. Errors are RFC 7807 problems with a stable code. "+
+		"Bodies are negotiated through Accept and Content-Type as JSON, MessagePack or CBOR; binary encodings carry decimals as strings.")
+	doc.Encodings = []string{MIMEApplicationMessagePack, MIMEApplicationCBOR}
+
+	doc.AddSecurityScheme("bearer", openapi.SecurityScheme{Type: "http", Scheme: "bearer",
+		Description: "An API key, or a JWT issued to an end user, sent as a bearer token. Operations list the scopes the caller needs; " +
+			"admin grants them all and is reserved for API keys. End users only see and move funds from the accounts they own."})
+	doc.AddSecurityScheme("apiKey", openapi.SecurityScheme{Type: "apiKey", In: "header", Name: HeaderAPIKey,
+		Description: "An API key sent in the X-API-Key header."})
+
+	var (
+		internal     = example(ProblemInternal, "")
+		malformed    = example(ProblemMalformedBody, "Syntax error: offset=1, error=invalid character 'x' looking for beginning of value")
+		unsupported  = example(ProblemUnsupportedMediaType, "Unsupported Media Type")
+		notAccepted  = example(ProblemNotAcceptable, "")
+		unauthorized = example(ProblemUnauthorized, "")
+		forbidden    = example(ProblemForbidden, "requires the accounts:write scope")
+		rateLimited  = example(ProblemRateLimited, "rate limit of 600 requests per 1m0s exceeded")
+		invalidID    = example(ProblemInvalidID, "")
+		invalidAccID = example(ProblemInvalidAccountID, "")
+		created      = openapi.Reply{Status: http.StatusCreated, Body: CreatedResponse{}}
+		withProblems = func(replies []openapi.Reply, ps ...Problem) []openapi.Reply {
+			return append(replies, problems(append(ps, notAccepted, unauthorized, forbidden, rateLimited)...)...)
+		}
+		transferInput = []Problem{
+			malformed, unsupported, invalidAccID,
+			example(ProblemInvalidAmount, "amount must be greater than zero"),
+			example(ProblemSameAccount, "cannot transfer to the same account"),
+			example(ProblemInvalidLegs, "the amounts of the legs must add up to the transfer amount"),
+			example(ProblemTransferAccountNotFound, "destination account 01H8XGJWBWBAQ4Z4XK7N8K5X0M not found"),
+			example(ProblemInsufficientFunds, "insufficient funds"),
+			example(ProblemAccountNotOwned, ""),
+			example(ProblemServiceUnavailable, ""),
+			internal,
+		}
+	)
+
+	// accounts
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/accounts",
+		ID: "createAccount", Summary: "Create an account", Tag: "accounts",
+		Scopes:  scopes(auth.ScopeAccountsWrite),
+		Request: POSTAccountRequest{},
+		Replies: withProblems([]openapi.Reply{created},
+			malformed, unsupported,
+			example(ProblemValidation, "the request has invalid fields", "account name is required"),
+			internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/accounts/:id",
+		ID: "getAccount", Summary: "Retrieve an account", Tag: "accounts",
+		Scopes: scopes(auth.ScopeAccountsRead),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETAccountResponse{}}},
+			invalidID, example(ProblemAccountNotFound, "account not found"), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/accounts/:id/events",
+		ID: "streamAccountEvents", Summary: "Stream the activity of an account as Server-Sent Events", Tag: "accounts",
+		Scopes: scopes(auth.ScopeAccountsRead),
+		Params: []openapi.Parameter{{
+			Name: "Last-Event-ID", In: "header",
+			Description: "Resumes the stream after the given event id, as long as the same instance serves it.",
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+		Replies: append([]openapi.Reply{{Status: http.StatusOK, ContentType: "text/event-stream", Body: &openapi.Schema{Type: "string"},
+			Description: "balance.changed, transfer.completed and transfer.failed events, on a best-effort basis: " +
+				"only those relayed by the instance serving the stream are sent"}},
+			problems(invalidID, example(ProblemAccountNotFound, "account not found"), unauthorized, forbidden, rateLimited, internal)...),
+	})
+
+	// transfers
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/transfers",
+		ID: "createTransfer", Summary: "Execute or schedule a transfer", Tag: "transfers",
+		Scopes:  scopes(auth.ScopeTransfersWrite),
+		Request: POSTTransferRequest{},
+		Replies: withProblems([]openapi.Reply{created},
+			append(transferInput, example(ProblemExecuteAtInPast, "execution date must be in the future"))...),
+	})
+
+	batchItem := example(ProblemInvalidAccountID, "")
+	batchItem.Index = new(int)
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/transfers/batch",
+		ID: "createTransferBatch", Summary: "Execute a batch of transfers", Tag: "transfers",
+		Scopes:  scopes(auth.ScopeTransfersWrite),
+		Request: POSTTransferBatchRequest{},
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: POSTTransferBatchResponse{}}},
+			append([]Problem{
+				example(ProblemInvalidBatch, "batch must contain at least one transfer"),
+				example(ProblemScheduledInBatch, "batch transfers cannot be scheduled"),
+				batchItem,
+			}, transferInput...)...),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/transfers/:id",
+		ID: "getTransfer", Summary: "Retrieve a transfer", Tag: "transfers",
+		Scopes: scopes(auth.ScopeTransfersRead),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETTransferResponse{}}},
+			invalidID, example(ProblemTransferNotFound, "transfer not found"), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/transfers/:id/cancel",
+		ID: "cancelTransfer", Summary: "Cancel a scheduled transfer", Tag: "transfers",
+		Scopes: scopes(auth.ScopeTransfersWrite),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusNoContent}},
+			invalidID, example(ProblemTransferNotFound, "transfer not found"),
+			example(ProblemTransferNotCancelable, ""), internal),
+	})
+
+	// standing orders
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/standing-orders",
+		ID: "createStandingOrder", Summary: "Create a standing order", Tag: "standing-orders",
+		Scopes:  scopes(auth.ScopeStandingOrdersWrite),
+		Request: POSTStandingOrderRequest{},
+		Replies: withProblems([]openapi.Reply{created},
+			malformed, unsupported, invalidAccID,
+			example(ProblemValidation, "the request has invalid fields", "frequency must be one of daily, weekly or monthly"),
+			example(ProblemAccountNotOwned, ""), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/standing-orders/:id",
+		ID: "getStandingOrder", Summary: "Retrieve a standing order", Tag: "standing-orders",
+		Scopes: scopes(auth.ScopeStandingOrdersRead),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETStandingOrderResponse{}}},
+			invalidID, example(ProblemStandingOrderNotFound, "standing order not found"), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/standing-orders/:id/cancel",
+		ID: "cancelStandingOrder", Summary: "Cancel a standing order", Tag: "standing-orders",
+		Scopes: scopes(auth.ScopeStandingOrdersWrite),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusNoContent}},
+			invalidID, example(ProblemStandingOrderNotFound, "standing order not found"),
+			example(ProblemStandingOrderNotActive, ""), internal),
+	})
+
+	// webhooks
+
+	webhookNotFound := example(ProblemWebhookNotFound, "webhook subscription not found")
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/webhooks",
+		ID: "createWebhook", Summary: "Subscribe to events of accounts", Tag: "webhooks",
+		Scopes:  scopes(auth.ScopeWebhooksWrite),
+		Request: POSTWebhookRequest{},
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusCreated, Body: GETWebhookResponse{}, Description: "The secret is only returned on creation"}},
+			malformed, unsupported, invalidAccID,
+			example(ProblemValidation, "the request has invalid fields", "url must be an absolute https url"),
+			example(ProblemAccountNotOwned, ""), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/webhooks/:id",
+		ID: "getWebhook", Summary: "Retrieve a webhook subscription", Tag: "webhooks",
+		Scopes: scopes(auth.ScopeWebhooksRead),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETWebhookResponse{}}},
+			invalidID, webhookNotFound, internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodDelete, Path: "/v1/webhooks/:id",
+		ID: "deleteWebhook", Summary: "Delete a webhook subscription", Tag: "webhooks",
+		Scopes: scopes(auth.ScopeWebhooksWrite),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusNoContent}},
+			invalidID, webhookNotFound, internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/webhooks/:id/deliveries",
+		ID: "listWebhookDeliveries", Summary: "List the latest deliveries of a webhook subscription", Tag: "webhooks",
+		Scopes: scopes(auth.ScopeWebhooksRead),
+		Params: []openapi.Parameter{{
+			Name: "limit", In: "query",
+			Schema: &openapi.Schema{Type: "integer"},
+		}},
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: struct {
+			Deliveries []GETWebhookDeliveryResponse `json:"deliveries"`
+		}{}}},
+			invalidID, example(ProblemInvalidLimit, "must be between 1 and 100"), webhookNotFound, internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/webhooks/:id/deliveries/:delivery_id/redeliver",
+		ID: "redeliverWebhook", Summary: "Retry a dead webhook delivery", Tag: "webhooks",
+		Scopes: scopes(auth.ScopeWebhooksWrite),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusAccepted}},
+			invalidID, example(ProblemWebhookDeliveryNotFound, "webhook delivery not found"),
+			example(ProblemWebhookDeliveryNotDead, ""), internal),
+	})
+
+	// api keys
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPost, Path: "/v1/api-keys",
+		ID: "createAPIKey", Summary: "Issue an API key", Tag: "api-keys",
+		Scopes:  scopes(auth.ScopeAdmin),
+		Request: POSTAPIKeyRequest{},
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusCreated, Body: GETAPIKeyResponse{}, Description: "The key is only returned on creation"}},
+			malformed, unsupported,
+			example(ProblemValidation, "the request has invalid fields", "unknown scope: accounts:delete"),
+			internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/api-keys",
+		ID: "listAPIKeys", Summary: "List the API keys, revoked ones included", Tag: "api-keys",
+		Scopes: scopes(auth.ScopeAdmin),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: struct {
+			Keys []GETAPIKeyResponse `json:"keys"`
+		}{}}},
+			internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/api-keys/:id",
+		ID: "getAPIKey", Summary: "Retrieve an API key", Tag: "api-keys",
+		Scopes: scopes(auth.ScopeAdmin),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETAPIKeyResponse{}}},
+			invalidID, example(ProblemAPIKeyNotFound, "api key not found"), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodDelete, Path: "/v1/api-keys/:id",
+		ID: "revokeAPIKey", Summary: "Revoke an API key", Tag: "api-keys",
+		Scopes: scopes(auth.ScopeAdmin),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusNoContent}},
+			invalidID, example(ProblemAPIKeyNotFound, "api key not found"), internal),
+	})
+
+	// admin
+
+	logLevels := openapi.Reply{Status: http.StatusOK, Body: struct {
+		Levels []slogger.LevelInfo `json:"levels"`
+	}{}}
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/admin/log-levels",
+		ID: "listLogLevels", Summary: "List the log levels of the loggers", Tag: "admin",
+		Scopes:  scopes(auth.ScopeAdmin),
+		Replies: withProblems([]openapi.Reply{logLevels}, internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodPut, Path: "/v1/admin/log-levels",
+		ID: "setLogLevel", Summary: "Change the log level of a logger, for good or for a while", Tag: "admin",
+		Scopes:  scopes(auth.ScopeAdmin),
+		Request: PUTLogLevelRequest{},
+		Replies: withProblems([]openapi.Reply{logLevels},
+			malformed, unsupported,
+			example(ProblemInvalidLogLevel, "duration must be positive and at most 24h0m0s"),
+			internal),
+	})
+
+	query := func(name, typ, description string) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+	}
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/admin/audit",
+		ID: "listAuditEntries", Summary: "List the audit log of state changes, oldest first", Tag: "admin",
+		Scopes: scopes(auth.ScopeAdmin),
+		Params: []openapi.Parameter{
+			query("actor", "string", "Such as user:<subject>, key:<api key id> or system:<worker>."),
+			query("action", "string", "Such as account.created or transfer.canceled."),
+			query("target", "string", "Id of an account, transfer or standing order the entries affect."),
+			query("from", "string", "RFC 3339 date of the first entries."),
+			query("to", "string", "RFC 3339 date the entries precede."),
+			query("after", "integer", "Seq of the last entry of the previous page."),
+			query("limit", "integer", ""),
+		},
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: struct {
+			Entries []GETAuditEntryResponse `json:"entries"`
+		}{}}},
+			example(ProblemInvalidAuditQuery, `invalid from "yesterday", expected an RFC 3339 date`),
+			example(ProblemInvalidLimit, "must be between 1 and 500"), internal),
+	})
+
+	doc.Add(openapi.Route{
+		Method: http.MethodGet, Path: "/v1/admin/audit/verification",
+		ID: "verifyAuditLog", Summary: "Verify the hash chain of the audit log", Tag: "admin",
+		Scopes:  scopes(auth.ScopeAdmin),
+		Replies: withProblems([]openapi.Reply{{Status: http.StatusOK, Body: GETAuditVerificationResponse{}}}, internal),
+	})
+
+	return doc
+}
+
+func scopes(ss ...auth.Scope) []string {
+	scopes := make([]string, len(ss))
+	for i, s := range ss {
+		scopes[i] = string(s)
+	}
+	return scopes
+}
+
+// problems documents the problem replies of an operation, grouping the
+// examples by status.
+func problems(examples ...Problem) []openapi.Reply {
+	var replies []openapi.Reply
+	byStatus := make(map[int]int)
+
+	for _, p := range examples {
+		i, ok := byStatus[p.Status]
+		if !ok {
+			i = len(replies)
+			byStatus[p.Status] = i
+			replies = append(replies, openapi.Reply{
+				Status:      p.Status,
+				ContentType: ProblemContentType,
+				Body:        Problem{},
+				Examples:    map[string]any{},
+			})
+		}
+		replies[i].Examples[p.Code] = p
+	}
+
+	return replies
+}
+
+// example renders a sample problem of the given type.
+func example(t ProblemType, detail string, errs ...string) Problem {
+	pe := t.Wrap(nil)
+	pe.Detail = detail
+	pe.Errors = errs
+	return pe.Problem("8ba2a1e4-0c1f-4b8e-9b7e-2f1d9c4e6a53")
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// GET_OpenAPI serves the OpenAPI document of the API.
+func GET_OpenAPI(doc *openapi.Document) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	}
+}
+
+// GET_Docs serves a page rendering the OpenAPI document.
+func GET_Docs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.HTMLBlob(http.StatusOK, docsPage)
+	}
+}
@@ -0,0 +1,309 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/standingorder"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/internal/webhook"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix turns codes into the problem type URIs.
+const problemTypePrefix = "urn:clean-api:problem:"
+
+// Problem is the RFC 7807 body of every error response. Code is stable and
+// meant for clients to branch on; Errors and Index are extension members
+// listing validation failures and the failed item of a batch.
+type Problem struct {
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Status   int      `json:"status"`
+	Detail   string   `json:"detail,omitempty"`
+	Instance string   `json:"instance,omitempty"`
+	Code     string   `json:"code"`
+	Errors   []string `json:"errors,omitempty"`
+	Index    *int     `json:"index,omitempty"`
+}
+
+// ProblemType is an entry of the error catalogue.
+type ProblemType struct {
+	Code   string
+	Title  string
+	Status int
+	// Detail is used when the problem has no detail of its own.
+	Detail string
+}
+
+// The error catalogue. Codes must never change once published.
+var (
+	ProblemMalformedBody           = ProblemType{Code: "malformed_body", Title: "Malformed request body", Status: http.StatusBadRequest}
+	ProblemUnsupportedMediaType    = ProblemType{Code: "unsupported_media_type", Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType}
+	ProblemNotAcceptable           = ProblemType{Code: "not_acceptable", Title: "Not acceptable", Status: http.StatusNotAcceptable, Detail: "supported media types are application/json, application/msgpack and application/cbor"}
+	ProblemValidation              = ProblemType{Code: "validation_error", Title: "Validation failed", Status: http.StatusBadRequest}
+	ProblemInvalidID               = ProblemType{Code: "invalid_id", Title: "Invalid id", Status: http.StatusBadRequest, Detail: "must be a valid ulid"}
+	ProblemInvalidAccountID        = ProblemType{Code: "invalid_account_id", Title: "Invalid account id", Status: http.StatusBadRequest, Detail: "account ids must be valid ulids"}
+	ProblemInvalidLimit            = ProblemType{Code: "invalid_limit", Title: "Invalid limit", Status: http.StatusBadRequest}
+	ProblemInvalidAmount           = ProblemType{Code: "invalid_amount", Title: "Invalid amount", Status: http.StatusBadRequest}
+	ProblemSameAccount             = ProblemType{Code: "same_account", Title: "Same origin and destination", Status: http.StatusBadRequest}
+	ProblemExecuteAtInPast         = ProblemType{Code: "execute_at_in_past", Title: "Execution date in the past", Status: http.StatusBadRequest}
+	ProblemInvalidLegs             = ProblemType{Code: "invalid_legs", Title: "Invalid transfer legs", Status: http.StatusBadRequest}
+	ProblemScheduledInBatch        = ProblemType{Code: "scheduled_in_batch", Title: "Scheduled transfer in batch", Status: http.StatusBadRequest}
+	ProblemInvalidBatch            = ProblemType{Code: "invalid_batch", Title: "Invalid transfer batch", Status: http.StatusBadRequest}
+	ProblemAccountNotFound         = ProblemType{Code: "account_not_found", Title: "Account not found", Status: http.StatusNotFound}
+	ProblemTransferAccountNotFound = ProblemType{Code: "account_not_found", Title: "Transfer account not found", Status: http.StatusUnprocessableEntity}
+	ProblemInsufficientFunds       = ProblemType{Code: "insufficient_funds", Title: "Insufficient funds", Status: http.StatusUnprocessableEntity}
+	ProblemTransferNotFound        = ProblemType{Code: "transfer_not_found", Title: "Transfer not found", Status: http.StatusNotFound}
+	ProblemTransferNotCancelable   = ProblemType{Code: "transfer_not_cancelable", Title: "Transfer cannot be canceled", Status: http.StatusConflict, Detail: "only scheduled transfers can be canceled"}
+	ProblemStandingOrderNotFound   = ProblemType{Code: "standing_order_not_found", Title: "Standing order not found", Status: http.StatusNotFound}
+	ProblemStandingOrderNotActive  = ProblemType{Code: "standing_order_not_active", Title: "Standing order cannot be canceled", Status: http.StatusConflict, Detail: "only active standing orders can be canceled"}
+	ProblemWebhookNotFound         = ProblemType{Code: "webhook_not_found", Title: "Webhook subscription not found", Status: http.StatusNotFound}
+	ProblemWebhookDeliveryNotFound = ProblemType{Code: "webhook_delivery_not_found", Title: "Webhook delivery not found", Status: http.StatusNotFound}
+	ProblemWebhookDeliveryNotDead  = ProblemType{Code: "webhook_delivery_not_dead", Title: "Webhook delivery cannot be redelivered", Status: http.StatusConflict, Detail: "only dead deliveries can be redelivered"}
+	ProblemUnauthorized            = ProblemType{Code: "unauthorized", Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "a valid api key or bearer token is required"}
+	ProblemForbidden               = ProblemType{Code: "insufficient_scope", Title: "Insufficient scope", Status: http.StatusForbidden}
+	ProblemAccountNotOwned         = ProblemType{Code: "account_not_owned", Title: "Account not owned", Status: http.StatusForbidden, Detail: "the account belongs to another user"}
+	ProblemAPIKeyNotFound          = ProblemType{Code: "api_key_not_found", Title: "API key not found", Status: http.StatusNotFound}
+	ProblemRateLimited             = ProblemType{Code: "rate_limited", Title: "Too many requests", Status: http.StatusTooManyRequests}
+	ProblemInvalidLogLevel         = ProblemType{Code: "invalid_log_level", Title: "Invalid log level", Status: http.StatusBadRequest}
+	ProblemInvalidAuditQuery       = ProblemType{Code: "invalid_audit_query", Title: "Invalid audit log query", Status: http.StatusBadRequest}
+	ProblemRouteNotFound           = ProblemType{Code: "route_not_found", Title: "Route not found", Status: http.StatusNotFound}
+	ProblemMethodNotAllowed        = ProblemType{Code: "method_not_allowed", Title: "Method not allowed", Status: http.StatusMethodNotAllowed}
+	ProblemServiceUnavailable      = ProblemType{Code: "service_unavailable", Title: "Service unavailable", Status: http.StatusServiceUnavailable, Detail: "try again later"}
+	ProblemInternal                = ProblemType{Code: "internal_error", Title: "Internal server error", Status: http.StatusInternalServerError}
+)
+
+// Catalogue lists every problem type, for documentation.
+var Catalogue = []ProblemType{
+	ProblemMalformedBody, ProblemUnsupportedMediaType, ProblemNotAcceptable, ProblemValidation, ProblemInvalidID, ProblemInvalidAccountID, ProblemInvalidLimit,
+	ProblemInvalidAmount, ProblemSameAccount, ProblemExecuteAtInPast, ProblemInvalidLegs, ProblemScheduledInBatch,
+	ProblemInvalidBatch, ProblemAccountNotFound, ProblemTransferAccountNotFound, ProblemInsufficientFunds,
+	ProblemTransferNotFound, ProblemTransferNotCancelable, ProblemStandingOrderNotFound, ProblemStandingOrderNotActive,
+	ProblemWebhookNotFound, ProblemWebhookDeliveryNotFound, ProblemWebhookDeliveryNotDead, ProblemUnauthorized,
+	ProblemForbidden, ProblemAccountNotOwned, ProblemAPIKeyNotFound, ProblemRateLimited, ProblemInvalidLogLevel, ProblemInvalidAuditQuery,
+	ProblemRouteNotFound, ProblemMethodNotAllowed, ProblemServiceUnavailable, ProblemInternal,
+}
+
+// Wrap returns a problem of this type caused by err.
+func (t ProblemType) Wrap(err error) *ProblemError {
+	return &ProblemError{Type: t, Err: err}
+}
+
+// ProblemError is an error the error handler renders as a problem.
+type ProblemError struct {
+	Type   ProblemType
+	Detail string
+	Errors []string
+	Index  *int
+	Err    error
+}
+
+func (e *ProblemError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Type.Code
+}
+
+func (e *ProblemError) Unwrap() error {
+	return e.Err
+}
+
+// Problem renders the error for the request with the given id. The
+// causes of server errors are never described to clients.
+func (e *ProblemError) Problem(requestID string) Problem {
+	p := Problem{
+		Type:     problemTypePrefix + e.Type.Code,
+		Title:    e.Type.Title,
+		Status:   e.Type.Status,
+		Detail:   e.Detail,
+		Instance: requestID,
+		Code:     e.Type.Code,
+		Errors:   e.Errors,
+		Index:    e.Index,
+	}
+
+	if p.Detail == "" {
+		p.Detail = e.Type.Detail
+	}
+
+	if p.Detail == "" && e.Err != nil && e.Type.Status < http.StatusInternalServerError {
+		p.Detail = e.Err.Error()
+	}
+
+	return p
+}
+
+// HTTPErrorHandler renders every error returned by handlers and
+// middlewares as a problem, encoded with the negotiated codec.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	p := ToProblem(err).Problem(requestID)
+
+	if c.Request().Method == http.MethodHead {
+		c.NoContent(p.Status)
+		return
+	}
+
+	codec, contentType := responseCodec(c), ProblemContentType
+	if codec != JSONCodec {
+		contentType = codec.MediaType()
+	}
+
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, p); err != nil {
+		c.Logger().Error(err)
+		c.NoContent(http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.Blob(p.Status, contentType, buf.Bytes()); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// ToProblem maps an error to its entry in the catalogue.
+func ToProblem(err error) *ProblemError {
+
+	if pe := new(ProblemError); errors.As(err, &pe) {
+		return pe
+	}
+
+	var index *int
+	if item := new(transfer.ErrBatchItem); errors.As(err, &item) {
+		index = &item.Index
+		err = item.Err
+	}
+
+	pe := &ProblemError{Type: problemType(err), Err: err, Index: index}
+
+	if errs, ok := validationErrors(err); ok {
+		pe.Errors = errs
+		pe.Detail = "the request has invalid fields"
+	}
+
+	if httpErr := new(echo.HTTPError); errors.As(err, &httpErr) {
+		if msg, ok := httpErr.Message.(string); ok {
+			pe.Detail = msg
+		}
+	}
+
+	return pe
+}
+
+func problemType(err error) ProblemType {
+
+	if httpErr := new(echo.HTTPError); errors.As(err, &httpErr) {
+		switch httpErr.Code {
+		case http.StatusBadRequest:
+			return ProblemMalformedBody
+		case http.StatusUnsupportedMediaType:
+			return ProblemUnsupportedMediaType
+		case http.StatusNotAcceptable:
+			return ProblemNotAcceptable
+		case http.StatusUnauthorized:
+			return ProblemUnauthorized
+		case http.StatusForbidden:
+			return ProblemForbidden
+		case http.StatusNotFound:
+			return ProblemRouteNotFound
+		case http.StatusMethodNotAllowed:
+			return ProblemMethodNotAllowed
+		case http.StatusTooManyRequests:
+			return ProblemRateLimited
+		case http.StatusServiceUnavailable:
+			return ProblemServiceUnavailable
+		}
+
+		if httpErr.Code < http.StatusInternalServerError {
+			return ProblemType{
+				Code:   "http_" + strconv.Itoa(httpErr.Code),
+				Title:  http.StatusText(httpErr.Code),
+				Status: httpErr.Code,
+			}
+		}
+		return ProblemInternal
+	}
+
+	if _, ok := validationErrors(err); ok {
+		return ProblemValidation
+	}
+
+	switch {
+	case errors.Is(err, transfer.ErrInvalidAmount):
+		return ProblemInvalidAmount
+	case errors.Is(err, transfer.ErrSameAccount):
+		return ProblemSameAccount
+	case errors.Is(err, transfer.ErrExecuteAtInPast):
+		return ProblemExecuteAtInPast
+	case isInvalidLegsError(err):
+		return ProblemInvalidLegs
+	case errors.Is(err, transfer.ErrScheduledInBatch):
+		return ProblemScheduledInBatch
+	case errors.Is(err, transfer.ErrInvalidBatchMode),
+		errors.Is(err, transfer.ErrEmptyBatch),
+		errors.Is(err, transfer.ErrBatchTooLarge):
+		return ProblemInvalidBatch
+	case errors.As(err, new(*transfer.ErrAccountNotFound)):
+		return ProblemTransferAccountNotFound
+	case errors.Is(err, account.ErrNotFound):
+		return ProblemAccountNotFound
+	case errors.Is(err, transfer.ErrInsufficientFunds):
+		return ProblemInsufficientFunds
+	case errors.Is(err, transfer.ErrNotFound):
+		return ProblemTransferNotFound
+	case errors.Is(err, transfer.ErrNotScheduled):
+		return ProblemTransferNotCancelable
+	case errors.Is(err, standingorder.ErrNotFound):
+		return ProblemStandingOrderNotFound
+	case errors.Is(err, standingorder.ErrNotActive):
+		return ProblemStandingOrderNotActive
+	case errors.Is(err, webhook.ErrNotFound):
+		return ProblemWebhookNotFound
+	case errors.Is(err, webhook.ErrDeliveryNotFound):
+		return ProblemWebhookDeliveryNotFound
+	case errors.Is(err, webhook.ErrNotDead):
+		return ProblemWebhookDeliveryNotDead
+	case errors.Is(err, apikey.ErrMissingKey),
+		errors.Is(err, apikey.ErrInvalidKey),
+		errors.Is(err, auth.ErrInvalidToken):
+		return ProblemUnauthorized
+	case errors.Is(err, auth.ErrNotOwner):
+		return ProblemAccountNotOwned
+	case errors.Is(err, apikey.ErrNotFound):
+		return ProblemAPIKeyNotFound
+	case errors.Is(err, ErrBulkQueueFull),
+		errors.Is(err, ErrBulkClosed):
+		return ProblemServiceUnavailable
+	default:
+		return ProblemInternal
+	}
+}
+
+// validationErrors returns the failures listed by the validation errors of
+// the domain packages.
+func validationErrors(err error) ([]string, bool) {
+	var errval interface{ Errors() []string }
+	if errors.As(err, &errval) {
+		return errval.Errors(), true
+	}
+	return nil, false
+}
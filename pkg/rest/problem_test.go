@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goccy "github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+func TestHTTPErrorHandlerRendersProblems(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+		index  *int
+	}{
+		{"bind", echo.NewHTTPError(http.StatusBadRequest, "Syntax error: offset=1"), http.StatusBadRequest, "malformed_body", "Syntax error: offset=1", nil},
+		{"media type", echo.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported Media Type", nil},
+		{"route", echo.ErrNotFound, http.StatusNotFound, "route_not_found", "Not Found", nil},
+		{"invalid id", ProblemInvalidID.Wrap(errors.New("ulid: bad data size")), http.StatusBadRequest, "invalid_id", "must be a valid ulid", nil},
+		{"account not found", account.ErrNotFound, http.StatusNotFound, "account_not_found", "account not found", nil},
+		{"transfer account not found", transfer.NewErrAccountNotFound(ulid.ULID{}, "origin"), http.StatusUnprocessableEntity, "account_not_found", "origin account 00000000000000000000000000 not found", nil},
+		{"batch item", &transfer.ErrBatchItem{Index: 2, Err: transfer.ErrInsufficientFunds}, http.StatusUnprocessableEntity, "insufficient_funds", "insufficient funds", new(int)},
+		{"queue full", ErrBulkQueueFull, http.StatusServiceUnavailable, "service_unavailable", "try again later", nil},
+		{"internal", fmt.Errorf("query failed: %w", errors.New("connection reset")), http.StatusInternalServerError, "internal_error", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderXRequestID, "req-1")
+			rec := httptest.NewRecorder()
+
+			HTTPErrorHandler(tt.err, e.NewContext(req, rec))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get(echo.HeaderContentType); ct != ProblemContentType {
+				t.Fatalf("expected content type %s, got %s", ProblemContentType, ct)
+			}
+
+			var p Problem
+			if err := goccy.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+
+			if p.Code != tt.code || p.Type != problemTypePrefix+tt.code || p.Status != tt.status {
+				t.Fatalf("unexpected problem %+v", p)
+			}
+			if p.Detail != tt.detail {
+				t.Fatalf("expected detail %q, got %q", tt.detail, p.Detail)
+			}
+			if p.Instance != "req-1" {
+				t.Fatalf("expected the request id as instance, got %q", p.Instance)
+			}
+			if (tt.index == nil) != (p.Index == nil) {
+				t.Fatalf("unexpected index %v", p.Index)
+			}
+		})
+	}
+}
+
+func TestValidationProblemListsErrors(t *testing.T) {
+
+	_, err := account.NewService(nil, account.Options{}).New(context.Background(), account.NewAccount{})
+
+	p := ToProblem(err).Problem("")
+	if p.Code != ProblemValidation.Code || p.Status != http.StatusBadRequest {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if len(p.Errors) == 0 {
+		t.Fatal("expected the failed validations to be listed")
+	}
+}
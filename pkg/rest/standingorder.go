@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/standingorder"
+)
+
+type POSTStandingOrderRequest struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Amount      decimal.Decimal `json:"amount"`
+	Frequency   string          `json:"frequency"`
+	StartAt     time.Time       `json:"start_at"`
+	EndAt       time.Time       `json:"end_at"`
+	Occurrences int             `json:"occurrences"`
+}
+
+type GETStandingOrderResponse struct {
+	ID          string          `json:"id"`
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Amount      decimal.Decimal `json:"amount"`
+	Frequency   string          `json:"frequency"`
+	Status      string          `json:"status"`
+	StartAt     time.Time       `json:"start_at"`
+	EndAt       *time.Time      `json:"end_at,omitempty"`
+	Occurrences int             `json:"occurrences,omitempty"`
+	Executed    int             `json:"executed"`
+	NextRunAt   *time.Time      `json:"next_run_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   *time.Time      `json:"updated_at,omitempty"`
+}
+
+type StandingOrderService interface {
+	New(ctx context.Context, o standingorder.NewOrder) (ulid.ULID, error)
+	Retrieve(ctx context.Context, id ulid.ULID) (*standingorder.Order, error)
+	Cancel(ctx context.Context, id ulid.ULID) error
+}
+
+func V1_POST_StandingOrder(svc StandingOrderService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req POSTStandingOrderRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		from, errFrom := ulid.ParseStrict(req.From)
+		to, errTo := ulid.ParseStrict(req.To)
+		if err := errors.Join(errFrom, errTo); err != nil {
+			return ProblemInvalidAccountID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if err := authorizeAccount(ctx, accounts, from); err != nil {
+			return err
+		}
+
+		id, err := svc.New(ctx, standingorder.NewOrder{
+			From:           from,
+			To:             to,
+			Amount:         req.Amount,
+			Frequency:      standingorder.Frequency(req.Frequency),
+			StartAt:        req.StartAt,
+			EndAt:          req.EndAt,
+			MaxOccurrences: req.Occurrences,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusCreated, CreatedResponse{ID: id.String()})
+	}
+}
+
+func V1_GET_StandingOrder(svc StandingOrderService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		o, err := retrieveStandingOrder(ctx, svc, accounts, id)
+		if err != nil {
+			return err
+		}
+
+		response := GETStandingOrderResponse{
+			ID:          o.ID.String(),
+			From:        o.From.String(),
+			To:          o.To.String(),
+			Amount:      o.Amount,
+			Frequency:   string(o.Frequency),
+			Status:      string(o.Status),
+			StartAt:     o.StartAt,
+			EndAt:       timeOrNil(o.EndAt),
+			Occurrences: o.MaxOccurrences,
+			Executed:    o.Executed,
+			CreatedAt:   o.CreatedAt,
+			UpdatedAt:   timeOrNil(o.UpdatedAt),
+		}
+
+		if o.Status == standingorder.StatusActive {
+			response.NextRunAt = &o.NextRunAt
+		}
+
+		return respond(c, http.StatusOK, response)
+	}
+}
+
+func V1_POST_CancelStandingOrder(svc StandingOrderService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if _, err := retrieveStandingOrder(ctx, svc, accounts, id); err != nil {
+			return err
+		}
+
+		if err := svc.Cancel(ctx, id); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// retrieveStandingOrder returns standing order id when the caller of ctx
+// owns its source account.
+func retrieveStandingOrder(ctx context.Context, svc StandingOrderService, accounts AccountService, id ulid.ULID) (*standingorder.Order, error) {
+
+	o, err := svc.Retrieve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeAccount(ctx, accounts, o.From); err != nil {
+		return nil, hideUnowned(err, standingorder.ErrNotFound)
+	}
+
+	return o, nil
+}
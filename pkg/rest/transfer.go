@@ -0,0 +1,213 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+type POSTTransferRequest struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Amount    decimal.Decimal `json:"amount"`
+	ExecuteAt time.Time       `json:"execute_at"`
+	Legs      []TransferLeg   `json:"legs"`
+}
+
+// TransferLeg is a destination of a multi-leg transfer.
+type TransferLeg struct {
+	To     string          `json:"to"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+type GETTransferResponse struct {
+	ID            string          `json:"id"`
+	From          string          `json:"from"`
+	To            string          `json:"to,omitempty"`
+	Legs          []TransferLeg   `json:"legs,omitempty"`
+	Amount        decimal.Decimal `json:"amount"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ExecuteAt     *time.Time      `json:"execute_at,omitempty"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+	FailureReason string          `json:"failure_reason,omitempty"`
+
+	StandingOrderID string `json:"standing_order_id,omitempty"`
+	Occurrence      int    `json:"occurrence,omitempty"`
+}
+
+type TransferService interface {
+	New(ctx context.Context, tx transfer.NewTx) (ulid.ULID, error)
+	Retrieve(ctx context.Context, id ulid.ULID) (*transfer.Transaction, error)
+	Cancel(ctx context.Context, id ulid.ULID) error
+}
+
+func V1_POST_Transfer(svc TransferService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req POSTTransferRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		from, to, legs, err := parseTransferAccounts(req.From, req.To, req.Legs)
+		if err != nil {
+			return ProblemInvalidAccountID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if err := authorizeAccount(ctx, accounts, from); err != nil {
+			return err
+		}
+
+		id, err := svc.New(ctx, transfer.NewTx{
+			From:      from,
+			To:        to,
+			Amount:    req.Amount,
+			ExecuteAt: req.ExecuteAt,
+			Legs:      legs,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusCreated, CreatedResponse{ID: id.String()})
+	}
+}
+
+// parseTransferAccounts parses the origin and destinations of a transfer.
+// A multi-leg transfer has no single destination, so to is optional when
+// there are legs.
+func parseTransferAccounts(from, to string, legs []TransferLeg) (fromID, toID ulid.ULID, txLegs []transfer.Leg, err error) {
+
+	if fromID, err = ulid.ParseStrict(from); err != nil {
+		return
+	}
+
+	if to != "" || len(legs) == 0 {
+		if toID, err = ulid.ParseStrict(to); err != nil {
+			return
+		}
+	}
+
+	for _, leg := range legs {
+		legTo, err := ulid.ParseStrict(leg.To)
+		if err != nil {
+			return fromID, toID, nil, err
+		}
+		txLegs = append(txLegs, transfer.Leg{To: legTo, Amount: leg.Amount})
+	}
+
+	return fromID, toID, txLegs, nil
+}
+
+func isInvalidLegsError(err error) bool {
+	return errors.Is(err, transfer.ErrLegsWithDestination) ||
+		errors.Is(err, transfer.ErrTooManyLegs) ||
+		errors.Is(err, transfer.ErrDuplicateLeg) ||
+		errors.Is(err, transfer.ErrUnbalancedLegs)
+}
+
+func V1_GET_Transfer(svc TransferService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		t, err := retrieveTransfer(ctx, svc, accounts, id)
+		if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusOK, newGETTransferResponse(t))
+	}
+}
+
+// V1_POST_CancelTransfer cancels a scheduled transfer before its execution.
+func V1_POST_CancelTransfer(svc TransferService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if _, err := retrieveTransfer(ctx, svc, accounts, id); err != nil {
+			return err
+		}
+
+		if err := svc.Cancel(ctx, id); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// retrieveTransfer returns transfer id when the caller of ctx owns its
+// source account.
+func retrieveTransfer(ctx context.Context, svc TransferService, accounts AccountService, id ulid.ULID) (*transfer.Transaction, error) {
+
+	t, err := svc.Retrieve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeAccount(ctx, accounts, t.From); err != nil {
+		return nil, hideUnowned(err, transfer.ErrNotFound)
+	}
+
+	return t, nil
+}
+
+func newGETTransferResponse(t *transfer.Transaction) GETTransferResponse {
+	res := GETTransferResponse{
+		ID:            t.ID.String(),
+		From:          t.From.String(),
+		Amount:        t.Amount,
+		Status:        string(t.Status),
+		CreatedAt:     t.CreatedAt,
+		ExecuteAt:     timeOrNil(t.ExecuteAt),
+		ProcessedAt:   timeOrNil(t.ProcessedAt),
+		FailureReason: t.FailureReason,
+	}
+
+	if len(t.Legs) == 0 {
+		res.To = t.To.String()
+	}
+
+	for _, leg := range t.Legs {
+		res.Legs = append(res.Legs, TransferLeg{
+			To:     leg.To.String(),
+			Amount: leg.Amount,
+		})
+	}
+
+	if t.StandingOrderID != (ulid.ULID{}) {
+		res.StandingOrderID = t.StandingOrderID.String()
+		res.Occurrence = t.Occurrence
+	}
+
+	return res
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
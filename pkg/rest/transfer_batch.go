@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+
+	"github.com/lrweck/clean-api/internal/transfer"
+)
+
+type POSTTransferBatchRequest struct {
+	Mode      string                  `json:"mode"`
+	Transfers []POSTTransferBatchItem `json:"transfers"`
+}
+
+type POSTTransferBatchItem struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Amount decimal.Decimal `json:"amount"`
+	Legs   []TransferLeg   `json:"legs"`
+}
+
+type POSTTransferBatchResponse struct {
+	Mode    string                    `json:"mode"`
+	Results []TransferBatchItemResult `json:"results"`
+}
+
+type TransferBatchItemResult struct {
+	Index  int                 `json:"index"`
+	Status int                 `json:"status"`
+	ID     string              `json:"id,omitempty"`
+	Error  *TransferBatchError `json:"error,omitempty"`
+}
+
+type TransferBatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type TransferBatchService interface {
+	NewBatch(ctx context.Context, txs []transfer.NewTx, mode transfer.BatchMode) ([]transfer.BatchResult, error)
+}
+
+func V1_POST_TransferBatch(svc TransferBatchService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req POSTTransferBatchRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		if len(req.Transfers) > transfer.MaxBatchSize {
+			return transfer.ErrBatchTooLarge
+		}
+
+		mode := transfer.BatchMode(req.Mode)
+
+		ctx := c.Request().Context()
+
+		// only valid transfers reach the service; positions maps them back
+		// to their index in the request
+		txs := make([]transfer.NewTx, 0, len(req.Transfers))
+		positions := make([]int, 0, len(req.Transfers))
+		invalid := make(map[int]error)
+
+		for i, item := range req.Transfers {
+			from, to, legs, err := parseTransferAccounts(item.From, item.To, item.Legs)
+			if err == nil {
+				err = authorizeAccount(ctx, accounts, from)
+			} else {
+				pe := ProblemInvalidAccountID.Wrap(err)
+				pe.Detail = err.Error()
+				err = pe
+			}
+
+			if err != nil {
+				if mode == transfer.BatchAtomic {
+					pe := ToProblem(err)
+					pe.Index = &i
+					return pe
+				}
+				invalid[i] = err
+				continue
+			}
+
+			txs = append(txs, transfer.NewTx{
+				From:   from,
+				To:     to,
+				Amount: item.Amount,
+				Legs:   legs,
+			})
+			positions = append(positions, i)
+		}
+
+		results := make([]transfer.BatchResult, len(req.Transfers))
+
+		// every transfer may have been rejected already
+		if len(txs) > 0 || len(invalid) == 0 {
+			valid, err := svc.NewBatch(ctx, txs, mode)
+			if err != nil {
+				return err
+			}
+			for i, res := range valid {
+				results[positions[i]] = res
+			}
+		}
+
+		response := POSTTransferBatchResponse{
+			Mode:    string(mode),
+			Results: make([]TransferBatchItemResult, len(results)),
+		}
+
+		for i, res := range results {
+			item := TransferBatchItemResult{
+				Index:  i,
+				Status: http.StatusCreated,
+			}
+
+			err := invalid[i]
+			if err == nil {
+				err = res.Err
+			}
+
+			if err != nil {
+				p := ToProblem(err).Problem("")
+				if p.Detail == "" {
+					p.Detail = p.Title
+				}
+				item.Status = p.Status
+				item.Error = &TransferBatchError{p.Code, p.Detail}
+			} else {
+				item.ID = res.ID.String()
+			}
+
+			response.Results[i] = item
+		}
+
+		return respond(c, http.StatusOK, response)
+	}
+}
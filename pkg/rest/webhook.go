@@ -0,0 +1,259 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/lrweck/clean-api/internal/event"
+	"github.com/lrweck/clean-api/internal/webhook"
+)
+
+// MaxWebhookDeliveries caps the size of the delivery log page.
+const MaxWebhookDeliveries = 100
+
+type POSTWebhookRequest struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Accounts []string `json:"accounts"`
+	Secret   string   `json:"secret"`
+}
+
+type GETWebhookResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Accounts  []string  `json:"accounts"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GETWebhookDeliveryResponse struct {
+	ID             string     `json:"id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+type WebhookService interface {
+	New(ctx context.Context, n webhook.NewSubscription) (*webhook.Subscription, error)
+	Retrieve(ctx context.Context, id ulid.ULID) (*webhook.Subscription, error)
+	Delete(ctx context.Context, id ulid.ULID) error
+	Deliveries(ctx context.Context, id ulid.ULID, limit int) ([]webhook.Delivery, error)
+	Redeliver(ctx context.Context, subscription, id ulid.ULID) error
+}
+
+func V1_POST_Webhook(svc WebhookService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req POSTWebhookRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+
+		accountIDs := make([]ulid.ULID, len(req.Accounts))
+		for i, a := range req.Accounts {
+			id, err := ulid.ParseStrict(a)
+			if err != nil {
+				return ProblemInvalidAccountID.Wrap(err)
+			}
+			accountIDs[i] = id
+		}
+
+		types := make([]event.Type, len(req.Events))
+		for i, t := range req.Events {
+			types[i] = event.Type(t)
+		}
+
+		ctx := c.Request().Context()
+
+		if err := authorizeAccounts(ctx, accounts, accountIDs); err != nil {
+			return err
+		}
+
+		sub, err := svc.New(ctx, webhook.NewSubscription{
+			URL:        req.URL,
+			EventTypes: types,
+			Accounts:   accountIDs,
+			Secret:     req.Secret,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// the secret is only ever returned on creation
+		response := newWebhookResponse(sub)
+		response.Secret = sub.Secret
+
+		return respond(c, http.StatusCreated, response)
+	}
+}
+
+func V1_GET_Webhook(svc WebhookService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		sub, err := retrieveWebhook(ctx, svc, accounts, id)
+		if err != nil {
+			return err
+		}
+
+		return respond(c, http.StatusOK, newWebhookResponse(sub))
+	}
+}
+
+func V1_DELETE_Webhook(svc WebhookService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if _, err := retrieveWebhook(ctx, svc, accounts, id); err != nil {
+			return err
+		}
+
+		if err := svc.Delete(ctx, id); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func V1_GET_WebhookDeliveries(svc WebhookService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := ulid.ParseStrict(c.Param("id"))
+		if err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		limit := MaxWebhookDeliveries
+		if l := c.QueryParam("limit"); l != "" {
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > MaxWebhookDeliveries {
+				pe := ProblemInvalidLimit.Wrap(fmt.Errorf("invalid delivery log limit %q", l))
+				pe.Detail = "must be between 1 and " + strconv.Itoa(MaxWebhookDeliveries)
+				return pe
+			}
+		}
+
+		ctx := c.Request().Context()
+
+		if _, err := retrieveWebhook(ctx, svc, accounts, id); err != nil {
+			return err
+		}
+
+		ds, err := svc.Deliveries(ctx, id, limit)
+		if err != nil {
+			return err
+		}
+
+		response := make([]GETWebhookDeliveryResponse, len(ds))
+		for i, d := range ds {
+			response[i] = GETWebhookDeliveryResponse{
+				ID:             d.ID.String(),
+				EventID:        d.EventID.String(),
+				EventType:      string(d.EventType),
+				Status:         string(d.Status),
+				Attempts:       d.Attempts,
+				LastAttemptAt:  timeOrNil(d.LastAttemptAt),
+				LastStatusCode: d.LastStatusCode,
+				LastError:      d.LastError,
+				CreatedAt:      d.CreatedAt,
+				DeliveredAt:    timeOrNil(d.DeliveredAt),
+			}
+
+			if d.Status == webhook.DeliveryPending {
+				response[i].NextAttemptAt = timeOrNil(d.NextAttemptAt)
+			}
+		}
+
+		return respond(c, http.StatusOK, echo.Map{
+			"deliveries": response,
+		})
+	}
+}
+
+func V1_POST_RedeliverWebhook(svc WebhookService, accounts AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, errID := ulid.ParseStrict(c.Param("id"))
+		delivery, errDelivery := ulid.ParseStrict(c.Param("delivery_id"))
+		if err := errors.Join(errID, errDelivery); err != nil {
+			return ProblemInvalidID.Wrap(err)
+		}
+
+		ctx := c.Request().Context()
+
+		if _, err := retrieveWebhook(ctx, svc, accounts, id); err != nil {
+			return err
+		}
+
+		if err := svc.Redeliver(ctx, id, delivery); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+// retrieveWebhook returns subscription id when the caller of ctx owns every
+// account it is limited to.
+func retrieveWebhook(ctx context.Context, svc WebhookService, accounts AccountService, id ulid.ULID) (*webhook.Subscription, error) {
+
+	sub, err := svc.Retrieve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeAccounts(ctx, accounts, sub.Accounts); err != nil {
+		return nil, hideUnowned(err, webhook.ErrNotFound)
+	}
+
+	return sub, nil
+}
+
+func newWebhookResponse(sub *webhook.Subscription) GETWebhookResponse {
+
+	events := make([]string, len(sub.EventTypes))
+	for i, t := range sub.EventTypes {
+		events[i] = string(t)
+	}
+
+	accounts := make([]string, len(sub.Accounts))
+	for i, a := range sub.Accounts {
+		accounts[i] = a.String()
+	}
+
+	return GETWebhookResponse{
+		ID:        sub.ID.String(),
+		URL:       sub.URL,
+		Events:    events,
+		Accounts:  accounts,
+		CreatedAt: sub.CreatedAt,
+	}
+}
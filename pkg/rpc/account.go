@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/pkg/rpc/pb"
+)
+
+type AccountService interface {
+	New(ctx context.Context, a account.NewAccount) (ulid.ULID, error)
+	Retrieve(ctx context.Context, id string) (*account.Account, error)
+}
+
+type AccountServer struct {
+	pb.UnimplementedAccountServiceServer
+
+	svc AccountService
+}
+
+func NewAccountServer(svc AccountService) *AccountServer {
+	return &AccountServer{svc: svc}
+}
+
+func (s *AccountServer) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+
+	balance, err := parseAmount(req.GetStartingBalance(), true)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "starting_balance must be a decimal number")
+	}
+
+	id, err := s.svc.New(ctx, account.NewAccount{
+		Name:            req.GetName(),
+		Document:        req.GetDocument(),
+		StartingBalance: balance,
+		Owner:           subjectOf(ctx),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.CreateAccountResponse{Id: id.String()}, nil
+}
+
+func (s *AccountServer) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.Account, error) {
+
+	if _, err := ulid.ParseStrict(req.GetId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id must be a valid ulid")
+	}
+
+	acc, err := s.svc.Retrieve(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	// accounts of other users are hidden, not forbidden
+	if !owns(ctx, acc.Owner) {
+		return nil, toStatus(ctx, account.ErrNotFound)
+	}
+
+	return &pb.Account{
+		Id:        acc.ID.String(),
+		Name:      acc.Name,
+		Document:  acc.Document,
+		Balance:   acc.Balance.String(),
+		CreatedAt: timestamppb.New(acc.CreatedAt),
+	}, nil
+}
+
+// parseAmount parses a decimal sent as a string, which may be empty when
+// optional.
+func parseAmount(s string, optional bool) (decimal.Decimal, error) {
+	if s == "" && optional {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(s)
+}
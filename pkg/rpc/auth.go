@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/pkg/rest/middleware"
+	"github.com/lrweck/clean-api/pkg/rpc/pb"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// apiKeyKey is the metadata key of an API key, the gRPC counterpart of the
+// X-API-Key header.
+var apiKeyKey = strings.ToLower("X-API-Key")
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, secret string) (*auth.Principal, error)
+}
+
+// MethodScopes are the scopes each method requires. Methods missing from
+// it require auth.ScopeAdmin.
+var MethodScopes = map[string]auth.Scope{
+	pb.AccountService_CreateAccount_FullMethodName:   auth.ScopeAccountsWrite,
+	pb.AccountService_GetAccount_FullMethodName:      auth.ScopeAccountsRead,
+	pb.TransferService_CreateTransfer_FullMethodName: auth.ScopeTransfersWrite,
+	pb.TransferService_GetTransfer_FullMethodName:    auth.ScopeTransfersRead,
+	pb.TransferService_CancelTransfer_FullMethodName: auth.ScopeTransfersWrite,
+}
+
+// Authenticate resolves the credentials of the call, sent in the metadata
+// like the HTTP API expects them in headers, and attaches their principal
+// to the context and to the call-scoped logger. A nil tokens accepts API
+// keys only.
+func Authenticate(keys, tokens Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		secret := auth.SecretOf(first(md, strings.ToLower(echo.HeaderAuthorization)), first(md, apiKeyKey))
+
+		authn := keys
+		if tokens != nil && auth.IsJWT(secret) {
+			authn = tokens
+		}
+
+		p, err := authn.Authenticate(ctx, secret)
+		if err != nil {
+			return nil, toStatus(ctx, err)
+		}
+
+		attr := slog.String("api-key", p.KeyID.String())
+		if p.Subject != "" {
+			attr = slog.String("subject", p.Subject)
+		}
+
+		ctx = auth.ContextWithPrincipal(ctx, p)
+		ctx = context.WithValue(ctx, slogger.LoggerKey, slogger.FromContext(ctx).With(attr))
+
+		return handler(ctx, req)
+	}
+}
+
+// RequireScopes rejects calls whose principal was not granted the scope
+// scopes lists for their method, auth.ScopeAdmin for unlisted methods. It
+// must run after Authenticate.
+func RequireScopes(scopes map[string]auth.Scope) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		p, ok := auth.PrincipalFromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "api key is required")
+		}
+
+		scope, ok := scopes[info.FullMethod]
+		if !ok {
+			scope = auth.ScopeAdmin
+		}
+
+		if !p.Has(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "requires the %s scope", scope)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitKey returns the caller a call is accounted to.
+type RateLimitKey func(ctx context.Context) string
+
+// RateLimit allows each caller, as told by key, limit calls per period.
+// Calls over the limit are rejected with ResourceExhausted and a
+// retry-after header in seconds. A non-positive limit disables the
+// interceptor.
+func RateLimit(limit int, period time.Duration, key RateLimitKey) grpc.UnaryServerInterceptor {
+
+	if limit <= 0 || period <= 0 {
+		return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			return handler(ctx, req)
+		}
+	}
+
+	limiter := middleware.NewLimiter(limit, period)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		allowed, retryAfter := limiter.Allow(key(ctx), time.Now())
+		if !allowed {
+			secs := int((retryAfter + time.Second - 1) / time.Second)
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(secs)))
+			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("rate limit of %d calls per %s exceeded", limit, period))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// KeyByPeer accounts calls to the address of the connection, which unlike
+// metadata cannot be spoofed.
+func KeyByPeer(ctx context.Context) string {
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:"
+	}
+
+	host, _, err := net.SplitHostPort(pr.Addr.String())
+	if err != nil {
+		host = pr.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// KeyByPrincipal accounts calls to their API key or end user, and to the
+// peer when unauthenticated. It must run after Authenticate.
+func KeyByPrincipal(ctx context.Context) string {
+	p, ok := auth.PrincipalFromContext(ctx)
+	switch {
+	case !ok:
+		return KeyByPeer(ctx)
+	case p.Subject != "":
+		return "sub:" + p.Subject
+	default:
+		return "key:" + p.KeyID.String()
+	}
+}
+
+// owns reports whether the caller of ctx may act on an account of owner.
+func owns(ctx context.Context, owner string) bool {
+	p, ok := auth.PrincipalFromContext(ctx)
+	return !ok || p.Owns(owner)
+}
+
+// subjectOf returns the end user calling, empty for services.
+func subjectOf(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// authorizeAccount returns auth.ErrNotOwner when the caller of ctx may not
+// act on account id. Unknown accounts are reported alike, so that users
+// cannot probe for the ids of others.
+func authorizeAccount(ctx context.Context, accounts AccountService, id ulid.ULID) error {
+	if subjectOf(ctx) == "" {
+		return nil
+	}
+
+	acc, err := accounts.Retrieve(ctx, id.String())
+	if errors.Is(err, account.ErrNotFound) {
+		return auth.ErrNotOwner
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !owns(ctx, acc.Owner) {
+		return auth.ErrNotOwner
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/slogger"
+)
+
+// toStatus maps domain errors to gRPC statuses. Internal errors are logged
+// rather than described to clients.
+func toStatus(ctx context.Context, err error) error {
+
+	var (
+		accVal = new(account.ErrValidation)
+		code   codes.Code
+	)
+
+	switch {
+	case errors.As(err, &accVal):
+		return status.Error(codes.InvalidArgument, strings.Join(accVal.Errors(), "; "))
+	case errors.Is(err, transfer.ErrInvalidAmount),
+		errors.Is(err, transfer.ErrSameAccount),
+		errors.Is(err, transfer.ErrExecuteAtInPast),
+		errors.Is(err, transfer.ErrLegsWithDestination),
+		errors.Is(err, transfer.ErrTooManyLegs),
+		errors.Is(err, transfer.ErrDuplicateLeg),
+		errors.Is(err, transfer.ErrUnbalancedLegs):
+		code = codes.InvalidArgument
+	case errors.Is(err, transfer.ErrNotFound),
+		errors.Is(err, account.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, transfer.ErrInsufficientFunds),
+		errors.Is(err, transfer.ErrNotScheduled):
+		code = codes.FailedPrecondition
+	case errors.Is(err, apikey.ErrMissingKey),
+		errors.Is(err, apikey.ErrInvalidKey),
+		errors.Is(err, auth.ErrInvalidToken):
+		code = codes.Unauthenticated
+	case errors.Is(err, auth.ErrNotOwner):
+		code = codes.PermissionDenied
+	default:
+		slogger.FromContext(ctx).ErrorCtx(ctx, "internal error", slog.String("error", err.Error()))
+		return status.Error(codes.Internal, "internal server error")
+	}
+
+	return status.Error(code, rootCause(err).Error())
+}
+
+// rootCause returns the innermost domain error, dropping the context added
+// by the services, which mentions internal details.
+func rootCause(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+
+		// keep errors that describe themselves, like a missing account
+		if _, ok := err.(*transfer.ErrAccountNotFound); ok {
+			return err
+		}
+		err = next
+	}
+}
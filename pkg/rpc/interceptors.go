@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/lrweck/clean-api/pkg/envutil"
+	"github.com/lrweck/clean-api/pkg/slogger"
+	"github.com/lrweck/clean-api/pkg/telemetry"
+)
+
+// requestIDKey is the metadata key of the request id, the gRPC counterpart
+// of the X-Request-ID header.
+var requestIDKey = strings.ToLower(echo.HeaderXRequestID)
+
+// OpenTelemetry traces every call, continuing the trace propagated in the
+// incoming metadata, and passes the trace and span ids down the context
+// like the HTTP middleware does.
+func OpenTelemetry() grpc.UnaryServerInterceptor {
+
+	tProvider := otel.GetTracerProvider()
+	textProp := otel.GetTextMapPropagator()
+
+	appName := envutil.AppName()
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = textProp.Extract(ctx, metadataCarrier(md))
+
+		service, method := splitMethod(info.FullMethod)
+
+		ctx, span := tProvider.Tracer(appName).Start(ctx, info.FullMethod,
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(
+				semconv.RPCSystemGRPC,
+				semconv.RPCServiceKey.String(service),
+				semconv.RPCMethodKey.String(method),
+				attribute.String(echo.HeaderXRequestID, first(md, requestIDKey)),
+			))
+		defer span.End()
+
+		traceID := span.SpanContext().TraceID().String()
+		spanID := span.SpanContext().SpanID().String()
+
+		ctx = context.WithValue(ctx, telemetry.TraceID, traceID)
+		ctx = context.WithValue(ctx, telemetry.SpanID, spanID)
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int64(int64(code)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, code.String())
+		}
+
+		return resp, err
+	}
+}
+
+// NewLogger logs every call using slog, at error level for server failures
+// and warn level for client errors.
+func NewLogger(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		reqID := first(md, requestIDKey)
+		if reqID == "" {
+			reqID = uuid.NewString()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, reqID))
+
+		// logged with every record by slogger.ContextHandler
+		ctx = slogger.ContextWithRequestID(ctx, reqID)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		latency := time.Since(start)
+
+		code := status.Code(err)
+		attributes := []slog.Attr{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.String("latency", latency.String()),
+		}
+
+		if err != nil {
+			attributes = append(attributes, slog.String("error", err.Error()))
+		}
+
+		level := slog.LevelInfo
+		switch code {
+		case codes.OK:
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.Unimplemented:
+			level = slog.LevelError
+		default:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(ctx, level, "gRPC "+info.FullMethod, attributes...)
+
+		return resp, err
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method.
+func splitMethod(full string) (string, string) {
+	full = strings.TrimPrefix(full, "/")
+	if i := strings.LastIndex(full, "/"); i >= 0 {
+		return full[:i], full[i+1:]
+	}
+	return "", full
+}
+
+func first(md metadata.MD, key string) string {
+	if vs := md.Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// metadataCarrier adapts gRPC metadata to an OTel text map carrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return first(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+var _ propagation.TextMapCarrier = metadataCarrier{}
@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"time"
+
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+
+	"github.com/lrweck/clean-api/pkg/rpc/pb"
+)
+
+type ServerConfig struct {
+	// Keys authenticates API keys, and Tokens the JWTs of end users. A nil
+	// Tokens accepts API keys only.
+	Keys   Authenticator
+	Tokens Authenticator
+	// RateLimitPerPeer and RateLimitPerClient limit the calls of each
+	// address and of each principal per RatePeriod, unlimited when not
+	// positive.
+	RateLimitPerPeer   int
+	RateLimitPerClient int
+	RatePeriod         time.Duration
+	Logger             *slog.Logger
+}
+
+// NewServer returns a gRPC server exposing the account and transfer
+// services, traced, logged, authenticated and rate limited like the HTTP
+// API.
+func NewServer(acc AccountService, tx TransferService, cfg ServerConfig) *grpc.Server {
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			OpenTelemetry(),
+			NewLogger(cfg.Logger),
+			// addresses are limited before authentication, to slow down
+			// key guessing
+			RateLimit(cfg.RateLimitPerPeer, cfg.RatePeriod, KeyByPeer),
+			Authenticate(cfg.Keys, cfg.Tokens),
+			RateLimit(cfg.RateLimitPerClient, cfg.RatePeriod, KeyByPrincipal),
+			RequireScopes(MethodScopes),
+		),
+	)
+
+	pb.RegisterAccountServiceServer(srv, NewAccountServer(acc))
+	pb.RegisterTransferServiceServer(srv, NewTransferServer(tx, acc))
+
+	return srv
+}
@@ -0,0 +1,238 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lrweck/clean-api/internal/account"
+	"github.com/lrweck/clean-api/internal/apikey"
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/memorydb"
+	"github.com/lrweck/clean-api/pkg/rpc"
+	"github.com/lrweck/clean-api/pkg/rpc/pb"
+)
+
+// principals authenticates the secrets of the tests.
+type principals map[string]*auth.Principal
+
+func (ps principals) Authenticate(ctx context.Context, secret string) (*auth.Principal, error) {
+	if secret == "" {
+		return nil, apikey.ErrMissingKey
+	}
+	if p, ok := ps[secret]; ok {
+		return p, nil
+	}
+	return nil, apikey.ErrInvalidKey
+}
+
+var testPrincipals = principals{
+	"service": {KeyID: ulid.Make(), Name: "service", Scopes: []auth.Scope{
+		auth.ScopeAccountsRead, auth.ScopeAccountsWrite, auth.ScopeTransfersRead, auth.ScopeTransfersWrite,
+	}},
+	"reader": {KeyID: ulid.Make(), Name: "reader", Scopes: []auth.Scope{auth.ScopeAccountsRead}},
+	"alice": {Subject: "alice", Name: "alice", Scopes: []auth.Scope{
+		auth.ScopeAccountsRead, auth.ScopeAccountsWrite, auth.ScopeTransfersRead, auth.ScopeTransfersWrite,
+	}},
+}
+
+func newTestConn(t *testing.T, cfg rpc.ServerConfig) *grpc.ClientConn {
+	accounts := memorydb.NewAccountStorage()
+
+	cfg.Keys = testPrincipals
+	cfg.Logger = slog.Default()
+
+	srv := rpc.NewServer(
+		account.NewService(accounts, account.Options{}),
+		transfer.NewService(memorydb.NewTxStorage(accounts), transfer.Options{}),
+		cfg)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// as returns a context calling with secret.
+func as(secret string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+secret)
+}
+
+func TestServerTransfersAndMapsErrors(t *testing.T) {
+	ctx := as("service")
+	conn := newTestConn(t, rpc.ServerConfig{})
+
+	accClient := pb.NewAccountServiceClient(conn)
+	txClient := pb.NewTransferServiceClient(conn)
+
+	from, err := accClient.CreateAccount(ctx, &pb.CreateAccountRequest{Name: "from", Document: "1", StartingBalance: "10.50"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	to, _ := accClient.CreateAccount(ctx, &pb.CreateAccountRequest{Name: "to", Document: "2"})
+
+	created, err := txClient.CreateTransfer(ctx, &pb.CreateTransferRequest{From: from.Id, To: to.Id, Amount: "10.25"})
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+
+	tx, err := txClient.GetTransfer(ctx, &pb.GetTransferRequest{Id: created.Id})
+	if err != nil || tx.Status != string(transfer.StatusCompleted) || tx.Amount != "10.25" {
+		t.Fatalf("unexpected transfer %v: %v", tx, err)
+	}
+
+	acc, _ := accClient.GetAccount(ctx, &pb.GetAccountRequest{Id: from.Id})
+	if acc.Balance != "0.25" {
+		t.Fatalf("expected balance 0.25, got %s", acc.Balance)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"invalid account", func() error {
+			_, err := accClient.CreateAccount(ctx, &pb.CreateAccountRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"malformed id", func() error {
+			_, err := accClient.GetAccount(ctx, &pb.GetAccountRequest{Id: "nope"})
+			return err
+		}, codes.InvalidArgument},
+		{"missing transfer", func() error {
+			_, err := txClient.GetTransfer(ctx, &pb.GetTransferRequest{Id: from.Id})
+			return err
+		}, codes.NotFound},
+		{"insufficient funds", func() error {
+			_, err := txClient.CreateTransfer(ctx, &pb.CreateTransferRequest{From: from.Id, To: to.Id, Amount: "1"})
+			return err
+		}, codes.FailedPrecondition},
+		{"not scheduled", func() error {
+			_, err := txClient.CancelTransfer(ctx, &pb.CancelTransferRequest{Id: created.Id})
+			return err
+		}, codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		if code := status.Code(tt.call()); code != tt.code {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.code, code)
+		}
+	}
+}
+
+func TestServerAuthorizesCalls(t *testing.T) {
+	conn := newTestConn(t, rpc.ServerConfig{})
+
+	accClient := pb.NewAccountServiceClient(conn)
+	txClient := pb.NewTransferServiceClient(conn)
+
+	bob, err := accClient.CreateAccount(as("service"), &pb.CreateAccountRequest{Name: "bob", Document: "1", StartingBalance: "10"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	alice, err := accClient.CreateAccount(as("alice"), &pb.CreateAccountRequest{Name: "alice", Document: "2", StartingBalance: "10"})
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	fromBob, err := txClient.CreateTransfer(as("service"), &pb.CreateTransferRequest{From: bob.Id, To: alice.Id, Amount: "1"})
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"missing key", func() error {
+			_, err := accClient.GetAccount(context.Background(), &pb.GetAccountRequest{Id: bob.Id})
+			return err
+		}, codes.Unauthenticated},
+		{"invalid key", func() error {
+			_, err := accClient.GetAccount(metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "nope"), &pb.GetAccountRequest{Id: bob.Id})
+			return err
+		}, codes.Unauthenticated},
+		{"missing scope", func() error {
+			_, err := txClient.GetTransfer(as("reader"), &pb.GetTransferRequest{Id: fromBob.Id})
+			return err
+		}, codes.PermissionDenied},
+		{"own account", func() error {
+			_, err := accClient.GetAccount(as("alice"), &pb.GetAccountRequest{Id: alice.Id})
+			return err
+		}, codes.OK},
+		{"account of another user", func() error {
+			_, err := accClient.GetAccount(as("alice"), &pb.GetAccountRequest{Id: bob.Id})
+			return err
+		}, codes.NotFound},
+		{"transfer from another user", func() error {
+			_, err := txClient.CreateTransfer(as("alice"), &pb.CreateTransferRequest{From: bob.Id, To: alice.Id, Amount: "1"})
+			return err
+		}, codes.PermissionDenied},
+		{"transfer of another user", func() error {
+			_, err := txClient.GetTransfer(as("alice"), &pb.GetTransferRequest{Id: fromBob.Id})
+			return err
+		}, codes.NotFound},
+		{"cancel transfer of another user", func() error {
+			_, err := txClient.CancelTransfer(as("alice"), &pb.CancelTransferRequest{Id: fromBob.Id})
+			return err
+		}, codes.NotFound},
+		{"own transfer", func() error {
+			_, err := txClient.CreateTransfer(as("alice"), &pb.CreateTransferRequest{From: alice.Id, To: bob.Id, Amount: "1"})
+			return err
+		}, codes.OK},
+	}
+
+	for _, tt := range tests {
+		if code := status.Code(tt.call()); code != tt.code {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.code, code)
+		}
+	}
+}
+
+func TestServerLimitsRate(t *testing.T) {
+	conn := newTestConn(t, rpc.ServerConfig{RateLimitPerClient: 1, RatePeriod: time.Minute})
+	accClient := pb.NewAccountServiceClient(conn)
+
+	if _, err := accClient.CreateAccount(as("service"), &pb.CreateAccountRequest{Name: "a", Document: "1"}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	var header metadata.MD
+	_, err := accClient.CreateAccount(as("service"), &pb.CreateAccountRequest{Name: "b", Document: "2"}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted || first(header, "retry-after") != "60" {
+		t.Fatalf("expected the call to be limited for 60s, got %v with %v", err, header)
+	}
+
+	if _, err := accClient.CreateAccount(as("reader"), &pb.CreateAccountRequest{Name: "c", Document: "3"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected other clients not to be limited, got %v", err)
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if vs := md.Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
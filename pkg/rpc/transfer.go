@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/lrweck/clean-api/internal/auth"
+	"github.com/lrweck/clean-api/internal/transfer"
+	"github.com/lrweck/clean-api/pkg/rpc/pb"
+)
+
+type TransferService interface {
+	New(ctx context.Context, tx transfer.NewTx) (ulid.ULID, error)
+	Retrieve(ctx context.Context, id ulid.ULID) (*transfer.Transaction, error)
+	Cancel(ctx context.Context, id ulid.ULID) error
+}
+
+type TransferServer struct {
+	pb.UnimplementedTransferServiceServer
+
+	svc      TransferService
+	accounts AccountService
+}
+
+// NewTransferServer creates a TransferServer that checks with accounts
+// that end users only transfer from, and see transfers of, their own
+// accounts.
+func NewTransferServer(svc TransferService, accounts AccountService) *TransferServer {
+	return &TransferServer{svc: svc, accounts: accounts}
+}
+
+func (s *TransferServer) CreateTransfer(ctx context.Context, req *pb.CreateTransferRequest) (*pb.CreateTransferResponse, error) {
+
+	tx, err := newTx(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeAccount(ctx, s.accounts, tx.From); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	id, err := s.svc.New(ctx, tx)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.CreateTransferResponse{Id: id.String()}, nil
+}
+
+func (s *TransferServer) GetTransfer(ctx context.Context, req *pb.GetTransferRequest) (*pb.Transfer, error) {
+
+	id, err := ulid.ParseStrict(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id must be a valid ulid")
+	}
+
+	t, err := s.retrieve(ctx, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return newTransferMessage(t), nil
+}
+
+func (s *TransferServer) CancelTransfer(ctx context.Context, req *pb.CancelTransferRequest) (*pb.CancelTransferResponse, error) {
+
+	id, err := ulid.ParseStrict(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id must be a valid ulid")
+	}
+
+	if _, err := s.retrieve(ctx, id); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	if err := s.svc.Cancel(ctx, id); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.CancelTransferResponse{}, nil
+}
+
+// retrieve returns transfer id, reported as not found to end users who do
+// not own its source account.
+func (s *TransferServer) retrieve(ctx context.Context, id ulid.ULID) (*transfer.Transaction, error) {
+
+	t, err := s.svc.Retrieve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeAccount(ctx, s.accounts, t.From); errors.Is(err, auth.ErrNotOwner) {
+		return nil, transfer.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// newTx converts a request into a transfer, reporting malformed fields as
+// invalid arguments. A multi-leg transfer has no single destination.
+func newTx(req *pb.CreateTransferRequest) (transfer.NewTx, error) {
+
+	var (
+		tx  transfer.NewTx
+		err error
+	)
+
+	if tx.From, err = ulid.ParseStrict(req.GetFrom()); err != nil {
+		return tx, status.Error(codes.InvalidArgument, "from must be a valid ulid")
+	}
+
+	if req.GetTo() != "" || len(req.GetLegs()) == 0 {
+		if tx.To, err = ulid.ParseStrict(req.GetTo()); err != nil {
+			return tx, status.Error(codes.InvalidArgument, "to must be a valid ulid")
+		}
+	}
+
+	if tx.Amount, err = parseAmount(req.GetAmount(), false); err != nil {
+		return tx, status.Error(codes.InvalidArgument, "amount must be a decimal number")
+	}
+
+	if req.GetExecuteAt() != nil {
+		tx.ExecuteAt = req.GetExecuteAt().AsTime()
+	}
+
+	for _, leg := range req.GetLegs() {
+		to, err := ulid.ParseStrict(leg.GetTo())
+		if err != nil {
+			return tx, status.Error(codes.InvalidArgument, "legs.to must be a valid ulid")
+		}
+
+		amount, err := parseAmount(leg.GetAmount(), false)
+		if err != nil {
+			return tx, status.Error(codes.InvalidArgument, "legs.amount must be a decimal number")
+		}
+
+		tx.Legs = append(tx.Legs, transfer.Leg{To: to, Amount: amount})
+	}
+
+	return tx, nil
+}
+
+func newTransferMessage(t *transfer.Transaction) *pb.Transfer {
+	msg := &pb.Transfer{
+		Id:            t.ID.String(),
+		From:          t.From.String(),
+		Amount:        t.Amount.String(),
+		Status:        string(t.Status),
+		CreatedAt:     timestamppb.New(t.CreatedAt),
+		ExecuteAt:     timestampOrNil(t.ExecuteAt),
+		ProcessedAt:   timestampOrNil(t.ProcessedAt),
+		FailureReason: t.FailureReason,
+		Occurrence:    int32(t.Occurrence),
+	}
+
+	if len(t.Legs) == 0 {
+		msg.To = t.To.String()
+	}
+
+	for _, leg := range t.Legs {
+		msg.Legs = append(msg.Legs, &pb.TransferLeg{
+			To:     leg.To.String(),
+			Amount: leg.Amount.String(),
+		})
+	}
+
+	if t.StandingOrderID != (ulid.ULID{}) {
+		msg.StandingOrderId = t.StandingOrderID.String()
+	}
+
+	return msg
+}
+
+func timestampOrNil(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
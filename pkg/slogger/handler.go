@@ -0,0 +1,95 @@
+package slogger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// Keys of the correlation attributes added by ContextHandler.
+const (
+	TraceIDKey   = "TraceID"
+	SpanIDKey    = "SpanID"
+	RequestIDKey = "request-id"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the id of the request
+// it serves.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the id of the request ctx serves, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextHandler adds the trace and span ids of the span in the context of
+// each record, and the id of the request, so that logs correlate with
+// traces whichever logger wrote them, as long as it was given the context.
+type ContextHandler struct {
+	slog.Handler
+	spanEvents slog.Leveler
+}
+
+// NewContextHandler wraps h. Records of at least spanEvents are mirrored as
+// events of the span in their context; nil mirrors none.
+func NewContextHandler(h slog.Handler, spanEvents slog.Leveler) *ContextHandler {
+	return &ContextHandler{h, spanEvents}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	var attrs []slog.Attr
+
+	span := trace.SpanFromContext(ctx)
+	if sc := span.SpanContext(); sc.IsValid() {
+		attrs = append(attrs,
+			slog.String(TraceIDKey, sc.TraceID().String()),
+			slog.String(SpanIDKey, sc.SpanID().String()))
+	}
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String(RequestIDKey, id))
+	}
+
+	if h.spanEvents != nil && r.Level >= h.spanEvents.Level() && span.IsRecording() {
+		span.AddEvent(r.Message, trace.WithTimestamp(r.Time), trace.WithAttributes(eventAttributes(r)...))
+	}
+
+	if len(attrs) > 0 {
+		// records share their attributes with their copies
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{h.Handler.WithAttrs(attrs), h.spanEvents}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{h.Handler.WithGroup(name), h.spanEvents}
+}
+
+func eventAttributes(r slog.Record) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, r.NumAttrs()+1)
+	attrs = append(attrs, attribute.String("log.severity", r.Level.String()))
+
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, attribute.String(a.Key, a.Value.Resolve().String()))
+		return true
+	})
+
+	return attrs
+}
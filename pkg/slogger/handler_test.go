@@ -0,0 +1,59 @@
+package slogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/exp/slog"
+)
+
+func TestContextHandlerCorrelatesRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil), slog.LevelError))
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	ctx = ContextWithRequestID(ctx, "req-1")
+
+	logger.InfoCtx(ctx, "handled")
+	logger.With(slog.String("worker", "relay")).ErrorCtx(ctx, "failed", slog.String("error", "boom"))
+	logger.Info("unrelated")
+	span.End()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %s", buf.String())
+	}
+
+	sc := span.SpanContext()
+	for _, line := range lines[:2] {
+		for _, want := range []string{`"TraceID":"` + sc.TraceID().String(), `"SpanID":"` + sc.SpanID().String(), `"request-id":"req-1"`} {
+			if !strings.Contains(line, want) {
+				t.Errorf("expected %s in %s", want, line)
+			}
+		}
+	}
+
+	if strings.Contains(lines[2], "TraceID") || strings.Contains(lines[2], "request-id") {
+		t.Errorf("expected records without context not to be correlated, got %s", lines[2])
+	}
+
+	events := rec.Ended()[0].Events()
+	if len(events) != 1 || events[0].Name != "failed" {
+		t.Fatalf("expected only the error to be mirrored as a span event, got %+v", events)
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range events[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["error"] != "boom" || attrs["log.severity"] != "ERROR" {
+		t.Errorf("unexpected event attributes %v", attrs)
+	}
+}
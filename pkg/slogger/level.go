@@ -0,0 +1,209 @@
+package slogger
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Levels holds the minimum level of every named logger and lets it be
+// changed at runtime, for a while or for good. Loggers without a level of
+// their own log at the default level, named "".
+type Levels struct {
+	mu      sync.RWMutex
+	levels  map[string]*slog.LevelVar
+	base    map[string]slog.Level
+	reverts map[string]*revert
+}
+
+type revert struct {
+	timer *time.Timer
+	at    time.Time
+}
+
+// LevelInfo describes the level of a logger.
+type LevelInfo struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	// RevertAt is when a temporary level reverts, nil when it does not.
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// NewLevels creates Levels logging at def, with the levels of the loggers
+// in named.
+func NewLevels(def slog.Level, named map[string]slog.Level) *Levels {
+	l := &Levels{
+		levels:  make(map[string]*slog.LevelVar),
+		base:    make(map[string]slog.Level),
+		reverts: make(map[string]*revert),
+	}
+
+	l.setBase("", def)
+	for name, level := range named {
+		l.setBase(name, level)
+	}
+
+	return l
+}
+
+func (l *Levels) setBase(name string, level slog.Level) {
+	v := new(slog.LevelVar)
+	v.Set(level)
+	l.levels[name] = v
+	l.base[name] = level
+}
+
+// Level returns the level of the logger name.
+func (l *Levels) Level(name string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if v, ok := l.levels[name]; ok {
+		return v.Level()
+	}
+	return l.levels[""].Level()
+}
+
+// Set changes the level of the logger name. A positive revertAfter reverts
+// it to its configured level afterwards; otherwise the change is kept.
+func (l *Levels) Set(name string, level slog.Level, revertAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r, ok := l.reverts[name]; ok {
+		r.timer.Stop()
+		delete(l.reverts, name)
+	}
+
+	v, ok := l.levels[name]
+	if !ok {
+		v = new(slog.LevelVar)
+		l.levels[name] = v
+	}
+	v.Set(level)
+
+	if revertAfter <= 0 {
+		l.base[name] = level
+		return
+	}
+
+	r := &revert{at: time.Now().Add(revertAfter)}
+	r.timer = time.AfterFunc(revertAfter, func() { l.revert(name, r) })
+	l.reverts[name] = r
+}
+
+// Reset reverts the logger name to its configured level right away.
+func (l *Levels) Reset(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r, ok := l.reverts[name]; ok {
+		r.timer.Stop()
+		l.resetLocked(name)
+	}
+}
+
+// Temporary reports whether the level of the logger name reverts later.
+func (l *Levels) Temporary(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.reverts[name]
+	return ok
+}
+
+func (l *Levels) revert(name string, r *revert) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a later change replaced this revert
+	if l.reverts[name] == r {
+		l.resetLocked(name)
+	}
+}
+
+func (l *Levels) resetLocked(name string) {
+	delete(l.reverts, name)
+
+	if level, ok := l.base[name]; ok {
+		l.levels[name].Set(level)
+		return
+	}
+
+	// the logger had no level of its own before
+	delete(l.levels, name)
+}
+
+// List describes the level of every logger with a level of its own, the
+// default one first.
+func (l *Levels) List() []LevelInfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	list := make([]LevelInfo, 0, len(l.levels))
+	for name, v := range l.levels {
+		info := LevelInfo{Logger: name, Level: v.Level().String()}
+		if r, ok := l.reverts[name]; ok {
+			at := r.at
+			info.RevertAt = &at
+		}
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Logger < list[j].Logger })
+	return list
+}
+
+// AllLevels lets every record through the handlers wrapped by Levels.
+const AllLevels = slog.Level(math.MinInt32)
+
+// Handler wraps h so that records are filtered by the level of the logger
+// they were logged with. h itself must let every level through, see
+// AllLevels.
+func (l *Levels) Handler(h slog.Handler) slog.Handler {
+	return &levelHandler{h, l, ""}
+}
+
+// Named returns a child of logger named name, whose level may be changed
+// on its own when logger was created from a Levels handler.
+func Named(logger *slog.Logger, name string) *slog.Logger {
+	h, ok := logger.Handler().(*levelHandler)
+	if !ok {
+		return logger.With(slog.String("logger", name))
+	}
+
+	named := &levelHandler{h.Handler.WithAttrs([]slog.Attr{slog.String("logger", name)}), h.levels, name}
+	return slog.New(named)
+}
+
+// ParseLevel parses a level such as debug or WARN+2.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", s, err)
+	}
+	return level, nil
+}
+
+type levelHandler struct {
+	slog.Handler
+	levels *Levels
+	name   string
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.name) && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{h.Handler.WithAttrs(attrs), h.levels, h.name}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{h.Handler.WithGroup(name), h.levels, h.name}
+}
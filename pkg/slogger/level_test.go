@@ -0,0 +1,79 @@
+package slogger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func TestLevelsFilterNamedLoggers(t *testing.T) {
+	var buf bytes.Buffer
+
+	levels := NewLevels(slog.LevelInfo, map[string]slog.Level{"http": slog.LevelWarn})
+	root := slog.New(levels.Handler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: AllLevels})))
+	http := Named(root, "http")
+	events := Named(root, "events")
+
+	http.Info("http-info")
+	events.Info("events-info")
+	events.Debug("events-debug")
+
+	levels.Set("events", slog.LevelDebug, 0)
+	events.Debug("events-debug-enabled")
+	http.Debug("http-debug")
+
+	logged := buf.String()
+	for _, msg := range []string{"http-info", "events-debug ", "http-debug"} {
+		if strings.Contains(logged, msg) {
+			t.Errorf("expected %q to be filtered out, got %s", msg, logged)
+		}
+	}
+
+	for _, msg := range []string{"msg=events-info logger=events", "events-debug-enabled"} {
+		if !strings.Contains(logged, msg) {
+			t.Errorf("expected %q to be logged, got %s", msg, logged)
+		}
+	}
+}
+
+func TestTemporaryLevelsRevert(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo, nil)
+
+	levels.Set("", slog.LevelDebug, 20*time.Millisecond)
+	levels.Set("webhooks", slog.LevelDebug, 20*time.Millisecond)
+
+	if levels.Level("") != slog.LevelDebug || levels.Level("webhooks") != slog.LevelDebug || !levels.Temporary("") {
+		t.Fatal("expected debug to be enabled for a while")
+	}
+
+	list := levels.List()
+	if len(list) != 2 || list[0].Logger != "" || list[0].RevertAt == nil {
+		t.Fatalf("expected the default and the webhooks levels to be listed as temporary, got %+v", list)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if levels.Level("") != slog.LevelInfo || levels.Temporary("") {
+		t.Errorf("expected the default level to revert to info, got %s", levels.Level(""))
+	}
+
+	if len(levels.List()) != 1 || levels.Level("webhooks") != slog.LevelInfo {
+		t.Errorf("expected the webhooks logger to fall back to the default level, got %+v", levels.List())
+	}
+}
+
+func TestPermanentLevelsCancelReverts(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo, nil)
+
+	levels.Set("", slog.LevelDebug, 20*time.Millisecond)
+	levels.Set("", slog.LevelWarn, 0)
+
+	time.Sleep(50 * time.Millisecond)
+
+	if levels.Level("") != slog.LevelWarn {
+		t.Errorf("expected the permanent level to be kept, got %s", levels.Level(""))
+	}
+}
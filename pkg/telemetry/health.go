@@ -0,0 +1,20 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// ExporterReachable returns a health check dialing the OTLP endpoint
+// telemetry is exported to.
+func ExporterReachable(endpoint string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", endpoint)
+		if err != nil {
+			return fmt.Errorf("otlp endpoint unreachable: %w", err)
+		}
+		return conn.Close()
+	}
+}
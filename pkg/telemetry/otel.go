@@ -2,61 +2,381 @@ package telemetry
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"time"
 
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc/credentials"
 )
 
-func InitOTEL(ctx context.Context, otlpURL string) {
-	initTracer(ctx, otlpURL)
-	initMeters(ctx, otlpURL)
+// Exporters.
+const (
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	// ExporterFile appends JSON lines to Config.File.
+	ExporterFile = "file"
+	ExporterNone = "none"
+	// ExporterPrometheus serves metrics to be scraped by Prometheus. It
+	// exports metrics only.
+	ExporterPrometheus = "prometheus"
+)
+
+// Samplers, named as in the OTEL_TRACES_SAMPLER specification.
+const (
+	SamplerAlwaysOn       = "always_on"
+	SamplerAlwaysOff      = "always_off"
+	SamplerRatio          = "traceidratio"
+	SamplerParentAlwaysOn = "parentbased_always_on"
+	SamplerParentRatio    = "parentbased_traceidratio"
+)
+
+const defaultMetricsInterval = 2 * time.Second
+
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+
+	// Exporter sends spans, and metrics unless MetricsExporter is set.
+	Exporter        string
+	MetricsExporter string
+	MetricsInterval time.Duration
+
+	// Endpoint, Insecure, CACertFile and Headers configure the OTLP
+	// exporters. Without a CACertFile, the system roots are trusted.
+	Endpoint   string
+	Insecure   bool
+	CACertFile string
+	Headers    map[string]string
+
+	File string
+
+	Sampler     string
+	SamplerArg  float64
+	ErrorLogger *slog.Logger
+}
+
+// Providers is what the application needs from the initialized telemetry.
+type Providers struct {
+	// MetricsHandler serves the metrics in the Prometheus exposition
+	// format, nil unless they are exported to Prometheus.
+	MetricsHandler http.Handler
+	// Shutdown flushes buffered telemetry and releases the exporters.
+	Shutdown func(ctx context.Context) error
 }
 
-func initTracer(ctx context.Context, otlpURL string) {
-	traceExporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint(otlpURL),
-		otlptracegrpc.WithTimeout(2*time.Second),
+// InitOTEL installs the global tracer and meter providers. Telemetry is
+// never worth crashing for: a signal whose exporter cannot be set up is
+// left disabled, and the error is returned for the caller to report.
+func InitOTEL(ctx context.Context, cfg Config) (*Providers, error) {
+
+	if cfg.ErrorLogger != nil {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			cfg.ErrorLogger.Warn("telemetry export failed", slog.String("error", err.Error()))
+		}))
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		errs    []error
+		closers []func(ctx context.Context) error
+		file    *os.File
+		metrics = cfg.MetricsExporter
 	)
+
+	if metrics == "" {
+		metrics = cfg.Exporter
+	}
+
+	if cfg.Exporter == ExporterFile || metrics == ExporterFile {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return &Providers{Shutdown: noShutdown}, fmt.Errorf("failed to open telemetry file: %w", err)
+		}
+		file = f
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(cfg.ServiceName),
+			semconv.ServiceVersionKey.String(cfg.ServiceVersion),
+			semconv.DeploymentEnvironmentKey.String(cfg.Environment),
+		))
 	if err != nil {
-		panic(err)
+		// a partial resource is still usable
+		errs = append(errs, fmt.Errorf("failed to detect telemetry resource: %w", err))
+	}
+
+	tp, err := initTracer(ctx, cfg, res, file)
+	if err != nil {
+		errs = append(errs, err)
+	} else if tp != nil {
+		closers = append(closers, tp.Shutdown)
+	}
+
+	providers := new(Providers)
+
+	mp, handler, err := initMeters(ctx, cfg, metrics, res, file)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		providers.MetricsHandler = handler
+		closers = append(closers, mp.Shutdown)
+	}
+
+	providers.Shutdown = func(ctx context.Context) error {
+		var errs []error
+		for _, c := range closers {
+			errs = append(errs, c(ctx))
+		}
+		// closed last, once the providers flushed into it
+		if file != nil {
+			errs = append(errs, file.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	return providers, errors.Join(errs...)
+}
+
+func noShutdown(context.Context) error {
+	return nil
+}
+
+func initTracer(ctx context.Context, cfg Config, res *resource.Resource, fileOut io.Writer) (*sdktrace.TracerProvider, error) {
+
+	sampler, err := newSampler(cfg.Sampler, cfg.SamplerArg)
+	if err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Exporter {
+	case ExporterOTLPGRPC:
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(cfg.Endpoint),
+			otlptracegrpc.WithHeaders(cfg.Headers),
+			otlptracegrpc.WithTimeout(2 * time.Second),
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			tlsCfg, err := cfg.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		}
+
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(cfg.Endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+			otlptracehttp.WithTimeout(2 * time.Second),
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			tlsCfg, err := cfg.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case ExporterFile:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(fileOut))
+
+	case ExporterNone:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
 	}
 
 	provider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(traceExporter))
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithBatcher(exporter))
 
 	otel.SetTracerProvider(provider)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
+	return provider, nil
 }
 
-func initMeters(ctx context.Context, otlpURL string) {
+func newSampler(name string, arg float64) (sdktrace.Sampler, error) {
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerRatio:
+		return sdktrace.TraceIDRatioBased(arg), nil
+	case SamplerParentAlwaysOn, "":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(arg)), nil
+	}
+	return nil, fmt.Errorf("unknown trace sampler %q", name)
+}
+
+func initMeters(ctx context.Context, cfg Config, exporterName string, res *resource.Resource, fileOut io.Writer) (*metric.MeterProvider, http.Handler, error) {
 
-	metricExporter, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithInsecure(),
-		otlpmetricgrpc.WithEndpoint(otlpURL),
+	var (
+		handler  http.Handler
+		exporter metric.Exporter
+		err      error
+		opts     = []metric.Option{metric.WithResource(res)}
 	)
+
+	switch exporterName {
+	case ExporterOTLPGRPC:
+		mopts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.Endpoint),
+			otlpmetricgrpc.WithHeaders(cfg.Headers),
+		}
+
+		if cfg.Insecure {
+			mopts = append(mopts, otlpmetricgrpc.WithInsecure())
+		} else {
+			tlsCfg, err := cfg.tlsConfig()
+			if err != nil {
+				return nil, nil, err
+			}
+			mopts = append(mopts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		}
+
+		exporter, err = otlpmetricgrpc.New(ctx, mopts...)
+
+	case ExporterOTLPHTTP:
+		mopts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(cfg.Endpoint),
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+		}
+
+		if cfg.Insecure {
+			mopts = append(mopts, otlpmetrichttp.WithInsecure())
+		} else {
+			tlsCfg, err := cfg.tlsConfig()
+			if err != nil {
+				return nil, nil, err
+			}
+			mopts = append(mopts, otlpmetrichttp.WithTLSClientConfig(tlsCfg))
+		}
+
+		exporter, err = otlpmetrichttp.New(ctx, mopts...)
+
+	case ExporterStdout:
+		exporter, err = stdoutmetric.New(stdoutmetric.WithEncoder(json.NewEncoder(os.Stdout)))
+
+	case ExporterFile:
+		exporter, err = stdoutmetric.New(stdoutmetric.WithEncoder(json.NewEncoder(fileOut)))
+
+	case ExporterPrometheus:
+		// a registry of our own keeps the global one of client_golang, and
+		// whatever a dependency registers there, out of the scrape
+		registry := promclient.NewRegistry()
+		registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+		reader, err := prometheus.New(prometheus.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+		}
+
+		opts = append(opts, metric.WithReader(reader))
+		handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	case ExporterNone:
+
+	default:
+		return nil, nil, fmt.Errorf("unknown metrics exporter %q", exporterName)
+	}
+
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("failed to create %s metrics exporter: %w", exporterName, err)
 	}
 
-	meterProvider := metric.NewMeterProvider(
-		metric.WithReader(
-			metric.NewPeriodicReader(metricExporter, metric.WithInterval(time.Second*2))))
+	if exporter != nil {
+		interval := cfg.MetricsInterval
+		if interval <= 0 {
+			interval = defaultMetricsInterval
+		}
+		opts = append(opts, metric.WithReader(metric.NewPeriodicReader(exporter, metric.WithInterval(interval))))
+	}
+
+	meterProvider := metric.NewMeterProvider(opts...)
 
 	if err := runtime.Start(
 		runtime.WithMinimumReadMemStatsInterval(time.Second),
 		runtime.WithMeterProvider(meterProvider),
 	); err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("failed to start runtime metrics: %w", err)
 	}
 
 	otel.SetMeterProvider(meterProvider)
+
+	return meterProvider, handler, nil
+}
+
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CACertFile == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(cfg.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read otlp ca certificate: %w", err)
+	}
+
+	tlsCfg.RootCAs = x509.NewCertPool()
+	if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificate found in otlp ca certificate file")
+	}
+
+	return tlsCfg, nil
 }
@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestFileExporterFlushesOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "telemetry.jsonl")
+
+	p, err := InitOTEL(ctx, Config{ServiceName: "clean-api", Environment: "test", Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatalf("failed to initialize telemetry: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(ctx, "flushed-span")
+	span.End()
+
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), "flushed-span") || !strings.Contains(string(b), "deployment.environment") {
+		t.Fatalf("expected the buffered span and the resource to be written, got %s", b)
+	}
+}
+
+func TestInvalidConfigDoesNotPanic(t *testing.T) {
+	p, err := InitOTEL(context.Background(), Config{Exporter: "zipkin", Sampler: SamplerAlwaysOn})
+	if err == nil {
+		t.Fatal("expected an unknown exporter to be reported")
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected the shutdown of disabled telemetry to succeed, got %v", err)
+	}
+
+	if _, err := newSampler("sometimes", 0); err == nil {
+		t.Fatal("expected an unknown sampler to be reported")
+	}
+}
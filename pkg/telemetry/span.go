@@ -0,0 +1,19 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// End records err, when not nil, as the outcome of span and ends it. It is
+// meant to be deferred with a named error result:
+//
+//	ctx, span := tracer.Start(ctx, "account.New")
+//	defer func() { telemetry.End(span, err) }()
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
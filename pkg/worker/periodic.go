@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Periodic runs a job at a fixed interval in the background until stopped.
+type Periodic struct {
+	name     string
+	interval time.Duration
+	job      func(ctx context.Context) error
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewPeriodic(name string, interval time.Duration, logger *slog.Logger, job func(ctx context.Context) error) *Periodic {
+	return &Periodic{
+		name:     name,
+		interval: interval,
+		job:      job,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start launches the worker loop. Calling it again, or after Stop, does
+// nothing.
+func (p *Periodic) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started || p.stopped {
+		return
+	}
+	p.started = true
+
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.job(ctx); err != nil {
+					p.logger.Error("background job failed",
+						slog.String("worker", p.name),
+						slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to stop and waits for the running job, if any,
+// to finish or for ctx to expire.
+func (p *Periodic) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		if p.started {
+			p.cancel()
+		} else {
+			close(p.done)
+		}
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
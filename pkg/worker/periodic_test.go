@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestPeriodicRunsUntilStopped(t *testing.T) {
+	var runs atomic.Int32
+	ran := make(chan struct{}, 10)
+
+	p := NewPeriodic("test", time.Millisecond, discard, func(ctx context.Context) error {
+		runs.Add(1)
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		// failures are logged and do not stop the loop
+		return errors.New("failed")
+	})
+
+	p.Start(context.Background())
+	<-ran
+	<-ran
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+
+	stopped := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+
+	if got := runs.Load(); got != stopped {
+		t.Fatalf("expected no runs after Stop, got %d more", got-stopped)
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("expected Stop to be idempotent, got %v", err)
+	}
+}
+
+func TestPeriodicStopWaitsForTheRunningJob(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	p := NewPeriodic("test", time.Millisecond, discard, func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+
+	p.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Stop to wait for the running job, got %v", err)
+	}
+
+	close(release)
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("expected Stop to return once the job finished, got %v", err)
+	}
+}
+
+func TestPeriodicStopWithoutStart(t *testing.T) {
+	p := NewPeriodic("test", time.Hour, discard, func(ctx context.Context) error { return nil })
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("expected a worker that never started to stop right away, got %v", err)
+	}
+}
+
+func TestPeriodicDoesNotStartAfterStop(t *testing.T) {
+	var runs atomic.Int32
+	p := NewPeriodic("test", time.Millisecond, discard, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("failed to stop worker: %v", err)
+	}
+
+	p.Start(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	if got := runs.Load(); got != 0 {
+		t.Fatalf("expected a stopped worker not to start, got %d runs", got)
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("expected Stop to be idempotent, got %v", err)
+	}
+}